@@ -0,0 +1,89 @@
+package deputy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// ActivationFile is a file, usually a listening socket, passed to a child by
+// SocketActivation.
+type ActivationFile struct {
+	// Name, if set, is passed to the child in LISTEN_FDNAMES.
+	Name string
+	// File is the file to pass.
+	File *os.File
+}
+
+// SocketActivation prepares cmd so that it receives files the same way a
+// service started by systemd socket activation does: as file descriptors
+// starting at 3, described by LISTEN_FDS, LISTEN_PID, and LISTEN_FDNAMES.
+// This lets a supervisor bind sockets itself and hand them to children that
+// expect to be socket activated.  It must be called before any other files
+// are added to cmd.ExtraFiles.
+//
+// LISTEN_PID must be the child's own pid, which isn't known until it has
+// started, so cmd is rewritten to run through /bin/sh, which sets LISTEN_PID
+// and then execs the original program.  As a result the program's argv[0]
+// will be its path, and a Deputy's Policy will see the command as /bin/sh.
+// Unix only.
+func SocketActivation(cmd *exec.Cmd, files ...ActivationFile) error {
+	if runtime.GOOS == "windows" {
+		return fmt.Errorf("deputy: socket activation is not supported on %s", runtime.GOOS)
+	}
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+	if len(cmd.ExtraFiles) > 0 {
+		return errors.New("deputy: socket activation files must be the command's first extra files")
+	}
+	names := make([]string, len(files))
+	for i, f := range files {
+		if strings.Contains(f.Name, ":") {
+			return fmt.Errorf("deputy: socket activation name %q may not contain ':'", f.Name)
+		}
+		names[i] = f.Name
+		if names[i] == "" {
+			names[i] = "unknown"
+		}
+	}
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	cmd.Env = nil
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, "LISTEN_") {
+			cmd.Env = append(cmd.Env, kv)
+		}
+	}
+	for _, f := range files {
+		cmd.ExtraFiles = append(cmd.ExtraFiles, f.File)
+	}
+	cmd.Env = append(cmd.Env,
+		"LISTEN_FDS="+strconv.Itoa(len(files)),
+		"LISTEN_FDNAMES="+strings.Join(names, ":"),
+	)
+	args := append([]string{"/bin/sh", "-c", `LISTEN_PID=$$; export LISTEN_PID; exec "$0" "$@"`, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = "/bin/sh"
+	cmd.Args = args
+	return nil
+}
+
+// ListenerFile returns a duplicate of the file underlying l, suitable for
+// passing to a child with SocketActivation.  Closing the returned file does
+// not close l, and vice versa.
+func ListenerFile(l net.Listener) (*os.File, error) {
+	fl, ok := l.(interface {
+		File() (*os.File, error)
+	})
+	if !ok {
+		return nil, fmt.Errorf("deputy: can't get the file of a %T", l)
+	}
+	return fl.File()
+}
@@ -0,0 +1,48 @@
+package deputy
+
+import (
+	"net"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSocketActivation(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("socket activation is not supported on windows")
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	f, err := ListenerFile(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	cmd := exec.Command("/bin/sh", "-c", `test "$LISTEN_PID" = $$ && echo "$LISTEN_FDS $LISTEN_FDNAMES"`)
+	if err := SocketActivation(cmd, ActivationFile{Name: "http", File: f}); err != nil {
+		t.Fatalf("unexpected error from SocketActivation: %v", err)
+	}
+	out, err := Output(cmd)
+	if err != nil {
+		t.Fatalf("unexpected error returned from Output: %v", err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "1 http" {
+		t.Fatalf("unexpected output %q", got)
+	}
+
+	cmd = exec.Command("/bin/sh", "-c", "true")
+	cmd.Env = []string{"A=1"}
+	err = SocketActivation(cmd, ActivationFile{Name: "http", File: f}, ActivationFile{Name: "a:b", File: f})
+	if err == nil {
+		t.Fatal("expected an error for a name containing ':'")
+	}
+	if len(cmd.ExtraFiles) != 0 || !reflect.DeepEqual(cmd.Env, []string{"A=1"}) || cmd.Path != "/bin/sh" || len(cmd.Args) != 3 {
+		t.Fatalf("the command was changed despite the error: %+v", cmd)
+	}
+}
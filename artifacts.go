@@ -0,0 +1,183 @@
+package deputy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ArtifactStore keeps the files collected from a run's working directory, as
+// set by the Deputy's CollectArtifacts.
+type ArtifactStore interface {
+	// Store keeps the file at path.  name is the file's path relative to
+	// the command's working directory, in slash-separated form.
+	Store(name, path string) error
+}
+
+// ArtifactStoreFunc adapts an ordinary function to the ArtifactStore
+// interface.
+type ArtifactStoreFunc func(name, path string) error
+
+// Store implements ArtifactStore by calling f.
+func (f ArtifactStoreFunc) Store(name, path string) error {
+	return f(name, path)
+}
+
+// ArtifactDir is an ArtifactStore that copies artifacts into a directory,
+// under their names, creating the directories they need.
+type ArtifactDir string
+
+// Store implements ArtifactStore.
+func (dir ArtifactDir) Store(name, path string) error {
+	dst := filepath.Join(string(dir), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return copyFile(dst, path)
+}
+
+// copyFile copies the contents and permissions of the file at src to dst.
+func copyFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Artifact describes a file collected after a run, so that it can be
+// verified or cached.
+type Artifact struct {
+	// Name is the file's path relative to the command's working directory,
+	// in slash-separated form.
+	Name string `json:"name"`
+	// Size is the file's size in bytes.
+	Size int64 `json:"size"`
+	// SHA256 is the hex encoded SHA-256 of the file's contents.
+	SHA256 string `json:"sha256"`
+	// ModTime is when the file was last modified.
+	ModTime time.Time `json:"mod_time"`
+}
+
+// ErrArtifact is wrapped by the error returned from Run when an artifact
+// can't be collected.
+var ErrArtifact = errors.New("deputy: collecting artifact")
+
+// checkArtifacts reports an error if the Deputy's artifact settings are
+// invalid.
+func (d Deputy) checkArtifacts() error {
+	if len(d.CollectArtifacts) == 0 {
+		return nil
+	}
+	if d.ArtifactStore == nil {
+		return errors.New("deputy: CollectArtifacts set without an ArtifactStore")
+	}
+	for _, pattern := range d.CollectArtifacts {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("deputy: invalid artifact pattern %q: %v", pattern, err)
+		}
+		if !filepath.IsLocal(filepath.FromSlash(pattern)) {
+			return fmt.Errorf("deputy: artifact pattern %q is outside the working directory", pattern)
+		}
+	}
+	return nil
+}
+
+// collectArtifacts stores the regular files in dir, or in the current
+// directory if dir is empty, that match the Deputy's CollectArtifacts, and
+// returns a manifest of them, sorted by name.  Symbolic links, and files that
+// are reached through one from outside the directory, are skipped.  A file
+// that fails to be stored doesn't stop the others from being collected.
+func (d Deputy) collectArtifacts(dir string) ([]Artifact, error) {
+	root := dir
+	if root == "" {
+		root = "."
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrArtifact, err)
+	}
+	found := map[string]bool{}
+	for _, pattern := range d.CollectArtifacts {
+		matches, _ := filepath.Glob(filepath.Join(root, filepath.FromSlash(pattern)))
+		for _, m := range matches {
+			if fi, err := os.Lstat(m); err == nil && fi.Mode().IsRegular() && within(realRoot, m) {
+				found[m] = true
+			}
+		}
+	}
+	var arts []Artifact
+	var errs []error
+	paths := make([]string, 0, len(found))
+	for p := range found {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			rel = p
+		}
+		name := filepath.ToSlash(rel)
+		art, err := hashArtifact(name, p)
+		if err == nil {
+			err = d.ArtifactStore.Store(name, p)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%w %s: %v", ErrArtifact, name, err))
+			continue
+		}
+		arts = append(arts, art)
+	}
+	return arts, errors.Join(errs...)
+}
+
+// within reports whether path, once its symbolic links are resolved, is
+// inside the directory realRoot, whose links already have been.
+func within(realRoot, path string) bool {
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(realRoot, real)
+	return err == nil && filepath.IsLocal(rel)
+}
+
+// hashArtifact returns the manifest entry for the file at path, with its size
+// and modification time taken from the file as it was hashed.
+func hashArtifact(name, path string) (Artifact, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Artifact{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return Artifact{}, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return Artifact{}, err
+	}
+	return Artifact{Name: name, Size: n, SHA256: hex.EncodeToString(h.Sum(nil)), ModTime: fi.ModTime()}, nil
+}
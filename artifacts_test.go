@@ -0,0 +1,86 @@
+package deputy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCollectArtifacts(t *testing.T) {
+	work, store := t.TempDir(), t.TempDir()
+	if err := os.Mkdir(filepath.Join(work, "out"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"report.xml", "out/app.bin", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(work, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := maker{exit: 1}.make()
+	cmd.Dir = work
+	d := Deputy{CollectArtifacts: []string{"*.xml", "out/*"}, ArtifactStore: ArtifactDir(store)}
+	res, err := d.RunResult(cmd)
+	if err == nil {
+		t.Fatal("expected the command's error")
+	}
+	var names []string
+	for _, a := range res.Artifacts {
+		names = append(names, a.Name)
+	}
+	if want := []string{"out/app.bin", "report.xml"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("expected artifacts %q, got %q", want, names)
+	}
+	sum := sha256.Sum256([]byte("report.xml"))
+	if a := res.Artifacts[1]; a.Size != 10 || a.SHA256 != hex.EncodeToString(sum[:]) || a.ModTime.IsZero() {
+		t.Fatalf("unexpected manifest entry %+v", a)
+	}
+	b, err := os.ReadFile(filepath.Join(store, "out", "app.bin"))
+	if err != nil || string(b) != "out/app.bin" {
+		t.Fatalf("artifact not copied to the store: %q, %v", b, err)
+	}
+
+	if err := (Deputy{CollectArtifacts: []string{"*"}}).Validate(); err == nil {
+		t.Fatal("expected an error for CollectArtifacts without an ArtifactStore")
+	}
+	if err := (Deputy{CollectArtifacts: []string{"["}, ArtifactStore: ArtifactDir(store)}).Validate(); err == nil {
+		t.Fatal("expected an error for a bad artifact pattern")
+	}
+}
+
+func TestCollectArtifactsLinks(t *testing.T) {
+	work, outside, store := t.TempDir(), t.TempDir(), t.TempDir()
+	secret := filepath.Join(outside, "secret.txt")
+	if err := os.WriteFile(secret, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(work, "report.txt"), []byte("report"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(secret, filepath.Join(work, "link.txt")); err != nil {
+		t.Skipf("can't make symbolic links: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(work, "out")); err != nil {
+		t.Fatal(err)
+	}
+	cmd := maker{}.make()
+	cmd.Dir = work
+	d := Deputy{CollectArtifacts: []string{"*.txt", "out/*"}, ArtifactStore: ArtifactDir(store)}
+	res, err := d.RunResult(cmd)
+	if err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	if len(res.Artifacts) != 1 || res.Artifacts[0].Name != "report.txt" {
+		t.Fatalf("expected only report.txt to be collected, got %+v", res.Artifacts)
+	}
+	if a := res.Artifacts[0]; a.Size != 6 {
+		t.Fatalf("unexpected manifest entry %+v", a)
+	}
+	for _, pattern := range []string{"../*", "/etc/*", "out/../../*"} {
+		if err := (Deputy{CollectArtifacts: []string{pattern}, ArtifactStore: ArtifactDir(store)}).Validate(); err == nil {
+			t.Errorf("expected an error for the pattern %q", pattern)
+		}
+	}
+}
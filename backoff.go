@@ -0,0 +1,60 @@
+package deputy
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff computes how long to wait between attempts at something that may
+// take several tries, such as retrying a command or polling for readiness.
+// The zero Backoff doesn't wait at all.  A Backoff with only Initial set
+// waits a constant time; with Multiplier set as well, each delay is that
+// many times the one before, up to Max.
+type Backoff struct {
+	// Initial is the delay before the second attempt.
+	Initial time.Duration
+	// Multiplier, if greater than one, is how much each delay grows over the
+	// one before.
+	Multiplier float64
+	// Max, if non-zero, caps each delay.
+	Max time.Duration
+	// Jitter, from 0 to 1, is the fraction of each delay that is random, so
+	// that many clients backing off together don't retry in lockstep.  With a
+	// Jitter of 0.5, a delay of one second becomes between half a second and
+	// a second.
+	Jitter float64
+	// MaxElapsed, if non-zero, is how long after the first attempt started
+	// that no more attempts are made.
+	MaxElapsed time.Duration
+}
+
+// Delay returns the delay before the given attempt, counting the first retry
+// as attempt 2.  The first attempt has no delay.
+func (b Backoff) Delay(attempt int) time.Duration {
+	if attempt < 2 || b.Initial <= 0 {
+		return 0
+	}
+	d := float64(b.Initial)
+	if b.Multiplier > 1 {
+		d *= math.Pow(b.Multiplier, float64(attempt-2))
+	}
+	if b.Max > 0 && d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+	if j := math.Min(math.Max(b.Jitter, 0), 1); j > 0 {
+		d -= d * j * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// Next returns the delay before the given attempt, for attempts that began
+// at start, and whether the attempt should be made at all, which it
+// shouldn't if it would begin after MaxElapsed.
+func (b Backoff) Next(attempt int, start time.Time) (time.Duration, bool) {
+	d := b.Delay(attempt)
+	if b.MaxElapsed > 0 && time.Since(start)+d > b.MaxElapsed {
+		return 0, false
+	}
+	return d, true
+}
@@ -0,0 +1,34 @@
+package deputy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := Backoff{Initial: 100 * time.Millisecond, Multiplier: 2, Max: time.Second}
+	want := []time.Duration{0, 0, 100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for attempt, w := range want {
+		if got := b.Delay(attempt); got != w {
+			t.Errorf("expected delay %v before attempt %d, got %v", w, attempt, got)
+		}
+	}
+	if got := (Backoff{Initial: time.Second}).Delay(5); got != time.Second {
+		t.Errorf("expected a constant delay without a Multiplier, got %v", got)
+	}
+
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := b.Delay(3); got < 100*time.Millisecond || got > 200*time.Millisecond {
+			t.Fatalf("expected a jittered delay within half of 200ms, got %v", got)
+		}
+	}
+
+	b = Backoff{Initial: time.Second, MaxElapsed: 1500 * time.Millisecond}
+	if d, ok := b.Next(2, time.Now()); !ok || d != time.Second {
+		t.Fatalf("expected a retry within MaxElapsed, got %v and %v", d, ok)
+	}
+	if _, ok := b.Next(2, time.Now().Add(-time.Second)); ok {
+		t.Fatal("expected no retry past MaxElapsed")
+	}
+}
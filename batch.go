@@ -0,0 +1,285 @@
+package deputy
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrBatchTimeout is wrapped by the error of each command in a Batch that was
+// killed, or never started, because the batch's Timeout expired.  The error of
+// a command that was killed also wraps the error its run returned.
+var ErrBatchTimeout = errors.New("deputy: batch timed out")
+
+// Batch runs a group of commands concurrently.
+type Batch struct {
+	// Deputy runs each command.  Its Timeout, if any, applies to each command
+	// separately.
+	Deputy Deputy
+	// Parallel is the most commands run at the same time.  If it is zero or
+	// less, all of the commands are run at once.
+	Parallel int
+	// Timeout, if non-zero, limits how long the whole batch may take.  When
+	// it expires, commands that are still running are killed and commands
+	// that haven't started yet are skipped.
+	Timeout time.Duration
+	// Ordered, if true, buffers the output of each command and only passes
+	// it to the Deputy's log functions and sinks once the command has
+	// finished and all of the output of the commands before it in the batch
+	// has been passed on, so that the output of each command stays together
+	// and appears in batch order.  In this mode the sinks are opened once
+	// for the whole batch.
+	Ordered bool
+}
+
+// Run runs the commands and waits for all of them to finish.  It returns a
+// Result for each command, in the same order as cmds.  If any of them failed,
+// it also returns a *MultiError describing every failure.  In Ordered mode, an
+// error from the shared sinks is returned too, joined with the MultiError if
+// there is one.
+func (b Batch) Run(cmds ...*exec.Cmd) ([]Result, error) {
+	results := make([]Result, len(cmds))
+	expired := make(chan struct{})
+	if b.Timeout > 0 {
+		t := time.AfterFunc(b.Timeout, func() { close(expired) })
+		defer t.Stop()
+	}
+
+	var out *orderedOutput
+	if b.Ordered {
+		var err error
+		if out, err = newOrderedOutput(b.Deputy, len(cmds)); err != nil {
+			return nil, err
+		}
+	}
+
+	limit := b.Parallel
+	if limit <= 0 || limit > len(cmds) {
+		limit = len(cmds)
+	}
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, cmd := range cmds {
+		acquired := false
+		select {
+		case sem <- struct{}{}:
+			acquired = true
+		case <-expired:
+		}
+		if isClosed(expired) {
+			if acquired {
+				<-sem
+			}
+			results[i] = Result{ExitCode: -1, Err: ErrBatchTimeout}
+			if cmd != nil {
+				results[i].Path, results[i].Args, results[i].Dir = cmd.Path, cmd.Args, cmd.Dir
+			}
+			if out != nil {
+				out.done(i)
+			}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, cmd *exec.Cmd) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			d := b.Deputy
+			if out != nil {
+				d = out.deputy(i)
+				defer out.done(i)
+			}
+			results[i] = run(d, cmd, expired)
+		}(i, cmd)
+	}
+	wg.Wait()
+
+	var outErr error
+	if out != nil {
+		outErr = out.close()
+	}
+	merr := &MultiError{Total: len(cmds)}
+	for i, res := range results {
+		if res.Err != nil {
+			merr.Failures = append(merr.Failures, Failure{Index: i, Result: res})
+		}
+	}
+	if len(merr.Failures) > 0 {
+		if outErr != nil {
+			return results, errors.Join(merr, outErr)
+		}
+		return results, merr
+	}
+	return results, outErr
+}
+
+// run runs a single command of a batch with d, killing it if expired is
+// closed.
+func run(d Deputy, cmd *exec.Cmd, expired <-chan struct{}) Result {
+	cancel, stop := mergeCancel(d.Cancel, expired)
+	defer stop()
+	res, _ := d.RunResult(cmd, WithCancel(cancel))
+	var cerr *CanceledError
+	if isClosed(expired) && errors.As(res.Err, &cerr) {
+		res.Err = fmt.Errorf("%w: %w", ErrBatchTimeout, res.Err)
+	}
+	return res
+}
+
+// orderedOutput buffers the output of each command in a batch and passes it
+// on to the batch Deputy's log functions and sinks in batch order.
+type orderedOutput struct {
+	// shared delivers the buffered lines.
+	shared Deputy
+	// timestamp, elapsed and prefix are the annotations for each command's
+	// lines.
+	timestamp string
+	elapsed   bool
+	prefix    string
+	// quiet is how much of each command's output is held back until it's
+	// known whether the command failed.
+	quiet int
+
+	mu      sync.Mutex
+	buffers [][]Line
+	// finished records which commands are done, and next is the first
+	// command whose output hasn't been delivered yet.
+	finished []bool
+	next     int
+}
+
+func newOrderedOutput(d Deputy, n int) (*orderedOutput, error) {
+	shared := d
+	// lines are annotated and held back as they are read, not when they are
+	// delivered.
+	shared.Timestamp, shared.Elapsed, shared.Prefix, shared.Quiet = "", false, "", 0
+	shared.prepareLogs()
+	if err := shared.sinks.open(); err != nil {
+		return nil, err
+	}
+	return &orderedOutput{
+		shared:    shared,
+		timestamp: d.Timestamp,
+		elapsed:   d.Elapsed,
+		prefix:    d.Prefix,
+		quiet:     d.Quiet,
+		buffers:   make([][]Line, n),
+		finished:  make([]bool, n),
+	}, nil
+}
+
+// deputy returns the Deputy to run command i with, which buffers its output
+// instead of logging it.
+func (o *orderedOutput) deputy(i int) Deputy {
+	d := o.shared
+	d.StdoutLog, d.StderrLog, d.Sinks = nil, nil, nil
+	d.prepared, d.sinks, d.failures, d.quiet = false, nil, nil, nil
+	d.Timestamp, d.Elapsed, d.Prefix, d.Quiet = o.timestamp, o.elapsed, o.prefix, o.quiet
+	d.Log = func(l Line) {
+		o.mu.Lock()
+		o.buffers[i] = append(o.buffers[i], Line{Stream: l.Stream, Text: append([]byte(nil), l.Text...)})
+		o.mu.Unlock()
+	}
+	return d
+}
+
+// done marks command i as finished, and delivers the output of every
+// finished command that is no longer waiting on an earlier one.
+func (o *orderedOutput) done(i int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.finished[i] = true
+	for ; o.next < len(o.finished) && o.finished[o.next]; o.next++ {
+		for _, l := range o.buffers[o.next] {
+			switch {
+			case l.Stream == Stdout && o.shared.StdoutLog != nil:
+				o.shared.StdoutLog(l.Text)
+			case l.Stream == Stderr && o.shared.StderrLog != nil:
+				o.shared.StderrLog(l.Text)
+			}
+		}
+		o.buffers[o.next] = nil
+	}
+}
+
+// close closes the shared sinks and returns any error from them.
+func (o *orderedOutput) close() error {
+	o.shared.sinks.close()
+	return o.shared.failures.result(nil)
+}
+
+// Failure is a failed command in a MultiError.
+type Failure struct {
+	// Index is the position of the command in the batch.
+	Index int
+	// Result is the command's result, with its error in Result.Err.
+	Result Result
+}
+
+// MultiError reports every command that failed in a batch.  It works with
+// errors.Is and errors.As the same way an error from errors.Join does, matching
+// the error of any of the failed commands.
+type MultiError struct {
+	// Failures holds the failed commands, in batch order.
+	Failures []Failure
+	// Total is the number of commands in the batch.
+	Total int
+}
+
+// Error implements error, listing each failed command and its error.
+func (m *MultiError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "deputy: %d of %d commands failed", len(m.Failures), m.Total)
+	for i, f := range m.Failures {
+		sep := "; "
+		if i == 0 {
+			sep = ": "
+		}
+		fmt.Fprintf(&b, "%s[%d] %s: %v", sep, f.Index, Quote(f.Result.Args...), f.Result.Err)
+	}
+	return b.String()
+}
+
+// Unwrap returns the errors of the failed commands.
+func (m *MultiError) Unwrap() []error {
+	errs := make([]error, len(m.Failures))
+	for i, f := range m.Failures {
+		errs[i] = f.Result.Err
+	}
+	return errs
+}
+
+// mergeCancel returns a channel that is closed when either a or b is closed.
+// Call stop to release its resources.
+func mergeCancel(a, b <-chan struct{}) (merged <-chan struct{}, stop func()) {
+	if a == nil {
+		return b, func() {}
+	}
+	if b == nil {
+		return a, func() {}
+	}
+	ch := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-a:
+			close(ch)
+		case <-b:
+			close(ch)
+		case <-done:
+		}
+	}()
+	return ch, func() { close(done) }
+}
+
+// isClosed reports whether ch is closed, without blocking.
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
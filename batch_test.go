@@ -0,0 +1,139 @@
+package deputy
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBatch(t *testing.T) {
+	results, err := Batch{Parallel: 2}.Run(
+		maker{}.make(),
+		maker{exit: 3}.make(),
+		maker{}.make(),
+	)
+	var merr *MultiError
+	if !errors.As(err, &merr) || len(merr.Failures) != 1 || merr.Failures[0].Index != 1 || merr.Total != 3 {
+		t.Fatalf("expected one failure but got %v", err)
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("expected to find the exit error in %v", err)
+	}
+	if !strings.HasPrefix(err.Error(), "deputy: 1 of 3 commands failed: [1] ") {
+		t.Fatalf("unexpected error text %q", err)
+	}
+	for i, want := range []int{0, 3, 0} {
+		if results[i].ExitCode != want {
+			t.Errorf("expected command %d to exit with %d but got %d", i, want, results[i].ExitCode)
+		}
+	}
+}
+
+func TestBatchTimeout(t *testing.T) {
+	start := time.Now()
+	results, err := Batch{
+		Deputy:   Deputy{Timeout: time.Second},
+		Parallel: 2,
+		Timeout:  100 * time.Millisecond,
+	}.Run(
+		maker{timeout: 5 * time.Second}.make(),
+		maker{timeout: 5 * time.Second}.make(),
+		maker{}.make(),
+	)
+	if time.Since(start) > 2*time.Second {
+		t.Fatal("batch was not cut short")
+	}
+	if !errors.Is(err, ErrBatchTimeout) {
+		t.Fatalf("expected batch timeout but got %v", err)
+	}
+	for i, res := range results {
+		if !errors.Is(res.Err, ErrBatchTimeout) {
+			t.Errorf("command %d: unexpected error %v", i, res.Err)
+		}
+	}
+	var cerr *CanceledError
+	if !errors.As(results[0].Err, &cerr) || !cerr.Started {
+		t.Errorf("expected the killed command's error to keep its cancellation, got %v", results[0].Err)
+	}
+	// the third command couldn't start before the deadline.
+	if results[2].Pid != 0 {
+		t.Errorf("expected third command to be skipped, got pid %d", results[2].Pid)
+	}
+}
+
+func TestBatchPerCommandTimeout(t *testing.T) {
+	results, err := Batch{Deputy: Deputy{Timeout: 50 * time.Millisecond}}.Run(
+		maker{timeout: 2 * time.Second}.make(),
+		shellCommand("exit 0"),
+	)
+	if err == nil || errors.Is(err, ErrBatchTimeout) {
+		t.Fatalf("expected command timeout but got %v", err)
+	}
+	if results[1].Err != nil {
+		t.Fatalf("unexpected error for second command: %v", results[1].Err)
+	}
+}
+
+func TestBatchOrdered(t *testing.T) {
+	var lines []string
+	sink := &testSink{}
+	_, err := Batch{
+		Deputy: Deputy{
+			Log:   func(l Line) { lines = append(lines, string(l.Text)) },
+			Sinks: []Sink{sink},
+		},
+		Ordered: true,
+	}.Run(
+		maker{stdout: "first", timeout: 200 * time.Millisecond}.make(),
+		maker{stdout: "second"}.make(),
+		maker{stdout: "third", timeout: 100 * time.Millisecond}.make(),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	want := []string{"first", "second", "third"}
+	if strings.Join(lines, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected lines %q but got %q", want, lines)
+	}
+	if len(sink.lines) != 3 || strings.Join(sink.calls, ",") != "open,flush,close" {
+		t.Fatalf("unexpected sink usage: %q %q", sink.lines, sink.calls)
+	}
+}
+
+func TestBatchOrderedPrefix(t *testing.T) {
+	var lines []string
+	_, err := Batch{
+		Deputy: Deputy{
+			Prefix: "[x] ",
+			Log:    func(l Line) { lines = append(lines, string(l.Text)) },
+		},
+		Ordered: true,
+	}.Run(maker{stdout: "hi"}.make(), maker{stdout: "there"}.make())
+	if err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	if want := []string{"[x] hi", "[x] there"}; strings.Join(lines, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected lines %q but got %q", want, lines)
+	}
+}
+
+func TestBatchOrderedSinkError(t *testing.T) {
+	sinkErr := errors.New("disk full")
+	_, err := Batch{
+		Deputy:  Deputy{Sinks: []Sink{&testSink{writeErr: sinkErr}}},
+		Ordered: true,
+	}.Run(
+		maker{stdout: "first"}.make(),
+		maker{exit: 1}.make(),
+	)
+	var merr *MultiError
+	if !errors.As(err, &merr) || len(merr.Failures) != 1 {
+		t.Fatalf("expected the failed command to be reported, got %v", err)
+	}
+	if !errors.Is(err, sinkErr) {
+		t.Fatalf("expected the sink error to be reported, got %v", err)
+	}
+}
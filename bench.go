@@ -0,0 +1,102 @@
+package deputy
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+// Bench runs a command repeatedly to measure how long it takes, in the manner
+// of hyperfine.
+type Bench struct {
+	// Deputy runs each command.
+	Deputy Deputy
+	// Warmup is how many times to run the command before the runs that are
+	// measured, for instance to fill caches.  Their results are discarded.
+	Warmup int
+	// Delay is how long to wait between runs.
+	Delay time.Duration
+}
+
+// RunN runs the command described by spec n times, one after another, after
+// the warmup runs, with opts applied to the Deputy for every run.  If a run
+// fails, RunN stops and returns its error, along with the timing of the runs
+// up to and including it.
+func (b Bench) RunN(spec Spec, n int, opts ...Option) (*Timing, error) {
+	if n <= 0 {
+		return nil, errors.New("deputy: RunN needs at least one run")
+	}
+	d := b.Deputy.With(opts...)
+	for i := 0; i < b.Warmup; i++ {
+		if i > 0 {
+			time.Sleep(b.Delay)
+		}
+		if err := d.Run(spec.Command()); err != nil {
+			return nil, err
+		}
+	}
+	results := make([]Result, 0, n)
+	for i := 0; i < n; i++ {
+		if i > 0 || b.Warmup > 0 {
+			time.Sleep(b.Delay)
+		}
+		res, err := d.RunResult(spec.Command())
+		results = append(results, res)
+		if err != nil {
+			return newTiming(results), err
+		}
+	}
+	return newTiming(results), nil
+}
+
+// Timing holds the results of running a command several times, and
+// statistics about how long the runs took.
+type Timing struct {
+	// Results are the results of the runs, in the order they were run.
+	Results []Result
+	// Min and Max are the shortest and longest durations of the runs.
+	Min, Max time.Duration
+	// Mean is the average duration of the runs.
+	Mean time.Duration
+	// StdDev is the standard deviation of the durations of the runs.
+	StdDev time.Duration
+
+	// sorted are the durations of the runs, shortest first.
+	sorted []time.Duration
+}
+
+// newTiming returns the Timing of the given results, of which there must be
+// at least one.
+func newTiming(results []Result) *Timing {
+	t := &Timing{Results: results, sorted: make([]time.Duration, len(results))}
+	var sum float64
+	for i, r := range results {
+		t.sorted[i] = r.Duration
+		sum += float64(r.Duration)
+	}
+	sort.Slice(t.sorted, func(i, j int) bool { return t.sorted[i] < t.sorted[j] })
+	t.Min, t.Max = t.sorted[0], t.sorted[len(t.sorted)-1]
+	mean := sum / float64(len(results))
+	var squares float64
+	for _, d := range t.sorted {
+		squares += (float64(d) - mean) * (float64(d) - mean)
+	}
+	t.Mean = time.Duration(mean)
+	t.StdDev = time.Duration(math.Sqrt(squares / float64(len(results))))
+	return t
+}
+
+// Percentile returns the duration that p percent of the runs took no longer
+// than, using the nearest-rank method.  For instance, Percentile(50) is the
+// median.
+func (t *Timing) Percentile(p float64) time.Duration {
+	if p <= 0 {
+		return t.Min
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(t.sorted))))
+	if rank > len(t.sorted) {
+		rank = len(t.sorted)
+	}
+	return t.sorted[rank-1]
+}
@@ -0,0 +1,70 @@
+package deputy
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestBenchRunN(t *testing.T) {
+	var runs int
+	d := Deputy{Defer: []func(Result){func(Result) { runs++ }}}
+	spec := Spec{Name: os.Args[0], Args: []string{"-test.run=TestHelperProcess"}, Env: maker{timeout: 10 * time.Millisecond}.make().Env}
+	timing, err := Bench{Deputy: d, Warmup: 2}.RunN(spec, 5)
+	if err != nil {
+		t.Fatalf("unexpected error returned from RunN: %v", err)
+	}
+	if runs != 7 || len(timing.Results) != 5 {
+		t.Fatalf("expected 2 warmup and 5 measured runs, got %d runs and %d results", runs, len(timing.Results))
+	}
+	if timing.Min < 10*time.Millisecond || timing.Min > timing.Mean || timing.Mean > timing.Max {
+		t.Fatalf("unexpected timing %+v", timing)
+	}
+	if p := timing.Percentile(50); p < timing.Min || p > timing.Max {
+		t.Fatalf("median %v outside of %v to %v", p, timing.Min, timing.Max)
+	}
+	if timing.Percentile(100) != timing.Max || timing.Percentile(0) != timing.Min {
+		t.Fatal("expected the extreme percentiles to be the min and max")
+	}
+
+	spec.Env = maker{exit: 1}.make().Env
+	timing, err = Bench{Deputy: d}.RunN(spec, 5)
+	if err == nil || len(timing.Results) != 1 {
+		t.Fatalf("expected RunN to stop at the failed run, got %v", err)
+	}
+}
+
+// slowSink takes a while to close, like a sink uploading what it was given.
+type slowSink struct {
+	testSink
+	delay time.Duration
+}
+
+func (s *slowSink) Close() error {
+	time.Sleep(s.delay)
+	return nil
+}
+
+func TestBenchExcludesDeputyWork(t *testing.T) {
+	d := Deputy{
+		WatchFiles:       t.TempDir(),
+		CollectArtifacts: []string{"*.none"},
+		ArtifactStore:    ArtifactDir(t.TempDir()),
+		Sinks:            []Sink{&slowSink{delay: 200 * time.Millisecond}},
+	}
+	spec := Spec{Name: os.Args[0], Args: []string{"-test.run=TestHelperProcess"}, Env: maker{}.make().Env}
+	start := time.Now()
+	timing, err := Bench{Deputy: d}.RunN(spec, 3)
+	if err != nil {
+		t.Fatalf("unexpected error returned from RunN: %v", err)
+	}
+	elapsed := time.Since(start)
+	if elapsed < 600*time.Millisecond {
+		t.Fatal("expected the sink to slow down each run")
+	}
+	// the sink's 600ms is in the elapsed time, but shouldn't be in the
+	// runs' durations; half of it is left as slack for the runs' overhead.
+	if timed := 3 * timing.Mean; timed > elapsed-300*time.Millisecond {
+		t.Fatalf("expected the work done after each command exited not to be timed, got %v of %v", timed, elapsed)
+	}
+}
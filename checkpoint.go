@@ -0,0 +1,39 @@
+package deputy
+
+// Checkpoint is how much of a command's output a sink has stored durably, so
+// that a command that streams output can be restarted from there after a
+// failure, rather than from the start.
+type Checkpoint struct {
+	// Lines is the number of lines stored.
+	Lines int64 `json:"lines"`
+	// Bytes is the number of bytes stored, not counting the newlines the
+	// lines were split on, unless the sink stores them.
+	Bytes int64 `json:"bytes"`
+}
+
+// CheckpointSink is a Sink that reports how much output it has stored
+// durably.  What it counts from is up to the sink: a sink used by a Retry
+// that resumes a command will usually count from the start of the first
+// attempt, so that its Checkpoint is an offset into the whole output.
+type CheckpointSink interface {
+	Sink
+	// Checkpoint returns how much output the sink has stored durably.  It
+	// is called after Flush at the end of each run.
+	Checkpoint() Checkpoint
+}
+
+// recordCheckpoint records cp as the run's checkpoint, if it is behind any
+// recorded already, since output is only stored durably once every sink has
+// stored it.
+func (s *sinkSet) recordCheckpoint(cp Checkpoint) {
+	if s.checkpoint == nil {
+		s.checkpoint = &cp
+		return
+	}
+	if cp.Lines < s.checkpoint.Lines {
+		s.checkpoint.Lines = cp.Lines
+	}
+	if cp.Bytes < s.checkpoint.Bytes {
+		s.checkpoint.Bytes = cp.Bytes
+	}
+}
@@ -0,0 +1,80 @@
+package deputy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrChecksum is wrapped by the error returned from Run when a program listed
+// in a Deputy's VerifyChecksum doesn't match its expected checksum.
+var ErrChecksum = errors.New("deputy: checksum mismatch")
+
+// verifyChecksum reports an error if the program at path is listed in the
+// Deputy's VerifyChecksum and its contents don't match.
+func (d Deputy) verifyChecksum(path string) error {
+	if len(d.VerifyChecksum) == 0 {
+		return nil
+	}
+	want, ok := d.expectedChecksum(path)
+	if !ok {
+		return nil
+	}
+	got, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(got, want) {
+		return fmt.Errorf("%w: %s has SHA-256 %s, expected %s", ErrChecksum, path, got, want)
+	}
+	return nil
+}
+
+// expectedChecksum returns the checksum in VerifyChecksum for the program at
+// path.  An entry matches if it names the same file as path, once an entry
+// without a directory has been looked up as the command's name would be.
+func (d Deputy) expectedChecksum(path string) (string, bool) {
+	if sum, ok := d.VerifyChecksum[path]; ok {
+		return sum, true
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", false
+	}
+	for p, sum := range d.VerifyChecksum {
+		if filepath.Clean(p) == filepath.Clean(path) {
+			return sum, true
+		}
+		if !strings.ContainsAny(p, `/\`) {
+			found, err := d.lookPath(p)
+			if err != nil {
+				continue
+			}
+			p = found
+		}
+		if pfi, err := os.Stat(p); err == nil && os.SameFile(fi, pfi) {
+			return sum, true
+		}
+	}
+	return "", false
+}
+
+// fileSHA256 returns the hex encoded SHA-256 of the contents of the file at
+// path.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,49 @@
+package deputy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyChecksum(t *testing.T) {
+	sum, err := fileSHA256(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := maker{}.make()
+	err = Deputy{VerifyChecksum: map[string]string{cmd.Path: sum}}.Run(cmd)
+	if err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+
+	cmd = maker{}.make()
+	bad := "0000000000000000000000000000000000000000000000000000000000000000"
+	err = Deputy{VerifyChecksum: map[string]string{cmd.Path: bad}}.Run(cmd)
+	if !errors.Is(err, ErrChecksum) {
+		t.Fatalf("expected checksum error but got %v", err)
+	}
+	if cmd.Process != nil {
+		t.Fatal("command was started despite a bad checksum")
+	}
+}
+
+func TestVerifyChecksumOtherPath(t *testing.T) {
+	dir := t.TempDir()
+	link := filepath.Join(dir, "helper")
+	if err := os.Symlink(os.Args[0], link); err != nil {
+		t.Skipf("can't make symbolic links: %v", err)
+	}
+	bad := "0000000000000000000000000000000000000000000000000000000000000000"
+	for _, name := range []string{link, "helper"} {
+		d := Deputy{
+			VerifyChecksum: map[string]string{name: bad},
+			LookPath:       (&PathCache{Path: dir}).LookPath,
+		}
+		cmd := maker{}.make()
+		if err := d.Run(cmd); !errors.Is(err, ErrChecksum) {
+			t.Errorf("expected the entry %q to be checked, got %v", name, err)
+		}
+	}
+}
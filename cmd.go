@@ -0,0 +1,242 @@
+package deputy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// CombinedOutput runs the command and returns its standard output and
+// standard error together, like cmd.CombinedOutput.  As with Run, opts apply
+// to this call only.  If the Deputy logs either stream, the lines it logs are
+// also collected into the returned output.
+func (d Deputy) CombinedOutput(cmd *exec.Cmd, opts ...Option) ([]byte, error) {
+	d = d.With(opts...)
+	d.prepareLogs()
+	if cmd != nil && cmd.Stdout != nil {
+		return nil, errors.New("deputy: Stdout already set")
+	}
+	if cmd != nil && cmd.Stderr != nil {
+		return nil, errors.New("deputy: Stderr already set")
+	}
+	out := &lockedBuffer{}
+	if d.StdoutLog != nil {
+		d.StdoutLog = joinLogs(out.writeLine, d.StdoutLog)
+	} else if cmd != nil {
+		cmd.Stdout = out
+	}
+	if d.StderrLog != nil {
+		d.StderrLog = joinLogs(out.writeLine, d.StderrLog)
+	} else if cmd != nil {
+		cmd.Stderr = out
+	}
+	err := d.Run(cmd)
+	return out.Bytes(), err
+}
+
+// lockedBuffer is a bytes.Buffer that can be written to from several
+// goroutines.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// Write implements io.Writer.
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// writeLine writes a line and a newline, as a log function.
+func (b *lockedBuffer) writeLine(line []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Write(line)
+	b.buf.WriteByte('\n')
+}
+
+// Bytes returns the contents of the buffer.
+func (b *lockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Bytes()
+}
+
+// Cmd is a command run by a Deputy, with the same methods as exec.Cmd, so that
+// it can stand in for an exec.Cmd behind an interface.  The embedded exec.Cmd
+// may be configured as usual before the command is started.
+type Cmd struct {
+	*exec.Cmd
+	d Deputy
+
+	// detach cuts the command's output off from d once DetachOutput is
+	// called.
+	detach *outputDetach
+	// done is closed once the run is over, after err is set.
+	done     chan struct{}
+	err      error
+	waitOnce sync.Once
+	waited   bool
+}
+
+// Command returns a Cmd that runs cmd with the Deputy, with opts applied.
+func (d Deputy) Command(cmd *exec.Cmd, opts ...Option) *Cmd {
+	return &Cmd{Cmd: cmd, d: d.With(opts...), detach: &outputDetach{}}
+}
+
+// Start starts the command with the Deputy, with opts applied, and returns a
+// Cmd to wait for it with.  Errors from before the command is started, such as
+// from Validate or a Policy, are returned from Start.
+func (d Deputy) Start(cmd *exec.Cmd, opts ...Option) (*Cmd, error) {
+	c := d.Command(cmd, opts...)
+	if err := c.Start(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Run runs the command and waits for it, as Deputy.Run does.
+func (c *Cmd) Run() error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	return c.Wait()
+}
+
+// Start starts the command, running it the way Deputy.Run does, without
+// waiting for it to finish.  The Deputy's Timeout starts counting now.
+func (c *Cmd) Start() error {
+	if c.done != nil {
+		return errors.New("deputy: already started")
+	}
+	c.done = make(chan struct{})
+	if c.detach == nil {
+		c.detach = &outputDetach{}
+	}
+	started := make(chan struct{})
+	d := c.d
+	d.started = func() { close(started) }
+	d.detach = c.detach
+	go func() {
+		c.err = d.Run(c.Cmd)
+		close(c.done)
+	}()
+	select {
+	case <-started:
+		return nil
+	case <-c.done:
+		c.waited = true
+		return c.err
+	}
+}
+
+// Wait waits for the command to finish, and returns the error Deputy.Run
+// would have.  It may only be called once, after Start succeeds.
+func (c *Cmd) Wait() error {
+	if c.done == nil {
+		return errors.New("deputy: not started")
+	}
+	err := errors.New("deputy: Wait was already called")
+	c.waitOnce.Do(func() {
+		if !c.waited {
+			<-c.done
+			err = c.err
+		}
+	})
+	return err
+}
+
+// DetachOutput stops the Deputy from handling the command's output, without
+// stopping the command, for when the caller has seen what it needed, such as
+// a sign that the command is ready.  From then on, the output that would have
+// been logged, sent to sinks, or written to the command's Stdout and Stderr
+// writers is written to w instead, or discarded if w is nil, and no more is
+// logged once DetachOutput returns.  Output written straight to an *os.File
+// by the command itself can't be detached.  Called before Start, it keeps the
+// Deputy from handling the output at all.  It must not be called from the
+// Deputy's own log functions or sinks.
+func (c *Cmd) DetachOutput(w io.Writer) {
+	c.detach.mu.Lock()
+	defer c.detach.mu.Unlock()
+	c.detach.detached, c.detach.w = true, w
+}
+
+// outputDetach switches a command's output away from the Deputy running it.
+type outputDetach struct {
+	// mu is held for reading while output is handled, so that once
+	// detached is set, no more output reaches the Deputy.
+	mu       sync.RWMutex
+	detached bool
+	w        io.Writer
+}
+
+// wrap routes the output d reads from cmd, and the output cmd's writers
+// receive, through o.
+func (o *outputDetach) wrap(d *Deputy, cmd *exec.Cmd) {
+	if d.stdoutPipe != nil {
+		d.StdoutLog = o.log(d.StdoutLog)
+	} else if _, ok := cmd.Stdout.(*os.File); !ok && cmd.Stdout != nil {
+		cmd.Stdout = o.writer(cmd.Stdout)
+	}
+	if d.stderrPipe != nil {
+		d.StderrLog = o.log(d.StderrLog)
+	} else if _, ok := cmd.Stderr.(*os.File); !ok && cmd.Stderr != nil {
+		cmd.Stderr = o.writer(cmd.Stderr)
+	}
+}
+
+// log returns a log function that passes lines to log until the output is
+// detached.
+func (o *outputDetach) log(log func([]byte)) func([]byte) {
+	return func(b []byte) {
+		o.mu.RLock()
+		defer o.mu.RUnlock()
+		if !o.detached {
+			log(b)
+			return
+		}
+		if o.w != nil {
+			_, _ = o.w.Write(b)
+			_, _ = o.w.Write([]byte{'\n'})
+		}
+	}
+}
+
+// writer returns a writer that writes to w until the output is detached.
+func (o *outputDetach) writer(w io.Writer) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		o.mu.RLock()
+		defer o.mu.RUnlock()
+		switch {
+		case !o.detached:
+			return w.Write(p)
+		case o.w != nil:
+			_, _ = o.w.Write(p)
+		}
+		return len(p), nil
+	})
+}
+
+// writerFunc adapts a function to an io.Writer.
+type writerFunc func(p []byte) (int, error)
+
+// Write implements io.Writer.
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// Output runs the command and returns its standard output, as Deputy.Output
+// does.
+func (c *Cmd) Output() ([]byte, error) {
+	return c.d.Output(c.Cmd)
+}
+
+// CombinedOutput runs the command and returns its standard output and
+// standard error together, as Deputy.CombinedOutput does.
+func (c *Cmd) CombinedOutput() ([]byte, error) {
+	return c.d.CombinedOutput(c.Cmd)
+}
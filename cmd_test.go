@@ -0,0 +1,96 @@
+package deputy
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// execCmd is the part of exec.Cmd's method set that Cmd stands in for.
+type execCmd interface {
+	Run() error
+	Start() error
+	Wait() error
+	Output() ([]byte, error)
+	CombinedOutput() ([]byte, error)
+}
+
+var _ execCmd = (*Cmd)(nil)
+
+func TestCombinedOutput(t *testing.T) {
+	out, err := Deputy{}.CombinedOutput(maker{stdout: "out", stderr: "err"}.make())
+	if err != nil {
+		t.Fatalf("unexpected error returned from CombinedOutput: %v", err)
+	}
+	if string(out) != "errout" {
+		t.Fatalf("expected both streams, got %q", out)
+	}
+	var logged []string
+	d := Deputy{StderrLog: func(b []byte) { logged = append(logged, string(b)) }}
+	out, err = d.CombinedOutput(maker{stdout: "out", stderr: "err"}.make())
+	if err != nil {
+		t.Fatalf("unexpected error returned from CombinedOutput: %v", err)
+	}
+	if !strings.Contains(string(out), "out") || !strings.Contains(string(out), "err\n") || len(logged) != 1 {
+		t.Fatalf("expected both streams, with stderr logged too, got %q and %q", out, logged)
+	}
+}
+
+func TestStartWait(t *testing.T) {
+	cmd := maker{timeout: 100 * time.Millisecond, exit: 2}.make()
+	c, err := Deputy{}.Start(cmd)
+	if err != nil {
+		t.Fatalf("unexpected error returned from Start: %v", err)
+	}
+	if c.Process == nil {
+		t.Fatal("expected the process to be started")
+	}
+	if err := c.Wait(); err == nil || c.ProcessState.ExitCode() != 2 {
+		t.Fatalf("expected the command's error from Wait, got %v", err)
+	}
+	if err := c.Wait(); err == nil {
+		t.Fatal("expected an error calling Wait twice")
+	}
+
+	_, err = Deputy{Policy: Denylist{cmd.Path}}.Start(maker{}.make())
+	if !errors.Is(err, ErrPolicy) {
+		t.Fatalf("expected the policy error from Start, got %v", err)
+	}
+	if err := (Deputy{}).Command(maker{}.make()).Run(); err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+}
+
+func TestDetachOutput(t *testing.T) {
+	cmd := maker{stdout: "late", timeout: 200 * time.Millisecond}.make()
+	cmd.Env = append(cmd.Env, helperEarlyStdout+"=early")
+	lines := make(chan string, 2)
+	c, err := Deputy{StdoutLog: func(b []byte) { lines <- string(b) }}.Start(cmd)
+	if err != nil {
+		t.Fatalf("unexpected error returned from Start: %v", err)
+	}
+	if line := <-lines; line != "early" {
+		t.Fatalf("expected the early line to be logged, got %q", line)
+	}
+	var rest bytes.Buffer
+	c.DetachOutput(&rest)
+	if err := c.Wait(); err != nil {
+		t.Fatalf("expected the detached command to finish, got %v", err)
+	}
+	if len(lines) != 0 || rest.String() != "late\n" {
+		t.Fatalf("expected the later output to go to the detached writer, got %d lines and %q", len(lines), rest.String())
+	}
+
+	var logged []string
+	c = Deputy{StdoutLog: func(b []byte) { logged = append(logged, string(b)) }}.Command(maker{stdout: "all"}.make())
+	rest.Reset()
+	c.DetachOutput(&rest)
+	if err := c.Run(); err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	if len(logged) != 0 || rest.String() != "all\n" {
+		t.Fatalf("expected output detached before Start to skip the Deputy, got %q and %q", logged, rest.String())
+	}
+}
@@ -0,0 +1,68 @@
+package deputy
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+)
+
+// ContextSink is a Sink that wants the context of the run it is opened for,
+// so that request-scoped values, such as trace ids, can be attached to what
+// it writes.  When a Deputy opens a ContextSink, it calls OpenContext
+// instead of Open, with the context given to RunContext, or
+// context.Background for the other ways of running a command.
+type ContextSink interface {
+	Sink
+	// OpenContext prepares the sink to receive lines for a run with the
+	// given context.  If it returns an error, the command is not run.
+	OpenContext(ctx context.Context) error
+}
+
+// ContextPolicy is a Policy that wants the context of the run it is checking.
+// When a Deputy's Policy is a ContextPolicy, it calls CheckContext instead of
+// Check, with the context given to RunContext, or context.Background for the
+// other ways of running a command.
+type ContextPolicy interface {
+	Policy
+	// CheckContext returns a non-nil error if the program at path may not be
+	// run with the given arguments and environment, as Check does.
+	CheckContext(ctx context.Context, path string, args, env []string) error
+}
+
+// RunContext runs cmd as Run does, with ctx acting as another Cancel: the
+// command is stopped once ctx is done.  If it is stopped because ctx's
+// deadline passed, the error is a *TimeoutError rather than a
+// *CanceledError.  ctx is also passed to the Deputy's
+// sinks that are ContextSinks and to its Policy if it is a ContextPolicy.  If
+// the current process was given a deadline in DeadlineEnv, the Deputy's
+// Timeout is shortened so that the command is stopped by then.
+func (d Deputy) RunContext(ctx context.Context, cmd *exec.Cmd, opts ...Option) error {
+	d = d.With(opts...)
+	if deadline, ok := inheritedDeadline(); ok {
+		d.limitTimeout(deadline)
+	}
+	cancel, stop := mergeCancel(d.Cancel, ctx.Done())
+	defer stop()
+	d.Cancel = cancel
+	d.ctx = ctx
+	return d.Run(cmd)
+}
+
+// context returns the context of the run.
+func (d Deputy) context() context.Context {
+	if d.ctx == nil {
+		return context.Background()
+	}
+	return d.ctx
+}
+
+// canceled returns the error for a run stopped because the Deputy's Cancel was
+// closed: a *TimeoutError if the deadline of the run's context is what closed
+// it, and a *CanceledError otherwise.
+func (d Deputy) canceled(started bool) error {
+	if d.ctx != nil && errors.Is(d.ctx.Err(), context.DeadlineExceeded) {
+		deadline, _ := d.ctx.Deadline()
+		return &TimeoutError{Deadline: deadline}
+	}
+	return &CanceledError{Started: started}
+}
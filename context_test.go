@@ -0,0 +1,100 @@
+package deputy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+type ctxKey struct{}
+
+// ctxSink records the value in the context it is opened with.
+type ctxSink struct {
+	writerSink
+	value interface{}
+}
+
+func (s *ctxSink) OpenContext(ctx context.Context) error {
+	s.value = ctx.Value(ctxKey{})
+	return nil
+}
+
+// ctxPolicy records the value in the context it checks with.
+type ctxPolicy struct {
+	value interface{}
+}
+
+func (p *ctxPolicy) Check(path string, args, env []string) error { return nil }
+
+func (p *ctxPolicy) CheckContext(ctx context.Context, path string, args, env []string) error {
+	p.value = ctx.Value(ctxKey{})
+	return nil
+}
+
+func TestRunContext(t *testing.T) {
+	ctx := context.WithValue(context.Background(), ctxKey{}, "trace-1")
+	sink := &ctxSink{writerSink: writerSink{w: io.Discard}}
+	policy := &ctxPolicy{}
+	d := Deputy{Sinks: []Sink{sink}, Policy: policy}
+	if err := d.RunContext(ctx, maker{stdout: "hi"}.make()); err != nil {
+		t.Fatalf("unexpected error returned from RunContext: %v", err)
+	}
+	if sink.value != "trace-1" || policy.value != "trace-1" {
+		t.Fatalf("expected the context to reach the sink and policy, got %v and %v", sink.value, policy.value)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	err := d.RunContext(ctx, maker{timeout: 5 * time.Second}.make())
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the command to be canceled, got %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatal("command wasn't stopped when its context was canceled")
+	}
+}
+
+func TestRunContextDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := Deputy{}.RunContext(ctx, maker{timeout: 5 * time.Second}.make())
+	var te *TimeoutError
+	if !errors.As(err, &te) || te.Deadline.IsZero() || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the command to time out, got %v", err)
+	}
+	if errors.Is(err, context.Canceled) {
+		t.Fatal("a deadline was reported as a cancel")
+	}
+	err = Deputy{}.RunContext(ctx, maker{}.make())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a command started after the deadline to time out, got %v", err)
+	}
+}
+
+func TestDeadlineEnv(t *testing.T) {
+	cmd := maker{}.make()
+	if err := (Deputy{Timeout: time.Hour, PassDeadline: true}).Run(cmd); err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	var passed string
+	for _, kv := range cmd.Env {
+		if strings.HasPrefix(kv, DeadlineEnv+"=") {
+			passed = strings.TrimPrefix(kv, DeadlineEnv+"=")
+		}
+	}
+	deadline, err := time.Parse(time.RFC3339Nano, passed)
+	if err != nil || time.Until(deadline) < 59*time.Minute || time.Until(deadline) > time.Hour {
+		t.Fatalf("expected a deadline an hour away, got %q", passed)
+	}
+
+	t.Setenv(DeadlineEnv, time.Now().Add(100*time.Millisecond).Format(time.RFC3339Nano))
+	err = (Deputy{Timeout: time.Hour}).RunContext(context.Background(), maker{timeout: 10 * time.Second}.make())
+	var te *TimeoutError
+	if !errors.As(err, &te) || te.Timeout > 100*time.Millisecond {
+		t.Fatalf("expected the inherited deadline to shorten the Timeout, got %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package deputy
+
+import (
+	"os/exec"
+	"sync"
+	"sync/atomic"
+)
+
+// OutputCount is how much output a command wrote to a stream.
+type OutputCount struct {
+	// Lines is the number of lines, counting a final line without a
+	// newline.
+	Lines int64 `json:"lines"`
+	// Bytes is the number of bytes, counting a newline after every line,
+	// including a final line without one.
+	Bytes int64 `json:"bytes"`
+}
+
+// outputCounter counts the lines of a stream.  Its counts are accessed
+// atomically, since a stream given up on by reap may still be counting when
+// the run finishes.
+type outputCounter struct {
+	stream       Stream
+	lines, bytes int64
+	threshold    OutputCount
+	onThreshold  func(Stream, OutputCount)
+	once         sync.Once
+}
+
+// log counts a line, and calls onThreshold the first time the counts exceed
+// the threshold.
+func (c *outputCounter) log(b []byte) {
+	n := OutputCount{
+		Lines: atomic.AddInt64(&c.lines, 1),
+		Bytes: atomic.AddInt64(&c.bytes, int64(len(b))+1),
+	}
+	if c.onThreshold == nil {
+		return
+	}
+	if c.threshold.Lines > 0 && n.Lines > c.threshold.Lines || c.threshold.Bytes > 0 && n.Bytes > c.threshold.Bytes {
+		c.once.Do(func() { c.onThreshold(c.stream, n) })
+	}
+}
+
+// count returns the counts so far.
+func (c *outputCounter) count() OutputCount {
+	return OutputCount{Lines: atomic.LoadInt64(&c.lines), Bytes: atomic.LoadInt64(&c.bytes)}
+}
+
+// countOutput arranges for the lines of both streams to be counted, through
+// the Deputy's log functions where it has them and by teeing the command's
+// writers otherwise.  It returns a function to call once the command is
+// done, which records the counts in the Result.
+func (d *Deputy) countOutput(cmd *exec.Cmd) (finish func()) {
+	stdout := &outputCounter{stream: Stdout, threshold: d.OutputThreshold, onThreshold: d.OnThreshold}
+	stderr := &outputCounter{stream: Stderr, threshold: d.OutputThreshold, onThreshold: d.OnThreshold}
+	var writers []*lineWriter
+	if d.StdoutLog != nil {
+		d.StdoutLog = joinLogs(d.StdoutLog, stdout.log)
+	} else {
+		w := &lineWriter{log: stdout.log}
+		cmd.Stdout = dualWriter(cmd.Stdout, w)
+		writers = append(writers, w)
+	}
+	if d.StderrLog != nil {
+		d.StderrLog = joinLogs(d.StderrLog, stderr.log)
+	} else {
+		w := &lineWriter{log: stderr.log}
+		cmd.Stderr = dualWriter(cmd.Stderr, w)
+		writers = append(writers, w)
+	}
+	return func() {
+		for _, w := range writers {
+			w.flush()
+		}
+		d.result.StdoutCount = stdout.count()
+		d.result.StderrCount = stderr.count()
+	}
+}
@@ -0,0 +1,35 @@
+package deputy
+
+import (
+	"testing"
+)
+
+func TestCountOutput(t *testing.T) {
+	res, err := Deputy{CountOutput: true}.RunResult(maker{stdout: "one\ntwo\nthree", stderr: "err\n"}.make())
+	if err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	if want := (OutputCount{Lines: 3, Bytes: 14}); res.StdoutCount != want {
+		t.Fatalf("expected stdout count %+v, got %+v", want, res.StdoutCount)
+	}
+	if want := (OutputCount{Lines: 1, Bytes: 4}); res.StderrCount != want {
+		t.Fatalf("expected stderr count %+v, got %+v", want, res.StderrCount)
+	}
+
+	var calls []OutputCount
+	d := Deputy{
+		StdoutLog:       func([]byte) {},
+		OutputThreshold: OutputCount{Lines: 1},
+		OnThreshold: func(s Stream, n OutputCount) {
+			if s == Stdout {
+				calls = append(calls, n)
+			}
+		},
+	}
+	if err := d.Run(maker{stdout: "one\ntwo\nthree"}.make()); err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	if len(calls) != 1 || calls[0].Lines != 2 {
+		t.Fatalf("expected one call once the second line was written, got %+v", calls)
+	}
+}
@@ -0,0 +1,58 @@
+package deputy
+
+import (
+	"os"
+	"os/exec"
+	"time"
+)
+
+// DeadlineEnv is the environment variable in which a Deputy with PassDeadline
+// set tells the command when it must finish by, as a time in RFC 3339 format.
+// RunContext reads it from the environment of the current process, so that
+// when a Go program run by a Deputy runs commands of its own, they get no
+// more than the time the program has left, rather than their full Timeout.
+const DeadlineEnv = "DEPUTY_DEADLINE"
+
+// inheritedDeadline returns the deadline the current process was given in
+// DeadlineEnv, if any.
+func inheritedDeadline() (time.Time, bool) {
+	s := os.Getenv(DeadlineEnv)
+	if s == "" {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// limitTimeout shortens the Deputy's Timeout so that the command is stopped
+// by deadline.
+func (d *Deputy) limitTimeout(deadline time.Time) {
+	left := time.Until(deadline)
+	if left <= 0 {
+		// the deadline has passed, so stop the command right away.
+		left = time.Nanosecond
+	}
+	if d.Timeout == 0 || left < d.Timeout {
+		d.Timeout = left
+	}
+}
+
+// passDeadline sets DeadlineEnv in the command's environment to the earlier
+// of the end of the Deputy's Timeout and the deadline of the run's context,
+// if there is either.
+func (d Deputy) passDeadline(cmd *exec.Cmd) {
+	var deadline time.Time
+	if d.Timeout > 0 {
+		deadline = time.Now().Add(d.Timeout)
+	}
+	if dl, ok := d.context().Deadline(); ok && (deadline.IsZero() || dl.Before(deadline)) {
+		deadline = dl
+	}
+	if deadline.IsZero() {
+		return
+	}
+	setEnv(cmd, DeadlineEnv, deadline.UTC().Format(time.RFC3339Nano))
+}
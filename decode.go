@@ -0,0 +1,63 @@
+package deputy
+
+import (
+	"bufio"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// decodeUTF16 returns a reader of r's contents as UTF-8.  If r starts with a
+// UTF-16LE byte order mark, as the output of some windows commands does, the
+// rest of it is decoded from UTF-16LE; otherwise it is read as it is.
+func decodeUTF16(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	if b, err := br.Peek(2); err == nil && b[0] == 0xFF && b[1] == 0xFE {
+		_, _ = br.Discard(2)
+		return &utf16Reader{r: br}
+	}
+	return br
+}
+
+// utf16Reader decodes UTF-16LE read from r to UTF-8.
+type utf16Reader struct {
+	r   io.Reader
+	err error
+	// in holds n bytes read from r that haven't been decoded yet: an odd
+	// byte, or the first half of a surrogate pair.
+	in  [4096]byte
+	n   int
+	out []byte
+}
+
+// Read implements io.Reader.
+func (u *utf16Reader) Read(p []byte) (int, error) {
+	for len(u.out) == 0 {
+		if u.err != nil {
+			return 0, u.err
+		}
+		n, err := u.r.Read(u.in[u.n:])
+		u.n += n
+		u.err = err
+		units := make([]uint16, u.n/2)
+		for i := range units {
+			units[i] = uint16(u.in[2*i]) | uint16(u.in[2*i+1])<<8
+		}
+		// the second half of a surrogate pair may not have been read yet.
+		if len(units) > 0 && err == nil && 0xD800 <= units[len(units)-1] && units[len(units)-1] < 0xDC00 {
+			units = units[:len(units)-1]
+		}
+		u.out = u.out[:0]
+		for _, r := range utf16.Decode(units) {
+			u.out = utf8.AppendRune(u.out, r)
+		}
+		u.n = copy(u.in[:], u.in[2*len(units):u.n])
+		if err != nil && u.n > 0 {
+			u.out = utf8.AppendRune(u.out, utf8.RuneError)
+			u.n = 0
+		}
+	}
+	n := copy(p, u.out)
+	u.out = u.out[n:]
+	return n, nil
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package deputy
+
+import "io"
+
+// decodeOutput returns r and log as they are, since output is expected to
+// be UTF-8 already.
+func decodeOutput(r io.Reader, log func([]byte)) (io.Reader, func([]byte)) {
+	return r, log
+}
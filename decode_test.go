@@ -0,0 +1,27 @@
+package deputy
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+	"unicode/utf16"
+)
+
+func TestDecodeUTF16(t *testing.T) {
+	text := "héllo 😀\r\nworld\n"
+	encoded := []byte{0xFF, 0xFE}
+	for _, u := range utf16.Encode([]rune(text)) {
+		encoded = append(encoded, byte(u), byte(u>>8))
+	}
+	// reading a byte at a time splits units and surrogate pairs.
+	got, err := io.ReadAll(decodeUTF16(iotest.OneByteReader(bytes.NewReader(encoded))))
+	if err != nil || string(got) != text {
+		t.Fatalf("expected %q, got %q and %v", text, got, err)
+	}
+
+	got, err = io.ReadAll(decodeUTF16(bytes.NewReader([]byte("plain\n"))))
+	if err != nil || string(got) != "plain\n" {
+		t.Fatalf("expected output without a BOM to be left alone, got %q and %v", got, err)
+	}
+}
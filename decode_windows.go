@@ -0,0 +1,64 @@
+package deputy
+
+import (
+	"io"
+	"syscall"
+	"unicode/utf16"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// cpUTF8 is the UTF-8 code page.
+const cpUTF8 = 65001
+
+var (
+	kernel32                = syscall.NewLazyDLL("kernel32.dll")
+	procGetConsoleOutputCP  = kernel32.NewProc("GetConsoleOutputCP")
+	procGetOEMCP            = kernel32.NewProc("GetOEMCP")
+	procMultiByteToWideChar = kernel32.NewProc("MultiByteToWideChar")
+)
+
+// decodeOutput returns r and log with the output read from r converted to
+// UTF-8: from UTF-16LE if it starts with a byte order mark, and otherwise,
+// for lines that aren't valid UTF-8, from the console's code page, which
+// console programs write in when their output is a pipe.
+func decodeOutput(r io.Reader, log func([]byte)) (io.Reader, func([]byte)) {
+	cp := consoleCodePage()
+	return decodeUTF16(r), func(b []byte) {
+		if cp == cpUTF8 || utf8.Valid(b) {
+			log(b)
+			return
+		}
+		if s, ok := fromCodePage(cp, b); ok {
+			b = s
+		}
+		log(b)
+	}
+}
+
+// consoleCodePage returns the code page of this process's console, or the
+// OEM code page, which console programs use, if it has no console.
+func consoleCodePage() uint32 {
+	cp, _, _ := procGetConsoleOutputCP.Call()
+	if cp == 0 {
+		cp, _, _ = procGetOEMCP.Call()
+	}
+	return uint32(cp)
+}
+
+// fromCodePage converts b from the code page cp to UTF-8.
+func fromCodePage(cp uint32, b []byte) ([]byte, bool) {
+	if len(b) == 0 {
+		return b, true
+	}
+	n, _, _ := procMultiByteToWideChar.Call(uintptr(cp), 0, uintptr(unsafe.Pointer(&b[0])), uintptr(len(b)), 0, 0)
+	if n == 0 {
+		return nil, false
+	}
+	w := make([]uint16, n)
+	n, _, _ = procMultiByteToWideChar.Call(uintptr(cp), 0, uintptr(unsafe.Pointer(&b[0])), uintptr(len(b)), uintptr(unsafe.Pointer(&w[0])), n)
+	if n == 0 {
+		return nil, false
+	}
+	return []byte(string(utf16.Decode(w[:n]))), true
+}
@@ -0,0 +1,147 @@
+package deputy
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+)
+
+// DecompressAuto, as a Deputy's Decompress, decompresses the command's
+// output if it starts with the Magic of one of the Decompressors.
+const DecompressAuto = "auto"
+
+// Decompressor decompresses a compressed format of output.
+type Decompressor struct {
+	// Name names the format, as a Deputy's Decompress.
+	Name string
+	// Magic are the bytes the format starts with.
+	Magic []byte
+	// NewReader returns a reader of the decompressed data read from r.
+	NewReader func(r io.Reader) (io.Reader, error)
+}
+
+// Decompressors are the formats a Deputy's Decompress can name or detect.
+// Formats the standard library can't read, such as zstd, can be added here,
+// before any command is run.
+var Decompressors = []Decompressor{
+	{
+		Name:  "gzip",
+		Magic: []byte{0x1f, 0x8b},
+		NewReader: func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		},
+	},
+	{
+		Name:  "bzip2",
+		Magic: []byte("BZh"),
+		NewReader: func(r io.Reader) (io.Reader, error) {
+			return bzip2.NewReader(r), nil
+		},
+	},
+	{
+		// zlib has no fixed magic; this is the header of its default
+		// compression level.
+		Name:  "zlib",
+		Magic: []byte{0x78, 0x9c},
+		NewReader: func(r io.Reader) (io.Reader, error) {
+			return zlib.NewReader(r)
+		},
+	},
+}
+
+// findDecompressor returns the Decompressor with the given name.
+func findDecompressor(name string) (Decompressor, bool) {
+	for _, dc := range Decompressors {
+		if dc.Name == name {
+			return dc, true
+		}
+	}
+	return Decompressor{}, false
+}
+
+// checkDecompress returns an error if the Deputy's Decompress names no known
+// format.
+func (d Deputy) checkDecompress() error {
+	if d.Decompress == "" || d.Decompress == DecompressAuto {
+		return nil
+	}
+	if _, ok := findDecompressor(d.Decompress); !ok {
+		return fmt.Errorf("deputy: unknown Decompress format %q", d.Decompress)
+	}
+	return nil
+}
+
+// stdout returns the reader of the command's stdout, decompressing it if the
+// Deputy's Decompress says to.
+func (d Deputy) stdout() io.Reader {
+	if d.Decompress == "" {
+		return d.stdoutPipe
+	}
+	return &decompressReader{raw: bufio.NewReader(d.stdoutPipe), format: d.Decompress}
+}
+
+// decompressReader decompresses the output it reads, once it has read enough
+// to tell what format it is in.  After an error decompressing, it passes the
+// rest of the raw output through, so that it can still be drained.
+type decompressReader struct {
+	raw *bufio.Reader
+	// format is the Deputy's Decompress, and then the name of the format
+	// that was detected.
+	format string
+	r      io.Reader
+	failed bool
+}
+
+// Read implements io.Reader.
+func (d *decompressReader) Read(p []byte) (int, error) {
+	if d.failed {
+		return d.raw.Read(p)
+	}
+	if d.r == nil {
+		r, err := d.detect()
+		if err != nil {
+			return 0, d.fail(err)
+		}
+		d.r = r
+	}
+	n, err := d.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = d.fail(err)
+	}
+	return n, err
+}
+
+// detect returns a reader of the decompressed output, or of the raw output
+// if it isn't compressed.
+func (d *decompressReader) detect() (io.Reader, error) {
+	if d.format != DecompressAuto {
+		dc, _ := findDecompressor(d.format)
+		r, err := dc.NewReader(d.raw)
+		if err == io.EOF {
+			// no output at all.
+			return d.raw, nil
+		}
+		return r, err
+	}
+	for _, dc := range Decompressors {
+		// Peek only returns fewer bytes at the end of the output, which a
+		// magic that long can't match anyway.
+		magic, _ := d.raw.Peek(len(dc.Magic))
+		if bytes.Equal(magic, dc.Magic) {
+			d.format = dc.Name
+			return dc.NewReader(d.raw)
+		}
+	}
+	return d.raw, nil
+}
+
+// fail records that decompressing failed with err, and returns the error to
+// report.
+func (d *decompressReader) fail(err error) error {
+	d.failed = true
+	return fmt.Errorf("decompressing %s output: %w", d.format, err)
+}
@@ -0,0 +1,59 @@
+package deputy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDecompress(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses cat")
+	}
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("one\ntwo\n"))
+	zw.Close()
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"gzip":    gz.Bytes(),
+		"plain":   []byte("plain\n"),
+		"corrupt": append([]byte{0x1f, 0x8b}, bytes.Repeat([]byte("junk\n"), 1000)...),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		file, format string
+		want         string
+		fails        bool
+	}{
+		{"gzip", DecompressAuto, "one|two", false},
+		{"gzip", "gzip", "one|two", false},
+		{"plain", DecompressAuto, "plain", false},
+		{"plain", "gzip", "", true},
+		{"corrupt", DecompressAuto, "", true},
+	}
+	for _, test := range tests {
+		var lines []string
+		d := Deputy{Decompress: test.format, StdoutLog: func(b []byte) { lines = append(lines, string(b)) }}
+		err := d.Run(shellCommand("cat " + filepath.Join(dir, test.file)))
+		var pe *PipeError
+		if fails := errors.As(err, &pe); fails != test.fails || (err != nil && !fails) {
+			t.Errorf("%s as %s: expected a pipe error %v, got %v", test.file, test.format, test.fails, err)
+		}
+		if got := strings.Join(lines, "|"); got != test.want {
+			t.Errorf("%s as %s: expected %q, got %q", test.file, test.format, test.want, got)
+		}
+	}
+	if err := (Deputy{Decompress: "rar"}).Validate(); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,36 @@
+package deputy
+
+import "os/exec"
+
+// Default is the Deputy used by the package-level Run, Output, CombinedOutput,
+// Shell and RunFirstOf functions.  Applications can configure it once at
+// startup to set defaults for every command they run.  It must not be
+// modified while commands are running.
+var Default = Deputy{}
+
+// Run runs cmd with the Default Deputy, with opts applied for this call only.
+func Run(cmd *exec.Cmd, opts ...Option) error {
+	return Default.Run(cmd, opts...)
+}
+
+// Output runs cmd with the Default Deputy and returns its standard output.
+func Output(cmd *exec.Cmd, opts ...Option) ([]byte, error) {
+	return Default.Output(cmd, opts...)
+}
+
+// CombinedOutput runs cmd with the Default Deputy and returns its standard
+// output and standard error together.
+func CombinedOutput(cmd *exec.Cmd, opts ...Option) ([]byte, error) {
+	return Default.CombinedOutput(cmd, opts...)
+}
+
+// Shell runs command with the system shell using the Default Deputy.
+func Shell(command string, opts ...Option) error {
+	return Default.Shell(command, opts...)
+}
+
+// RunFirstOf runs the first of specs that starts and succeeds using the
+// Default Deputy.
+func RunFirstOf(specs ...Spec) (Result, error) {
+	return Default.RunFirstOf(specs...)
+}
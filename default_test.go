@@ -0,0 +1,51 @@
+package deputy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefaultOutput(t *testing.T) {
+	old := Default
+	defer func() { Default = old }()
+
+	output := "foooo"
+	Default = Deputy{Errors: FromStderr}
+	out, err := Output(maker{stdout: output}.make())
+	if err != nil {
+		t.Fatalf("unexpected error returned from Output: %v", err)
+	}
+	if string(out) != output {
+		t.Fatalf("expected output %q but got %q", output, out)
+	}
+
+	_, err = Output(maker{stderr: "bad", exit: 1}.make())
+	if err == nil || !strings.HasSuffix(err.Error(), "bad") {
+		t.Fatalf("expected error with stderr text, got %v", err)
+	}
+}
+
+func TestOutputWithLog(t *testing.T) {
+	output := "foooo"
+	var logged []byte
+	d := Deputy{StdoutLog: func(b []byte) { logged = append([]byte(nil), b...) }}
+	out, err := d.Output(maker{stdout: output}.make())
+	if err != nil {
+		t.Fatalf("unexpected error returned from Output: %v", err)
+	}
+	if strings.TrimSpace(string(out)) != output {
+		t.Fatalf("expected output %q but got %q", output, out)
+	}
+	if string(logged) != output {
+		t.Fatalf("expected logged %q but got %q", output, logged)
+	}
+}
+
+func TestShell(t *testing.T) {
+	if err := Shell("exit 0"); err != nil {
+		t.Fatalf("unexpected error returned from Shell: %v", err)
+	}
+	if err := Shell("exit 3"); err == nil {
+		t.Fatal("expected error from failing shell command")
+	}
+}
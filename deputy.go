@@ -7,9 +7,19 @@ package deputy
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 )
 
 // ErrorHandling is a flag that tells Deputy how to handle errors running a
@@ -32,53 +42,655 @@ const (
 
 // Deputy is a type that runs Commands with advanced options not available from
 // os/exec.  See the comments on field values for details.
+//
+// A Deputy only reads a command's output itself, line by line, when something
+// needs to see it: log functions, sinks, Quiet, error text from FromStderr or
+// FromStdout, or a Jobs registry that keeps output.  InheritStdio copies a
+// stream that is read this way to this process's, and Decompress only applies
+// to stdout that is read this way.  CountOutput, OnThreshold and FailOnStderr
+// watch a stream that is read, and otherwise add a writer alongside the
+// command's own, which os/exec copies to from a pipe, as it does to writers
+// that aren't an *os.File; a Cmd wraps those writers too, so that
+// DetachOutput can cut them off.  A Stdin that isn't an *os.File is copied
+// into the command by the Deputy, so that the copy stops when the command
+// exits.  Otherwise the command's Stdin, Stdout and Stderr are left exactly as
+// they were set, so a command writing to an *os.File writes to it directly,
+// with no pipes or copying goroutines in between.
 type Deputy struct {
-	// Cancel, when closed, will cause the command to close.
+	// Cancel, when closed, will cause the command to close, and Run to
+	// return a *CanceledError.
 	Cancel <-chan struct{}
+	// Timeout, if non-zero, is how long the command may run before it is
+	// killed and Run returns a *TimeoutError.
+	Timeout time.Duration
+	// Grace, if non-zero, is how long a command that is being stopped
+	// because of Cancel or Timeout is given to exit after being sent the
+	// StopSignal, before it is killed.  On windows commands are always
+	// killed right away.
+	Grace time.Duration
+	// StopSignal is the signal that asks the command to stop when Grace is
+	// set.  It defaults to SIGTERM.
+	StopSignal os.Signal
+	// GraceEnv, if set, is the name of an environment variable, such as
+	// "DEPUTY_GRACE", in which the command is told its Grace in seconds, so
+	// that a command that cooperates knows how long it has to finish once
+	// it is sent the StopSignal.
+	GraceEnv string
+	// WaitDelay, if non-zero, is how long the command's output is given to
+	// end once the command has exited or been stopped, like exec.Cmd's
+	// WaitDelay.  A command can leave its output open after it exits by
+	// passing it to a child of its own that keeps running; after WaitDelay
+	// the output is closed from this end, and if the command had otherwise
+	// succeeded, Run returns exec.ErrWaitDelay.  Output read by the Deputy
+	// itself is only closed this way on linux, where it can be told that the
+	// command has exited before its output ends.
+	WaitDelay time.Duration
+	// PassDeadline, if true, tells the command when it must finish by, if
+	// the Deputy has a Timeout or the run's context has a deadline, in the
+	// DeadlineEnv environment variable.
+	PassDeadline bool
 	// Errors describes how errors should be handled.
 	Errors ErrorHandling
 	// StdoutLog takes a function that will receive lines written to stdout from
-	// the command (with the newline elided).
+	// the command (with the newline elided).  On windows, output in UTF-16
+	// or the console's code page is converted to UTF-8 for it.
 	StdoutLog func([]byte)
 	// StdoutLog takes a function that will receive lines written to stderr from
 	// the command (with the newline elided).
 	StderrLog func([]byte)
+	// StdoutWriter, if set, receives the command's stdout exactly as it is
+	// written, rather than it being read line by line, so that it can be
+	// piped on while stderr alone is logged.  Stdout is then left out of
+	// Log, Sinks, Quiet, and the Timestamp and Elapsed annotations, which
+	// apply to stderr alone.  It can't be used with StdoutLog, or with a
+	// command whose Stdout is already set.
+	StdoutWriter io.Writer
+	// StderrWriter is StdoutWriter for stderr.
+	StderrWriter io.Writer
+	// CountOutput, if set, counts the lines and bytes the command writes to
+	// each stream, in the Result's StdoutCount and StderrCount.
+	CountOutput bool
+	// OnThreshold, if set, is called the first time the count of either
+	// stream exceeds a non-zero count in OutputThreshold, with the stream
+	// and its count at that point, such as to warn that a command is
+	// producing far more output than usual.  It is called from the
+	// goroutine reading the stream, so it shouldn't block.  Setting it
+	// implies CountOutput.
+	OnThreshold func(Stream, OutputCount)
+	// OutputThreshold is the count of lines, bytes or both that OnThreshold
+	// is called for exceeding.
+	OutputThreshold OutputCount
+	// FIFOs are named pipes whose lines are handled like the lines of the
+	// command's output, for commands that write their log to a file.
+	FIFOs []*FIFO
+	// Log takes a function that will receive the lines written to both stdout
+	// and stderr, tagged with the stream they came from.  It is never called
+	// concurrently, so it doesn't need its own locking.  It may be used
+	// together with StdoutLog and StderrLog.
+	Log func(Line)
+	// Sinks receive the lines written to both stdout and stderr.  They are
+	// opened before each command starts and closed when it finishes.  Errors
+	// from sinks are handled according to PipeErrors.
+	Sinks []Sink
+	// Defer holds functions that are called with the Result of each run once
+	// it is over, whether it succeeded, failed, timed out, or was never
+	// started.  They are called in reverse order, like deferred function
+	// calls, and are called even if Run panics.
+	Defer []func(Result)
+	// PipeErrors says what to do when reading the command's output or
+	// writing it to a sink fails.  By default, the error is returned from Run
+	// if the command itself succeeded.
+	PipeErrors PipeErrorPolicy
+	// Timestamp, if non-empty, is a time layout (see the time package) used
+	// to prefix each line passed to the log functions with the time it was
+	// read, followed by a space.
+	Timestamp string
+	// Elapsed, if true, prefixes each line passed to the log functions with
+	// the time since the command started, such as "+1.234s ".  It comes
+	// after the Timestamp, if both are set.
+	Elapsed bool
+	// Prefix, if non-empty, is added to the start of each line passed to
+	// the log functions, after the Timestamp and Elapsed time, such as to
+	// tell apart the output of commands run at the same time.
+	Prefix string
+	// ClearEnv, if true, removes every variable from the command's
+	// environment (whether inherited or set in the command's Env) except
+	// those named in EnvAllowlist, so that credentials and other settings of
+	// this process don't leak into the child by accident.
+	ClearEnv bool
+	// EnvAllowlist names the environment variables kept when ClearEnv is
+	// set.  A name ending in * keeps every variable with that prefix, such as
+	// "LC_*".  Note that variables set by SocketActivation must be listed to
+	// be kept.
+	EnvAllowlist []string
+	// Env holds extra environment variables, in "key=value" form, added to
+	// the command's environment after ClearEnv is applied.
+	Env []string
+	// Jobs, if set, is a registry that records each run, from before the
+	// command starts until after it finishes.
+	Jobs *Jobs
+	// History, if set, keeps the Result of each run, for showing recent
+	// activity.
+	History *History
+	// Labels, such as a job name or tenant, describe the runs of the
+	// Deputy.  They are copied to each Result, and so reach its JSON and the
+	// metrics of a MetricsExporter.
+	Labels map[string]string
+	// Umask, if non-zero, is the umask the command is started with, so that
+	// files it creates get predictable permissions.  Unix only.  Because the
+	// umask is shared by the whole process, it is briefly changed for this
+	// process as well while the command starts.
+	Umask int
+	// Files are extra open files passed to the command, keyed by name.  They
+	// are appended to the command's ExtraFiles in name order, and for each
+	// one the command's environment gets DEPUTY_FD_<NAME>=<fd>, telling the
+	// child which file descriptor it has.  See InheritedFile.  Not supported
+	// on windows.
+	Files map[string]*os.File
+	// LookPath, if set, is used to find the program to run from the name it
+	// was given (the command's Args[0]), instead of the result of the lookup
+	// done by exec.Command.  See PathCache for a caching implementation that
+	// can search a custom path.
+	LookPath func(file string) (string, error)
+	// Policy, if set, is checked before each command is started, and commands
+	// it rejects are not run.
+	Policy Policy
+	// VerifyChecksum maps program paths to the hex encoded SHA-256 of their
+	// expected contents.  A command whose program is listed is only run if
+	// the file's contents match.  An entry matches any path to the same
+	// file, and an entry without a directory, such as "git", is looked up as
+	// a command's name is.  Programs not listed are not checked.  The file
+	// is checked just before it is started, so one replaced in between runs
+	// unchecked; keep checked programs where only trusted users can write.
+	VerifyChecksum map[string]string
+	// ReadBuffer, if positive, is the size of the buffer each logged stream
+	// is read into, which is also the longest line that can be read; a longer
+	// line is a pipe error.  Zero means 64KiB.  A bigger buffer means fewer
+	// reads for commands that write huge bursts of output.
+	ReadBuffer int
+	// Decompress, if set, decompresses the command's stdout before it is
+	// split into lines, for commands that write compressed output.  It is
+	// DecompressAuto, to decompress output that starts with the Magic of
+	// one of the Decompressors and pass other output through, or the Name
+	// of one of them, to always decompress that format.
+	Decompress string
+	// Reaped, if set, is called from a background goroutine with the process
+	// id and exit code of a killed command that couldn't be waited for before
+	// Run returned, such as one that was unkillable, once it has finally been
+	// waited for.
+	Reaped func(pid, exitCode int)
+	// FindOrphans, if true, starts each command in a process group of its
+	// own, and after it exits, lists the processes still running in that
+	// group in the Result's Orphans, to catch commands that leak background
+	// processes.  Being in its own group means the command no longer gets
+	// the signals sent to this process's group by the terminal, such as for
+	// Ctrl-C.  Orphans are only found on linux.
+	FindOrphans bool
+	// TrackDescendants, if positive, is how often the processes started by
+	// the command, and by those processes in turn, are looked for while it
+	// runs.  Every one seen is listed in the Result's Descendants, so that
+	// what a complex command actually ran can be seen afterwards.  A process
+	// that starts and exits between looks is missed.  Descendants are only
+	// found on linux.
+	TrackDescendants time.Duration
+	// PreStart, if set, is called with the command just before it is
+	// started, after the Deputy has set up its pipes and writers, so that it
+	// can make last-minute changes such as to SysProcAttr or ExtraFiles.  It
+	// should leave Stdout and Stderr alone.  If it returns an error, the
+	// command is not started and Run returns the error.
+	PreStart func(*exec.Cmd) error
+	// ProcAttr holds process attributes to start the command with, such as
+	// NewProcessGroup, which are set in its SysProcAttr as appropriate for
+	// this platform.
+	ProcAttr ProcAttr
+	// Foreground, if true, makes the command the foreground process group of
+	// this process's controlling terminal while it runs, for interactive
+	// commands such as editors launched from a terminal program.  The
+	// terminal's signals, such as from Ctrl-C, go to the command rather than
+	// to this process.  The terminal is given back once the command is done,
+	// during which SIGTTOU is briefly ignored.  Run returns an error if there
+	// is no controlling terminal.  Not supported on windows.
+	Foreground bool
+	// RawTerminal, if true along with Foreground, puts the terminal in raw
+	// mode while the command runs, for commands that read what is typed a key
+	// at a time without setting the terminal up themselves.  Keys such as
+	// Ctrl-C are then passed to the command as they are, rather than sent as
+	// signals.  The command reads the terminal directly, not through a pty.
+	// The terminal's settings are put back once the command is done, even if
+	// the run panics.
+	RawTerminal bool
+	// InheritStdio, if true, connects the command's stdin, stdout, and
+	// stderr to this process's, where they aren't already set, so the user
+	// sees what the command prints while Timeout, error capture and the rest
+	// still apply.  A stream that is being logged is copied to this
+	// process's line by line.
+	InheritStdio bool
+	// Quiet, if positive, holds back the command's logged output, up to the
+	// most recent Quiet bytes of it, and passes it on to the log functions
+	// and sinks only if Run returns an error, in the manner of chronic(1).
+	// Output from a command that succeeds is discarded.  With InheritStdio,
+	// the output copied to this process's stdout and stderr is held back
+	// too.
+	Quiet int
+	// CollectArtifacts are patterns, as for filepath.Match and relative to
+	// the command's working directory, naming files to collect once the
+	// command has exited, whether or not it succeeded.  The files are given
+	// to ArtifactStore and listed in the Result's Artifacts.  Patterns may
+	// not reach outside the working directory, and symbolic links aren't
+	// collected.
+	CollectArtifacts []string
+	// ArtifactStore keeps the files collected by CollectArtifacts, such as
+	// an ArtifactDir.
+	ArtifactStore ArtifactStore
+	// WatchFiles, if set, is a directory to watch for changes during the
+	// run.  The files created, modified and deleted under it are listed in
+	// the Result's FileChanges, found by comparing the directory's contents
+	// before the command starts with those after it exits, so changes that
+	// are undone before the command exits are missed.
+	WatchFiles string
+	// FailOnStderr, if set, stops the command as soon as it writes a line
+	// to stderr that matches, and Run returns an error wrapping
+	// ErrStderrOutput that ends with the line.  This is for commands that
+	// report an error and then hang instead of exiting.  Use
+	// regexp.MustCompile("") to stop the command on any stderr output.
+	FailOnStderr *regexp.Regexp
+	// ShellProgram, if its Path is set, is the shell that Shell runs commands
+	// with, instead of the one from SystemShell.
+	ShellProgram ShellProgram
+	// Verbosity is how much the Deputy reports about what it is doing, such
+	// as commands starting, exiting and being killed.  The default,
+	// ErrorsOnly, reports only problems that Run can't return.
+	Verbosity Verbosity
+	// Logger, if set, receives the Deputy's own messages, one per call.  By
+	// default they go to the standard logger in package log.
+	Logger func(msg string)
+
+	// prepared is set once prepareLogs has run.
+	prepared bool
+	sinks    *sinkSet
+	failures *pipeFailures
+	result   *Result
+	jobID    string
+	// jobOutput keeps the run's output for the Jobs registry.
+	jobOutput *jobOutput
+	// jobCancel is closed when the run's job is canceled.  It is watched
+	// alongside Cancel rather than merged into it, which would take a
+	// goroutine.
+	jobCancel <-chan struct{}
+	// descendants tracks the command's descendants, if TrackDescendants is
+	// set.
+	descendants *descendantTracker
+	// quiet holds back the command's output, if Quiet is set.
+	quiet *quietOutput
+	// ctx is the context given to RunContext, if any.
+	ctx context.Context
+	// stderrWatch watches stderr for FailOnStderr.
+	stderrWatch *stderrWatch
+	// started, if set, is called once the command has started.
+	started func()
+	// detach, if set, can cut the command's output off from the Deputy.
+	detach *outputDetach
+	// stdin copies the command's Stdin into it, if it isn't a file.
+	stdin *stdinPump
+	// attempt is the number of the run among the attempts of a Retry.
+	attempt int
+	// alternative is the index of the command among those given to
+	// RunFirstOf.
+	alternative int
 
 	stderrPipe io.ReadCloser
 	stdoutPipe io.ReadCloser
 }
 
 // Run starts the specified command and waits for it to complete.  Its behavior
-// conforms to the Options passed to it at construction time.
+// conforms to the Deputy's configuration, with any opts applied on top of it
+// for this call only.
 //
 // Note that, like cmd.Run, Deputy.Run should not be used with
 // StdoutPipe or StderrPipe.
-func (d Deputy) Run(cmd *exec.Cmd) error {
-	if err := d.makePipes(cmd); err != nil {
+func (d Deputy) Run(cmd *exec.Cmd, opts ...Option) error {
+	d = d.With(opts...)
+	d.prepareLogs()
+	d.result = &Result{ExitCode: -1, Labels: d.Labels, Alternative: d.alternative, Attempts: d.attempt}
+	if d.Jobs != nil {
+		var err error
+		d.jobID, d.jobCancel, d.jobOutput, err = d.Jobs.add(d.jobID, cmd)
+		if err != nil {
+			// without a job there's nothing for finish to record.
+			d.Jobs = nil
+			d.result.Err = err
+			d.finish(cmd)
+			return err
+		}
+		d.result.JobID = d.jobID
+	}
+	defer d.finish(cmd)
+	d.result.Err = d.execute(cmd)
+	return d.result.Err
+}
+
+// RunResult runs the command as Run does, and returns its Result as well as
+// its error.  The Result is filled in however the run ends, so when the
+// command fails it still has the command's exit code, how long it ran, and
+// the Tail of its output.
+func (d Deputy) RunResult(cmd *exec.Cmd, opts ...Option) (Result, error) {
+	var res Result
+	err := d.Run(cmd, append(opts[:len(opts):len(opts)], WithDefer(func(r Result) { res = r }))...)
+	return res, err
+}
+
+// execute checks and runs the command.
+func (d Deputy) execute(cmd *exec.Cmd) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	if err := d.checkCmd(cmd); err != nil {
+		return err
+	}
+	if d.StdoutWriter != nil {
+		cmd.Stdout = d.StdoutWriter
+	}
+	if d.StderrWriter != nil {
+		cmd.Stderr = d.StderrWriter
+	}
+	if d.InheritStdio {
+		d.inheritStdio(cmd)
+	}
+	if err := d.resolvePath(cmd); err != nil {
+		return err
+	}
+	d.setupEnv(cmd)
+	if d.PassDeadline {
+		d.passDeadline(cmd)
+	}
+	if d.GraceEnv != "" && d.Grace > 0 {
+		setEnv(cmd, d.GraceEnv, strconv.FormatFloat(d.Grace.Seconds(), 'f', -1, 64))
+	}
+	applyProcAttr(cmd, d.ProcAttr)
+	if d.FindOrphans {
+		setpgid(cmd)
+	}
+	if err := d.passFiles(cmd); err != nil {
+		return err
+	}
+	if err := d.checkPolicy(cmd); err != nil {
+		return err
+	}
+	if err := d.verifyChecksum(cmd.Path); err != nil {
+		return err
+	}
+	if err := d.sinks.open(); err != nil {
 		return err
 	}
+	// closes the sinks if setting up the run fails.  Once the command has
+	// run they have already been closed, and closing them again does
+	// nothing.
+	defer d.sinks.close()
+	if d.jobOutput != nil {
+		defer d.captureOutput(cmd, d.jobOutput)()
+	}
+	if d.FailOnStderr != nil {
+		defer d.watchStderr(cmd)()
+	}
+	if d.CountOutput || d.OnThreshold != nil {
+		defer d.countOutput(cmd)()
+	}
+	if d.WatchFiles != "" {
+		finish, err := d.watchFiles()
+		if err != nil {
+			return err
+		}
+		defer finish()
+	}
+	if d.TrackDescendants > 0 {
+		d.descendants = &descendantTracker{every: d.TrackDescendants}
+		defer func() { d.result.Descendants, d.result.PeakDescendants = d.descendants.finish() }()
+	}
+	if d.Foreground {
+		restore, err := foreground(cmd, d.RawTerminal)
+		if err != nil {
+			return err
+		}
+		defer restore()
+	}
+	tail, err := d.runPiped(cmd)
+	var aerr error
+	if len(d.CollectArtifacts) > 0 && !d.result.Start.IsZero() {
+		d.result.Artifacts, aerr = d.collectArtifacts(cmd.Dir)
+	}
+	// held output is released if the run is going to fail for any reason,
+	// and before the sinks are closed, so that it reaches them.
+	if d.quiet != nil && (err != nil || aerr != nil || d.failures.result(nil) != nil) {
+		d.quiet.release()
+	}
+	d.sinks.close()
+	d.result.Checkpoint = d.sinks.checkpoint
+	d.result.PipeErrors = d.failures.all()
+	err = d.failures.result(err)
+	if aerr != nil {
+		err = errors.Join(err, aerr)
+	}
+	if err != nil && !d.result.Start.IsZero() {
+		d.result.Tail = tail
+		return d.runError(cmd, err, tail)
+	}
+	return err
+}
+
+// runPiped sets up the command's pipes and error collection and runs it.  If
+// the command fails, it also returns the error text collected from its output.
+func (d Deputy) runPiped(cmd *exec.Cmd) (tail string, err error) {
+	if err := d.makePipes(cmd); err != nil {
+		return "", err
+	}
 
+	// When a stream is already being read line by line for a log function,
+	// the error text has to be collected from those lines, since replacing
+	// the command's writer would cut the log pipe off.
 	errsrc := &bytes.Buffer{}
-	if d.Errors == FromStderr {
+	switch {
+	case d.Errors == FromStderr && d.stderrPipe != nil:
+		d.StderrLog = teeLines(d.StderrLog, errsrc)
+	case d.Errors == FromStderr:
 		cmd.Stderr = dualWriter(cmd.Stderr, errsrc)
-	}
-	if d.Errors == FromStdout {
+	case d.Errors == FromStdout && d.stdoutPipe != nil:
+		d.StdoutLog = teeLines(d.StdoutLog, errsrc)
+	case d.Errors == FromStdout:
 		cmd.Stdout = dualWriter(cmd.Stdout, errsrc)
 	}
+	if d.detach != nil {
+		d.detach.wrap(&d, cmd)
+	}
+
+	if d.WaitDelay > 0 && cmd.WaitDelay == 0 {
+		cmd.WaitDelay = d.WaitDelay
+	}
+	var finishFIFOs func()
+	if len(d.FIFOs) > 0 {
+		if finishFIFOs, err = d.readFIFOs(); err != nil {
+			d.closePipes()
+			return "", err
+		}
+	}
+	err = d.run(cmd)
+	if finishFIFOs != nil {
+		finishFIFOs()
+	}
+	if d.stdin != nil {
+		d.result.StdinBytes = d.stdin.written()
+	}
+	if err == nil || d.Errors == DefaultErrs {
+		return "", err
+	}
+	return string(bytes.TrimSpace(errsrc.Bytes())), err
+}
+
+// Output runs the command and returns its standard output, like cmd.Output.
+// As with Run, opts apply to this call only.
+// If StdoutLog or Log is set, the lines they receive are also collected into
+// the returned output.
+func (d Deputy) Output(cmd *exec.Cmd, opts ...Option) ([]byte, error) {
+	d = d.With(opts...)
+	d.prepareLogs()
+	if cmd != nil && cmd.Stdout != nil {
+		return nil, errors.New("deputy: Stdout already set")
+	}
+	out := &bytes.Buffer{}
+	if d.StdoutLog != nil {
+		d.StdoutLog = teeLines(d.StdoutLog, out)
+	} else if cmd != nil {
+		cmd.Stdout = out
+	}
+	err := d.Run(cmd)
+	return out.Bytes(), err
+}
 
-	err := d.run(cmd)
+// Shell runs command with the Deputy's ShellProgram, or the system shell from
+// SystemShell (sh on unix, cmd on windows) if it isn't set, and waits for it
+// to complete.
+func (d Deputy) Shell(command string, opts ...Option) error {
+	shell := d.With(opts...).ShellProgram
+	if shell.Path == "" {
+		shell = SystemShell()
+	}
+	return d.Run(shell.Command(command), opts...)
+}
 
-	if d.Errors == DefaultErrs {
+// Validate reports an error if the Deputy's configuration does not make sense.
+// Run calls Validate before doing anything else, so it only needs to be called
+// directly to check a configuration ahead of time.
+func (d Deputy) Validate() error {
+	switch d.Errors {
+	case DefaultErrs, FromStderr, FromStdout:
+	default:
+		return fmt.Errorf("deputy: invalid ErrorHandling value %d", d.Errors)
+	}
+	if d.PipeErrors < FailOnPipeError || d.PipeErrors > KillOnPipeError {
+		return fmt.Errorf("deputy: invalid PipeErrorPolicy value %d", d.PipeErrors)
+	}
+	if d.Timeout < 0 {
+		return fmt.Errorf("deputy: negative Timeout %v", d.Timeout)
+	}
+	if d.Grace < 0 {
+		return fmt.Errorf("deputy: negative Grace %v", d.Grace)
+	}
+	if d.WaitDelay < 0 {
+		return fmt.Errorf("deputy: negative WaitDelay %v", d.WaitDelay)
+	}
+	if d.Umask < 0 || d.Umask > 0777 {
+		return fmt.Errorf("deputy: invalid Umask %#o", d.Umask)
+	}
+	if d.TrackDescendants < 0 {
+		return fmt.Errorf("deputy: negative TrackDescendants %v", d.TrackDescendants)
+	}
+	if d.Quiet < 0 {
+		return fmt.Errorf("deputy: negative Quiet %d", d.Quiet)
+	}
+	if d.ReadBuffer < 0 {
+		return fmt.Errorf("deputy: negative ReadBuffer %d", d.ReadBuffer)
+	}
+	if d.StdoutWriter != nil && d.StdoutLog != nil {
+		return errors.New("deputy: StdoutLog cannot be used with StdoutWriter")
+	}
+	if d.StderrWriter != nil && d.StderrLog != nil {
+		return errors.New("deputy: StderrLog cannot be used with StderrWriter")
+	}
+	if err := d.checkDecompress(); err != nil {
 		return err
 	}
+	return d.checkArtifacts()
+}
 
-	if err != nil && errsrc.Len() > 0 {
-		return fmt.Errorf("%s: %s", err, bytes.TrimSpace(errsrc.Bytes()))
+// checkCmd reports an error if cmd can't be run with the Deputy's
+// configuration.
+func (d Deputy) checkCmd(cmd *exec.Cmd) error {
+	if cmd == nil {
+		return errors.New("deputy: nil command")
 	}
-	return err
+	if cmd.Process != nil {
+		return errors.New("deputy: command already started")
+	}
+	if d.StdoutLog != nil && cmd.Stdout != nil {
+		return errors.New("deputy: StdoutLog cannot be used when the command's Stdout is already set or StdoutPipe has been called")
+	}
+	if d.StderrLog != nil && cmd.Stderr != nil {
+		return errors.New("deputy: StderrLog cannot be used when the command's Stderr is already set or StderrPipe has been called")
+	}
+	if d.StdoutWriter != nil && cmd.Stdout != nil {
+		return errors.New("deputy: StdoutWriter cannot be used when the command's Stdout is already set")
+	}
+	if d.StderrWriter != nil && cmd.Stderr != nil {
+		return errors.New("deputy: StderrWriter cannot be used when the command's Stderr is already set")
+	}
+	return nil
+}
+
+// inheritStdio connects the command's unset standard streams to this
+// process's.
+func (d *Deputy) inheritStdio(cmd *exec.Cmd) {
+	if cmd.Stdin == nil {
+		cmd.Stdin = os.Stdin
+	}
+	if d.Quiet > 0 && d.quiet == nil {
+		d.holdOutput()
+	}
+	q := d.quiet
+	switch {
+	case q != nil && q.stdout != nil:
+		q.stdout = joinLogs(q.stdout, writeLines(os.Stdout))
+	case d.StdoutLog != nil:
+		d.StdoutLog = joinLogs(d.StdoutLog, writeLines(os.Stdout))
+	case cmd.Stdout == nil && q != nil:
+		q.stdout, d.StdoutLog = writeLines(os.Stdout), q.log(Stdout)
+	case cmd.Stdout == nil:
+		cmd.Stdout = os.Stdout
+	}
+	switch {
+	case q != nil && q.stderr != nil:
+		q.stderr = joinLogs(q.stderr, writeLines(os.Stderr))
+	case d.StderrLog != nil:
+		d.StderrLog = joinLogs(d.StderrLog, writeLines(os.Stderr))
+	case cmd.Stderr == nil && q != nil:
+		q.stderr, d.StderrLog = writeLines(os.Stderr), q.log(Stderr)
+	case cmd.Stderr == nil:
+		cmd.Stderr = os.Stderr
+	}
+}
+
+// writeLines returns a log function that writes each line and a newline to
+// w.
+func writeLines(w io.Writer) func([]byte) {
+	sink := writerSink{w}
+	return func(b []byte) {
+		_ = sink.WriteLine(Line{Text: b})
+	}
+}
+
+// checkPolicy reports an error if the Deputy's Policy rejects cmd.
+func (d Deputy) checkPolicy(cmd *exec.Cmd) error {
+	if d.Policy == nil {
+		return nil
+	}
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	var err error
+	if p, ok := d.Policy.(ContextPolicy); ok {
+		err = p.CheckContext(d.context(), cmd.Path, cmd.Args, env)
+	} else {
+		err = d.Policy.Check(cmd.Path, cmd.Args, env)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPolicy, err)
+	}
+	return nil
 }
 
 func (d *Deputy) makePipes(cmd *exec.Cmd) error {
+	if err := d.pumpStdin(cmd); err != nil {
+		return err
+	}
 	if d.StderrLog != nil {
 		var err error
 		d.stderrPipe, err = cmd.StderrPipe()
@@ -106,13 +718,26 @@ func dualWriter(w1, w2 io.Writer) io.Writer {
 	return io.MultiWriter(w1, w2)
 }
 
+// teeLines returns a log function that writes each line to w before passing it
+// on to log.
+func teeLines(log func([]byte), w *bytes.Buffer) func([]byte) {
+	return func(b []byte) {
+		w.Write(b)
+		w.WriteByte('\n')
+		log(b)
+	}
+}
+
 func (d Deputy) run(cmd *exec.Cmd) error {
-	errs := make(chan error)
+	// buffered, so that the pipe read by wait itself doesn't block on it.
+	errs := make(chan struct{}, 2)
 	if err := d.start(cmd, errs); err != nil {
 		return err
 	}
-	if d.Cancel == nil {
-		return d.wait(cmd, errs)
+	if d.Cancel == nil && d.jobCancel == nil && d.Timeout == 0 && d.stderrWatch == nil {
+		err := d.wait(cmd, errs)
+		d.exited(cmd)
+		return err
 	}
 
 	done := make(chan error)
@@ -123,60 +748,330 @@ func (d Deputy) run(cmd *exec.Cmd) error {
 		close(done)
 	}()
 
+	var timeout <-chan time.Time
+	if d.Timeout > 0 {
+		t := time.NewTimer(d.Timeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+
 	select {
 	case <-d.Cancel:
-		// this may fail, but there's not much we can do about it
-		return cmd.Process.Kill()
+		d.logf(Normal, "deputy: stopping pid %d: canceled", cmd.Process.Pid)
+		// killing may fail, but there's not much we can do about it, unless
+		// the command is stuck.
+		if err := d.stop(cmd, done); err != nil {
+			return err
+		}
+		return d.canceled(true)
+	case <-d.jobCancel:
+		d.logf(Normal, "deputy: stopping pid %d: job canceled", cmd.Process.Pid)
+		if err := d.stop(cmd, done); err != nil {
+			return err
+		}
+		return &CanceledError{Started: true}
+	case <-timeout:
+		d.logf(Normal, "deputy: stopping pid %d: timed out after %v", cmd.Process.Pid, d.Timeout)
+		if err := d.stop(cmd, done); err != nil {
+			return err
+		}
+		return &TimeoutError{Timeout: d.Timeout}
+	case <-d.stderrFailed():
+		d.logf(Normal, "deputy: stopping pid %d: it wrote to stderr", cmd.Process.Pid)
+		if err := d.stop(cmd, done); err != nil {
+			return err
+		}
+		return d.stderrWatch.err()
 	case <-done:
+		d.exited(cmd)
+		// the line may have been read just before the command exited.
+		if isClosed(d.stderrFailed()) {
+			return d.stderrWatch.err()
+		}
 		return err
 	}
 }
 
-func (d Deputy) start(cmd *exec.Cmd, errs chan<- error) error {
-	if err := cmd.Start(); err != nil {
-		return err
+// stop ends the command, first asking it to exit and waiting up to the
+// Deputy's Grace for it to do so, if Grace is set.  done is closed once the
+// command has been waited for.
+func (d Deputy) stop(cmd *exec.Cmd, done <-chan error) error {
+	if d.Grace > 0 && runtime.GOOS != "windows" {
+		sig := d.StopSignal
+		if sig == nil {
+			sig = syscall.SIGTERM
+		}
+		if err := cmd.Process.Signal(sig); err == nil {
+			d.logf(Debug, "deputy: sent %v to pid %d, waiting %v for it to exit", sig, cmd.Process.Pid, d.Grace)
+			t := time.NewTimer(d.Grace)
+			defer t.Stop()
+			select {
+			case <-done:
+				d.exited(cmd)
+				d.result.Graceful = true
+				return nil
+			case <-t.C:
+			}
+		}
+	}
+	d.logf(Debug, "deputy: killing pid %d", cmd.Process.Pid)
+	err := cmd.Process.Kill()
+	if rerr := d.reap(cmd, done); rerr != nil {
+		return rerr
 	}
+	return err
+}
 
-	if d.stdoutPipe != nil {
-		go pipe(d.StdoutLog, d.stdoutPipe, errs)
+// killDrain is how long the output of a killed command is given to drain
+// before its pipes are closed, unless the Deputy's WaitDelay is set, and then
+// how long it is given to be waited for.
+var killDrain = time.Second
+
+// exitPoll is how often a command whose output is still open is checked for
+// having exited, when WaitDelay is set.
+var exitPoll = 10 * time.Millisecond
+
+// ErrUnkillable is matched by the error returned when a command that was
+// killed doesn't exit.
+var ErrUnkillable = errors.New("deputy: command could not be killed")
+
+// UnkillableError is returned when a command that was killed because of
+// Cancel or Timeout still hasn't exited after a short while, which happens
+// when a process is stuck in the kernel, such as in an uninterruptible disk
+// wait.  On linux, a process is known to have exited even if it can't be
+// waited for yet; elsewhere, a command that can't be waited for is assumed
+// to be stuck.
+type UnkillableError struct {
+	// Pid is the process id of the command.
+	Pid int
+}
+
+// Error implements error.
+func (e *UnkillableError) Error() string {
+	return fmt.Sprintf("deputy: process %d could not be killed", e.Pid)
+}
+
+// Is reports whether target is ErrUnkillable.
+func (e *UnkillableError) Is(target error) bool {
+	return target == ErrUnkillable
+}
+
+// reap waits for a killed command to be waited for, so that its exit status is
+// recorded and no goroutine is left behind.  If the pipes being read aren't
+// closed within killDrain or WaitDelay, which happens when the command's own children hold
+// them open, they are closed from this end.  A command that still hasn't
+// been waited for after that is left to a background goroutine, and if the
+// process itself hasn't exited, an *UnkillableError is returned.
+func (d Deputy) reap(cmd *exec.Cmd, done <-chan error) error {
+	drain := killDrain
+	if d.WaitDelay > 0 {
+		drain = d.WaitDelay
 	}
-	if d.stderrPipe != nil {
-		go pipe(d.StderrLog, d.stderrPipe, errs)
+	t := time.NewTimer(drain)
+	defer t.Stop()
+	select {
+	case <-done:
+		d.exited(cmd)
+		return nil
+	case <-t.C:
+	}
+	d.logf(Debug, "deputy: pid %d was killed but its output hasn't ended; closing its pipes", cmd.Process.Pid)
+	d.closePipes()
+	t.Reset(killDrain)
+	select {
+	case <-done:
+		d.exited(cmd)
+		return nil
+	case <-t.C:
+	}
+	if d.Reaped != nil {
+		go func() {
+			<-done
+			d.Reaped(cmd.Process.Pid, cmd.ProcessState.ExitCode())
+		}()
+	}
+	if processExited(cmd.Process.Pid) {
+		return nil
+	}
+	return &UnkillableError{Pid: cmd.Process.Pid}
+}
+
+func (d Deputy) start(cmd *exec.Cmd, done chan struct{}) error {
+	if isClosed(d.Cancel) {
+		return d.canceled(false)
+	}
+	if isClosed(d.jobCancel) {
+		return &CanceledError{}
+	}
+	if d.PreStart != nil {
+		if err := d.PreStart(cmd); err != nil {
+			d.closePipes()
+			return err
+		}
+	}
+	start := cmd.Start
+	if d.Umask != 0 {
+		start = func() error { return withUmask(d.Umask, cmd.Start) }
+	}
+	d.result.Start = time.Now()
+	if err := startTracked(cmd, start); err != nil {
+		return err
+	}
+	d.result.Pid = cmd.Process.Pid
+	d.logf(Normal, "deputy: started %s (pid %d)", describe(cmd.Args), cmd.Process.Pid)
+	if d.descendants != nil {
+		d.descendants.start(cmd.Process.Pid)
+	}
+	if d.Jobs != nil {
+		d.Jobs.started(d.jobID, cmd, d.result.Start)
+	}
+	d.failures.started(cmd.Process)
+	if d.started != nil {
+		d.started()
+	}
+	if d.stdin != nil {
+		go d.stdin.run()
+	}
+
+	// stderr, or stdout if it is the only pipe, is read by wait itself, so
+	// only a second pipe needs a goroutine of its own.
+	if d.stdoutPipe != nil && d.stderrPipe != nil {
+		go pipe(d.StdoutLog, d.stdout(), Stdout, d.ReadBuffer, d.failures, done)
 	}
 	return nil
 }
 
-func (d Deputy) wait(cmd *exec.Cmd, errs <-chan error) error {
+func (d Deputy) wait(cmd *exec.Cmd, done chan struct{}) error {
+	if d.WaitDelay > 0 && (d.stdoutPipe != nil || d.stderrPipe != nil) {
+		return d.waitDelayed(cmd, done)
+	}
+	switch {
+	case d.stderrPipe != nil:
+		pipe(d.StderrLog, d.stderrPipe, Stderr, d.ReadBuffer, d.failures, done)
+	case d.stdoutPipe != nil:
+		pipe(d.StdoutLog, d.stdout(), Stdout, d.ReadBuffer, d.failures, done)
+	}
 	// Note that it's important that we wait for the pipes
 	// to be closed before calling cmd.Wait otherwise
 	// Wait can close the pipes before we have read
 	// all their data.
-	var err1, err2 error
 	if d.stdoutPipe != nil {
-		err1 = <-errs
+		<-done
 	}
 	if d.stderrPipe != nil {
-		err2 = <-errs
+		<-done
 	}
 	err := cmd.Wait()
-	return firstErr(err, err1, err2)
+	untrack(cmd.Process)
+	return err
 }
 
-func firstErr(errs ...error) error {
-	for _, err := range errs {
-		if err != nil {
-			return err
+// waitDelayed is wait for a Deputy with a WaitDelay.  Rather than waiting for
+// the pipes to close, which a child of the command can keep them from doing,
+// it watches for the command to exit, and closes the pipes if they are still
+// open WaitDelay after that.
+func (d Deputy) waitDelayed(cmd *exec.Cmd, done chan struct{}) error {
+	pipes := 0
+	for _, p := range []io.ReadCloser{d.stdoutPipe, d.stderrPipe} {
+		if p != nil {
+			pipes++
 		}
 	}
-	return nil
+	// start only reads the second of two pipes itself.
+	switch {
+	case d.stderrPipe != nil:
+		go pipe(d.StderrLog, d.stderrPipe, Stderr, d.ReadBuffer, d.failures, done)
+	case d.stdoutPipe != nil:
+		go pipe(d.StdoutLog, d.stdout(), Stdout, d.ReadBuffer, d.failures, done)
+	}
+	poll := time.NewTicker(exitPoll)
+	defer poll.Stop()
+	var deadline <-chan time.Time
+	closed := false
+	for pipes > 0 {
+		select {
+		case <-done:
+			pipes--
+		case <-poll.C:
+			if deadline == nil && !closed && processExited(cmd.Process.Pid) {
+				t := time.NewTimer(d.WaitDelay)
+				defer t.Stop()
+				deadline = t.C
+			}
+		case <-deadline:
+			d.logf(Debug, "deputy: pid %d exited but its output hasn't ended; closing its pipes", cmd.Process.Pid)
+			d.closePipes()
+			closed, deadline = true, nil
+		}
+	}
+	err := cmd.Wait()
+	untrack(cmd.Process)
+	if err == nil && closed {
+		return exec.ErrWaitDelay
+	}
+	return err
 }
 
-func pipe(log func([]byte), r io.Reader, errs chan<- error) {
+// closePipes closes the pipes the Deputy reads the command's output from.
+func (d Deputy) closePipes() {
+	for _, p := range []io.ReadCloser{d.stdoutPipe, d.stderrPipe} {
+		if p != nil {
+			_ = p.Close()
+		}
+	}
+	if d.stdin != nil {
+		_ = d.stdin.w.Close()
+	}
+}
+
+// pipeBuffers holds the buffers that pipes read lines into, so that each run
+// doesn't allocate and grow its own.
+var pipeBuffers = sync.Pool{New: func() interface{} {
+	b := make([]byte, bufio.MaxScanTokenSize)
+	return &b
+}}
+
+// pipe passes each line read from r to log, reading into a buffer of the given
+// size, or of the default size if it is zero.  Errors reading r, and panics in
+// log, are reported to failures.  On windows, the output is converted to
+// UTF-8 first, as decodeOutput describes.
+func pipe(log func([]byte), r io.Reader, stream Stream, size int, failures *pipeFailures, done chan<- struct{}) {
+	r, log = decodeOutput(r, log)
+	var buf []byte
+	if size <= 0 || size == bufio.MaxScanTokenSize {
+		pooled := pipeBuffers.Get().(*[]byte)
+		defer pipeBuffers.Put(pooled)
+		buf = *pooled
+	} else {
+		buf = make([]byte, size)
+	}
 	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		b := scanner.Bytes()
-		log(b)
+	scanner.Buffer(buf, len(buf))
+	if !scanLines(scanner, log, stream, failures) {
+		// keep the command from blocking on a full pipe.
+		_, _ = io.Copy(io.Discard, r)
+	}
+	// a pipe closed by reap has been given up on, which isn't an error.
+	if err := scanner.Err(); err != nil && !errors.Is(err, os.ErrClosed) {
+		failures.fail(&PipeError{Stream: stream, Err: err})
+		_, _ = io.Copy(io.Discard, r)
 	}
+	done <- struct{}{}
+}
 
-	errs <- scanner.Err()
+// scanLines passes each line from scanner to log.  If log panics, the panic
+// is reported to failures and scanLines returns false.
+func scanLines(scanner *bufio.Scanner, log func([]byte), stream Stream, failures *pipeFailures) (ok bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			failures.panicked(&CallbackPanicError{Stream: stream, Value: v, Stack: debug.Stack()})
+			ok = false
+		}
+	}()
+	for scanner.Scan() {
+		// the line is only valid until the next Scan, which is all that log
+		// functions are promised, so it is passed on without copying.
+		log(scanner.Bytes())
+	}
+	return true
 }
@@ -2,9 +2,12 @@ package deputy
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
@@ -41,8 +44,9 @@ func TestRunCancel(t *testing.T) {
 		t.Fatal("goroutine never cancelled!")
 	}
 
-	if err != nil {
-		t.Fatalf("unexpected error returned from Run: %v", err)
+	var cerr *CanceledError
+	if !errors.As(err, &cerr) || !cerr.Started || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a CanceledError from Run, got %v", err)
 	}
 }
 
@@ -142,6 +146,74 @@ func TestLogs(t *testing.T) {
 	}
 }
 
+func TestLogsAndErr(t *testing.T) {
+	output := "foooo"
+	cmd := maker{
+		stderr: output,
+		exit:   1,
+	}.make()
+	var logerr []byte
+	err := Deputy{
+		Errors:    FromStderr,
+		StderrLog: func(b []byte) { logerr = append([]byte(nil), b...) },
+	}.Run(cmd)
+	if err == nil || !strings.HasSuffix(err.Error(), output) {
+		t.Fatalf("Expected output of %q but got %v", output, err)
+	}
+	if string(logerr) != output {
+		t.Fatalf("expected stderr to be %q but got %q", output, logerr)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := (Deputy{Errors: FromStdout}).Validate(); err != nil {
+		t.Fatalf("unexpected error from Validate: %v", err)
+	}
+	if err := (Deputy{Errors: ErrorHandling(42)}).Validate(); err == nil {
+		t.Fatal("expected error from Validate for invalid ErrorHandling")
+	}
+	cmd := maker{}.make()
+	err := Deputy{Errors: ErrorHandling(42)}.Run(cmd)
+	if err == nil {
+		t.Fatal("expected error from Run with invalid config")
+	}
+	if cmd.Process != nil {
+		t.Fatal("command was started despite invalid config")
+	}
+}
+
+func TestLogWithStdoutSet(t *testing.T) {
+	cmd := maker{}.make()
+	cmd.Stdout = &bytes.Buffer{}
+	err := Deputy{StdoutLog: func([]byte) {}}.Run(cmd)
+	if err == nil || !strings.Contains(err.Error(), "StdoutLog") {
+		t.Fatalf("expected error about StdoutLog but got %v", err)
+	}
+}
+
+func TestPassthrough(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cmd := maker{stdout: "foo!"}.make()
+	cmd.Stdout = f
+	if err := (Deputy{Timeout: time.Minute, Jobs: &Jobs{}}).Run(cmd); err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	if cmd.Stdout != f {
+		t.Fatalf("expected the command's stdout to be left as the file, got %T", cmd.Stdout)
+	}
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "foo!" {
+		t.Fatalf("expected %q written to file, got %q", "foo!", b)
+	}
+}
+
 type maker struct {
 	stdout  string
 	stderr  string
@@ -155,6 +227,10 @@ const (
 	helperStderr  = "GO_HELPER_PROCESS_STDERR"
 	helperExit    = "GO_HELPER_PROCESS_EXIT_CODE"
 	helperTimeout = "GO_HELPER_PROCESS_TIMEOUT"
+	// helperWriteFile names an inherited file the helper writes a greeting to.
+	helperWriteFile = "GO_HELPER_PROCESS_WRITE_FILE"
+	// helperEarlyStdout is written to stdout before the helper's timeout.
+	helperEarlyStdout = "GO_HELPER_PROCESS_EARLY_STDOUT"
 )
 
 func (m maker) make() *exec.Cmd {
@@ -185,7 +261,18 @@ func TestHelperProcess(*testing.T) {
 		fmt.Fprintf(os.Stderr, "error converting timeout: %s", err)
 		os.Exit(2)
 	}
+	if early := os.Getenv(helperEarlyStdout); early != "" {
+		fmt.Fprintln(os.Stdout, early)
+	}
 	<-time.After(time.Duration(int64(nanos)) * time.Nanosecond)
+	if name := os.Getenv(helperWriteFile); name != "" {
+		f, err := InheritedFile(name)
+		if err != nil || f == nil {
+			fmt.Fprintf(os.Stderr, "error getting inherited file: %v", err)
+			os.Exit(2)
+		}
+		fmt.Fprintln(f, "hello from the child")
+	}
 	if stderr := os.Getenv(helperStderr); stderr != "" {
 		fmt.Fprint(os.Stderr, stderr)
 	}
@@ -193,3 +280,96 @@ func TestHelperProcess(*testing.T) {
 		fmt.Fprint(os.Stdout, stdout)
 	}
 }
+
+func TestInheritStdio(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	old := os.Stdout
+	os.Stdout = f
+	defer func() { os.Stdout = old }()
+
+	if err := (Deputy{InheritStdio: true}).Run(maker{stdout: "plain"}.make()); err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	var logged string
+	d := Deputy{InheritStdio: true, StdoutLog: func(b []byte) { logged = string(b) }}
+	if err := d.Run(maker{stdout: "logged"}.make()); err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	os.Stdout = old
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "plainlogged\n" || logged != "logged" {
+		t.Fatalf("unexpected output %q, logged %q", b, logged)
+	}
+}
+
+func TestQuiet(t *testing.T) {
+	var logged []Line
+	d := Deputy{
+		Quiet: 1024,
+		Log:   func(l Line) { logged = append(logged, Line{Stream: l.Stream, Text: append([]byte(nil), l.Text...)}) },
+	}
+	if err := d.Run(maker{stdout: "fine", stderr: "warning"}.make()); err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	if len(logged) != 0 {
+		t.Fatalf("expected no output from a command that succeeded, got %q", logged)
+	}
+	if err := d.Run(maker{stdout: "out", stderr: "broken", exit: 1}.make()); err == nil {
+		t.Fatal("expected error from a failing command")
+	}
+	if len(logged) != 2 {
+		t.Fatalf("expected the held output of a failing command, got %q", logged)
+	}
+	for _, l := range logged {
+		if want := map[Stream]string{Stdout: "out", Stderr: "broken"}[l.Stream]; string(l.Text) != want {
+			t.Errorf("expected %s line %q, got %q", l.Stream, want, l.Text)
+		}
+	}
+
+	logged = nil
+	d.CollectArtifacts = []string{"*"}
+	d.ArtifactStore = ArtifactStoreFunc(func(name, path string) error { return errors.New("store is down") })
+	cmd := maker{stdout: "fine"}.make()
+	cmd.Dir = t.TempDir()
+	if err := os.WriteFile(filepath.Join(cmd.Dir, "report.xml"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Run(cmd); !errors.Is(err, ErrArtifact) {
+		t.Fatalf("expected an artifact error, got %v", err)
+	}
+	if len(logged) != 1 || string(logged[0].Text) != "fine" {
+		t.Fatalf("expected the held output of a run that failed after the command, got %q", logged)
+	}
+}
+
+func TestStdoutWriter(t *testing.T) {
+	var raw bytes.Buffer
+	var lines []Line
+	d := Deputy{
+		Errors:       FromStderr,
+		Log:          func(l Line) { lines = append(lines, Line{Stream: l.Stream, Text: append([]byte(nil), l.Text...)}) },
+		StdoutWriter: &raw,
+	}
+	err := d.Run(maker{stdout: "raw\nbytes", stderr: "broken", exit: 1}.make())
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Fatalf("expected the error text from stderr, got %v", err)
+	}
+	if raw.String() != "raw\nbytes" {
+		t.Fatalf("expected stdout written as is, got %q", raw.String())
+	}
+	if len(lines) != 1 || lines[0].Stream != Stderr || string(lines[0].Text) != "broken" {
+		t.Fatalf("expected only stderr to be logged, got %q", lines)
+	}
+
+	d = Deputy{StdoutWriter: &raw, StdoutLog: func([]byte) {}}
+	if err := d.Validate(); err == nil {
+		t.Fatal("expected an error using StdoutLog with StdoutWriter")
+	}
+}
@@ -0,0 +1,69 @@
+package deputy
+
+import (
+	"sync"
+	"time"
+)
+
+// descendantTracker polls for the descendants of a running command and
+// remembers every one it sees.
+type descendantTracker struct {
+	every time.Duration
+
+	mu    sync.Mutex
+	seen  map[int]bool
+	procs []ProcInfo
+	peak  int
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// start starts polling for the descendants of pid.
+func (t *descendantTracker) start(pid int) {
+	t.seen = map[int]bool{}
+	t.stop = make(chan struct{})
+	t.done = make(chan struct{})
+	go func() {
+		defer close(t.done)
+		tick := time.NewTicker(t.every)
+		defer tick.Stop()
+		for {
+			t.poll(pid)
+			select {
+			case <-tick.C:
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+}
+
+// poll records the current descendants of pid.
+func (t *descendantTracker) poll(pid int) {
+	procs := descendants(pid)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(procs) > t.peak {
+		t.peak = len(procs)
+	}
+	for _, p := range procs {
+		if !t.seen[p.Pid] {
+			t.seen[p.Pid] = true
+			t.procs = append(t.procs, p)
+		}
+	}
+}
+
+// finish stops polling and returns every descendant seen, in the order they
+// were first seen, and the most that were seen at once.  It may be called even
+// if polling never started.
+func (t *descendantTracker) finish() (procs []ProcInfo, peak int) {
+	if t.stop == nil {
+		return nil, 0
+	}
+	close(t.stop)
+	<-t.done
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.procs, t.peak
+}
@@ -0,0 +1,102 @@
+package deputy
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Embedded is a program that has been extracted from a file system (usually an
+// embed.FS) into a private temporary directory so that it can be run.  Call
+// Close to remove it when it's no longer needed.
+type Embedded struct {
+	// Path is the location of the extracted program.
+	Path string
+
+	dir string
+}
+
+// Extract copies the file called name out of fsys into a new temporary
+// directory only accessible by the current user, and makes it executable.  On
+// windows, ".exe" is appended to the program's name if it doesn't already
+// have it.
+func Extract(fsys fs.FS, name string) (*Embedded, error) {
+	src, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	dir, err := os.MkdirTemp("", "deputy-")
+	if err != nil {
+		return nil, err
+	}
+	base := path.Base(name)
+	if runtime.GOOS == "windows" && !strings.EqualFold(filepath.Ext(base), ".exe") {
+		base += ".exe"
+	}
+	e := &Embedded{Path: filepath.Join(dir, base), dir: dir}
+	if err := e.write(src); err != nil {
+		e.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *Embedded) write(src io.Reader) error {
+	f, err := os.OpenFile(e.Path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0700)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Command returns an exec.Cmd that runs the extracted program with args.
+func (e *Embedded) Command(args ...string) *exec.Cmd {
+	return exec.Command(e.Path, args...)
+}
+
+// Close removes the extracted program and its temporary directory.
+func (e *Embedded) Close() error {
+	return os.RemoveAll(e.dir)
+}
+
+// RunEmbedded extracts the program called name from fsys, runs it with args,
+// and removes it again once it has finished.  As with Run, opts apply to this
+// call only.
+//
+// If another process forked while the program was being written, starting it
+// can briefly fail with "text file busy" on some systems, so starting is
+// retried a few times in that case.
+func (d Deputy) RunEmbedded(fsys fs.FS, name string, args []string, opts ...Option) error {
+	e, err := Extract(fsys, name)
+	if err != nil {
+		return err
+	}
+	defer e.Close()
+
+	for delay := 10 * time.Millisecond; ; delay *= 2 {
+		cmd := e.Command(args...)
+		err = d.Run(cmd, opts...)
+		if cmd.Process != nil || !errors.Is(err, syscall.ETXTBSY) || delay > time.Second {
+			return err
+		}
+		time.Sleep(delay)
+	}
+}
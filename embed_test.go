@@ -0,0 +1,51 @@
+package deputy
+
+import (
+	"os"
+	"runtime"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRunEmbedded(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a shell script")
+	}
+	var lines []string
+	fsys := fstest.MapFS{
+		"bin/hello": &fstest.MapFile{Data: []byte("#!/bin/sh\necho hello \"$1\"\n")},
+	}
+	var res Result
+	d := Deputy{StdoutLog: func(b []byte) { lines = append(lines, string(b)) }}
+	err := d.RunEmbedded(fsys, "bin/hello", []string{"world"}, WithLabel("tool", "hello"), WithDefer(func(r Result) { res = r }))
+	if err != nil {
+		t.Fatalf("unexpected error returned from RunEmbedded: %v", err)
+	}
+	if len(lines) != 1 || lines[0] != "hello world" {
+		t.Fatalf("unexpected output %q", lines)
+	}
+	if res.Labels["tool"] != "hello" {
+		t.Fatalf("options weren't applied to the run: %+v", res)
+	}
+}
+
+func TestExtractClose(t *testing.T) {
+	fsys := fstest.MapFS{"tool": &fstest.MapFile{Data: []byte("data")}}
+	e, err := Extract(fsys, "tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(e.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm() != 0700 {
+		t.Fatalf("expected mode 0700 but got %v", fi.Mode().Perm())
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(e.Path); !os.IsNotExist(err) {
+		t.Fatalf("expected program to be removed, got %v", err)
+	}
+}
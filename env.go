@@ -0,0 +1,77 @@
+package deputy
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// setupEnv applies the Deputy's ClearEnv, EnvAllowlist, and Env settings to
+// the command's environment.
+func (d Deputy) setupEnv(cmd *exec.Cmd) {
+	if !d.ClearEnv && len(d.Env) == 0 {
+		return
+	}
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	if d.ClearEnv {
+		kept := make([]string, 0, len(d.EnvAllowlist))
+		for _, kv := range env {
+			if envAllowed(kv, d.EnvAllowlist) {
+				kept = append(kept, kv)
+			}
+		}
+		env = kept
+	}
+	cmd.Env = append(env[:len(env):len(env)], d.Env...)
+}
+
+// setEnv sets the environment variable name to value in the command's
+// environment, replacing any value it already has.
+func setEnv(cmd *exec.Cmd, name, value string) {
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	kept := make([]string, 0, len(env)+1)
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, name+"=") {
+			kept = append(kept, kv)
+		}
+	}
+	cmd.Env = append(kept, name+"="+value)
+}
+
+// envAllowed reports whether the name of the environment variable kv matches
+// one of the patterns in allow.  A pattern ending in * matches any name with
+// that prefix.
+func envAllowed(kv string, allow []string) bool {
+	name := kv
+	if i := strings.IndexByte(kv, '='); i >= 0 {
+		name = kv[:i]
+	}
+	for _, pattern := range allow {
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(name, pattern[:len(pattern)-1]) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// WithLocale sets the locale of the command by adding LANG and LC_ALL
+// variables for it to the Deputy's Env, and clearing LANGUAGE, so that tools
+// print untranslated messages and numbers in a predictable format.  This is
+// useful for parsing their output; WithLocale("C.UTF-8") is the usual choice
+// on linux, though some systems only provide "C".
+//
+// Windows programs don't take their code page from the environment, so on
+// windows this only affects programs that honor these variables.
+func WithLocale(locale string) Option {
+	return WithEnv("LANG="+locale, "LC_ALL="+locale, "LANGUAGE=")
+}
@@ -0,0 +1,57 @@
+package deputy
+
+import (
+	"os"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+)
+
+func TestClearEnv(t *testing.T) {
+	os.Setenv("DEPUTY_TEST_SECRET", "hunter2")
+	defer os.Unsetenv("DEPUTY_TEST_SECRET")
+	os.Setenv("DEPUTY_TEST_KEEP", "yes")
+	defer os.Unsetenv("DEPUTY_TEST_KEEP")
+
+	cmd := maker{}.make()
+	d := Deputy{
+		ClearEnv:     true,
+		EnvAllowlist: []string{"GO_HELPER_*", "DEPUTY_TEST_KEEP"},
+		Env:          []string{"EXTRA=1"},
+	}
+	cmd.Env = nil
+	d.setupEnv(cmd)
+	var names []string
+	for _, kv := range cmd.Env {
+		if kv == "EXTRA=1" || kv == "DEPUTY_TEST_KEEP=yes" {
+			names = append(names, kv)
+			continue
+		}
+		t.Errorf("unexpected variable %q", kv)
+	}
+	sort.Strings(names)
+	if want := []string{"DEPUTY_TEST_KEEP=yes", "EXTRA=1"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("expected %q but got %q", want, names)
+	}
+
+	// the helper's own variables are allowed through, so it still runs.
+	if err := d.Run(maker{}.make()); err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+}
+
+func TestWithLocale(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a unix shell")
+	}
+	cmd := shellCommand("echo $LANG $LC_ALL")
+	cmd.Env = []string{"LC_ALL=fr_FR.UTF-8"}
+	out, err := Output(cmd, WithLocale("C"))
+	if err != nil {
+		t.Fatalf("unexpected error returned from Output: %v", err)
+	}
+	if string(out) != "C C\n" {
+		t.Fatalf("unexpected output %q", out)
+	}
+}
@@ -0,0 +1,74 @@
+package deputy
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+)
+
+// sysexits are the exit codes from BSD's sysexits.h, which many unix tools
+// use.
+var sysexits = map[int]string{
+	64: "EX_USAGE: command line usage error",
+	65: "EX_DATAERR: data format error",
+	66: "EX_NOINPUT: cannot open input",
+	67: "EX_NOUSER: addressee unknown",
+	68: "EX_NOHOST: host name unknown",
+	69: "EX_UNAVAILABLE: service unavailable",
+	70: "EX_SOFTWARE: internal software error",
+	71: "EX_OSERR: system error",
+	72: "EX_OSFILE: critical OS file missing",
+	73: "EX_CANTCREAT: can't create output file",
+	74: "EX_IOERR: input/output error",
+	75: "EX_TEMPFAIL: temporary failure, try again",
+	76: "EX_PROTOCOL: remote error in protocol",
+	77: "EX_NOPERM: permission denied",
+	78: "EX_CONFIG: configuration error",
+}
+
+// ntstatus are the NTSTATUS codes that windows programs exit with when they
+// crash.
+var ntstatus = map[uint32]string{
+	0xC0000005: "STATUS_ACCESS_VIOLATION: the program crashed accessing invalid memory",
+	0xC000001D: "STATUS_ILLEGAL_INSTRUCTION: the program executed an illegal instruction",
+	0xC0000094: "STATUS_INTEGER_DIVIDE_BY_ZERO: the program divided by zero",
+	0xC00000FD: "STATUS_STACK_OVERFLOW: the program overflowed its stack",
+	0xC0000135: "STATUS_DLL_NOT_FOUND: a DLL the program needs was not found",
+	0xC0000142: "STATUS_DLL_INIT_FAILED: a DLL the program needs failed to initialize",
+	0xC000013A: "STATUS_CONTROL_C_EXIT: the program was ended by Ctrl-C",
+	0xC0000374: "STATUS_HEAP_CORRUPTION: the program corrupted its heap",
+	0xC0000409: "STATUS_STACK_BUFFER_OVERRUN: the program ended itself after detecting a fatal error",
+}
+
+// DescribeExitCode returns what a command's exit code conventionally means
+// on this platform, or "" if it has no conventional meaning.  It knows the
+// codes of sysexits.h, the shell's 126 and 127, the shell's 128 plus a
+// signal number for a command ended by that signal, and on windows the
+// NTSTATUS codes of programs that crashed.  Programs are free to use any
+// code for their own purposes, so the meaning is only a hint.
+func DescribeExitCode(code int) string {
+	return describeExitCode(code, runtime.GOOS)
+}
+
+// describeExitCode returns what code conventionally means on goos.
+func describeExitCode(code int, goos string) string {
+	if goos == "windows" {
+		if s, ok := ntstatus[uint32(code)]; ok {
+			return fmt.Sprintf("%s (0x%08X)", s, uint32(code))
+		}
+	}
+	if s, ok := sysexits[code]; ok {
+		return s
+	}
+	switch {
+	case goos == "windows":
+	case code == 126:
+		return "the command was found but could not be executed"
+	case code == 127:
+		return "the command was not found"
+	case code > 128 && code < 128+65:
+		sig := syscall.Signal(code - 128)
+		return fmt.Sprintf("ended by signal %d (%v)", int(sig), sig)
+	}
+	return ""
+}
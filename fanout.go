@@ -0,0 +1,98 @@
+package deputy
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// FanOut runs the same command on many hosts at once over ssh, in the manner
+// of pssh, using the system's ssh client.
+type FanOut struct {
+	// Deputy runs ssh for each of the Hosts.  Each line of output passed to
+	// its log functions and sinks is prefixed with the host and ": ".
+	Deputy Deputy
+	// Hosts are the hosts to run the command on, in any form ssh accepts,
+	// such as "user@host".
+	Hosts []string
+	// Targets are more targets to run the command on, after the Hosts.
+	Targets Inventory
+	// Selector, if set, limits the Targets the command runs on to those
+	// whose labels match it, as in Inventory.Select.  It doesn't apply to
+	// the Hosts.
+	Selector string
+	// Parallel is the most hosts the command runs on at the same time.  If
+	// it is zero or less, it runs on all of them at once.
+	Parallel int
+	// SSH is the ssh program and the options to run it with for the Hosts.
+	// It defaults to ssh with BatchMode on, so that ssh fails rather than
+	// prompting for a password.
+	SSH []string
+}
+
+// Run runs the command described by spec on every host and target, with opts
+// applied to the Deputy, and waits for all of them to finish.  On the hosts,
+// the command is run by the login shell in spec's Dir, with spec's Env added
+// to the environment.  It returns a Result for each host and then each
+// selected target, in order.  If the command failed on any of them, it also
+// returns a *MultiError, in which each Failure's Index is the position of the
+// host or target in the Results.
+func (f FanOut) Run(spec Spec, opts ...Option) ([]Result, error) {
+	targets, err := f.Targets.Select(f.Selector)
+	if err != nil {
+		return nil, err
+	}
+	inv := make(Inventory, 0, len(f.Hosts)+len(targets))
+	for _, h := range f.Hosts {
+		inv = append(inv, Host{Addr: h, Deputy: f.Deputy, SSH: f.SSH})
+	}
+	return append(inv, targets...).Run(spec, f.Parallel, opts...)
+}
+
+// Host is a Target reached over ssh, using the system's ssh client.
+type Host struct {
+	// Addr is the host, in any form ssh accepts, such as "user@host".  It
+	// is the target's name.
+	Addr string
+	// Tags are the target's labels.
+	Tags map[string]string
+	// Deputy runs ssh.
+	Deputy Deputy
+	// SSH is the ssh program and the options to run it with.  It defaults
+	// to ssh with BatchMode on, so that ssh fails rather than prompting for
+	// a password.
+	SSH []string
+}
+
+// Name implements Target.
+func (h Host) Name() string {
+	return h.Addr
+}
+
+// Labels implements Target.
+func (h Host) Labels() map[string]string {
+	return h.Tags
+}
+
+// Run implements Target.  The command is run by the login shell on the host,
+// in spec's Dir, with spec's Env added to the environment.
+func (h Host) Run(spec Spec, opts ...Option) (Result, error) {
+	ssh := h.SSH
+	if len(ssh) == 0 {
+		ssh = []string{"ssh", "-o", "BatchMode=yes"}
+	}
+	args := append(ssh[1:len(ssh):len(ssh)], "--", h.Addr, remoteCommand(spec))
+	return h.Deputy.RunResult(exec.Command(ssh[0], args...), opts...)
+}
+
+// remoteCommand returns the shell command that runs spec on a remote host.
+func remoteCommand(spec Spec) string {
+	var parts []string
+	if spec.Dir != "" {
+		parts = append(parts, "cd", Quote(spec.Dir), "&&")
+	}
+	if len(spec.Env) > 0 {
+		parts = append(parts, "env", Quote(spec.Env...))
+	}
+	parts = append(parts, Quote(append([]string{spec.Name}, spec.Args...)...))
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,45 @@
+//go:build unix
+
+package deputy
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestFanOut(t *testing.T) {
+	// the fake ssh gets "--", the host and the remote command.
+	fake := []string{"sh", "-c", `[ "$2" = bad ] && exit 255; echo "$3"`, "ssh"}
+	var mu sync.Mutex
+	var lines []string
+	log := func(l Line) {
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, string(l.Text))
+	}
+	f := FanOut{
+		Deputy: Deputy{Log: log},
+		Hosts:  []string{"one", "bad"},
+		Targets: Inventory{
+			Host{Addr: "two", Tags: map[string]string{"role": "db"}, SSH: fake, Deputy: Deputy{Log: log}},
+			Host{Addr: "three", SSH: fake},
+		},
+		Selector: "role=db",
+		SSH:      fake,
+	}
+	results, err := f.Run(Spec{Name: "echo", Args: []string{"it's"}, Env: []string{"A=1"}, Dir: "/tmp"})
+	var m *MultiError
+	if !errors.As(err, &m) || len(m.Failures) != 1 || m.Failures[0].Index != 1 {
+		t.Fatalf("expected the bad host to fail, got %v", err)
+	}
+	if len(results) != 3 || results[0].Err != nil || results[1].ExitCode != 255 {
+		t.Fatalf("expected a Result for each host, got %+v", results)
+	}
+	sort.Strings(lines)
+	want := `cd /tmp && env A=1 echo 'it'\''s'`
+	if len(lines) != 2 || lines[0] != "one: "+want || lines[1] != "two: "+want {
+		t.Fatalf("expected the remote command prefixed with each host, got %q", lines)
+	}
+}
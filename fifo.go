@@ -0,0 +1,118 @@
+package deputy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FIFO is a named pipe that a command can write its log to, for tools that
+// only log to a file rather than to stdout or stderr.  Add it to a Deputy's
+// FIFOs and pass its Path to the command, in its arguments or environment,
+// and the lines the command writes to it are handled like lines of Stream:
+// passed to the log function for Stream, to Log and to Sinks.  Named pipes
+// aren't supported on windows.
+type FIFO struct {
+	// Path is the path of the named pipe.
+	Path string
+	// Stream is the stream the lines written to the pipe are handled as.
+	Stream Stream
+
+	// dir is the temporary directory the pipe was made in.
+	dir string
+}
+
+// NewFIFO makes a named pipe called name in a new temporary directory, whose
+// lines are to be handled as lines of stream.  Call Remove to delete it once
+// it is no longer needed.
+func NewFIFO(name string, stream Stream) (*FIFO, error) {
+	if stream != Stdout && stream != Stderr {
+		return nil, fmt.Errorf("deputy: invalid FIFO stream %v", stream)
+	}
+	dir, err := os.MkdirTemp("", "deputy-fifo")
+	if err != nil {
+		return nil, err
+	}
+	f := &FIFO{Path: filepath.Join(dir, name), Stream: stream, dir: dir}
+	if err := mkfifo(f.Path); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("deputy: making FIFO: %v", err)
+	}
+	return f, nil
+}
+
+// Remove deletes the named pipe and the directory NewFIFO made for it.
+func (f *FIFO) Remove() error {
+	return os.RemoveAll(f.dir)
+}
+
+// readFIFOs starts reading the Deputy's FIFOs, passing their lines to the log
+// functions of their streams, and returns a function to call once the
+// command has exited, which waits for the rest of their output.  The log
+// functions are made safe to call from the FIFOs' goroutines as well as the
+// streams' own.
+func (d *Deputy) readFIFOs() (finish func(), err error) {
+	var readers, keepers []*os.File
+	closeAll := func(files []*os.File) {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}
+	for _, f := range d.FIFOs {
+		r, keep, err := openFIFO(f.Path)
+		if err != nil {
+			closeAll(readers)
+			closeAll(keepers)
+			return nil, fmt.Errorf("deputy: opening FIFO: %v", err)
+		}
+		readers, keepers = append(readers, r), append(keepers, keep)
+	}
+	locked := map[Stream]bool{}
+	done := make(chan struct{}, len(readers))
+	for i, r := range readers {
+		stream := d.FIFOs[i].Stream
+		log := &d.StdoutLog
+		if stream == Stderr {
+			log = &d.StderrLog
+		}
+		if *log != nil && !locked[stream] {
+			*log = lockedLog(*log)
+			locked[stream] = true
+		}
+		l := *log
+		if l == nil {
+			l = func([]byte) {}
+		}
+		go pipe(l, r, stream, d.ReadBuffer, d.failures, done)
+	}
+	return func() {
+		// once these are closed, the pipes end when the command's own
+		// writers are closed.
+		closeAll(keepers)
+		t := time.NewTimer(killDrain)
+		defer t.Stop()
+		for range readers {
+			select {
+			case <-done:
+			case <-t.C:
+				// a child of the command still holds a pipe open.
+				closeAll(readers)
+				<-done
+			}
+		}
+		closeAll(readers)
+	}, nil
+}
+
+// lockedLog returns a log function that calls log while holding a lock, so
+// that it can be called from more than one goroutine.
+func lockedLog(log func([]byte)) func([]byte) {
+	var mu sync.Mutex
+	return func(b []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		log(b)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package deputy
+
+import (
+	"errors"
+	"os"
+)
+
+// mkfifo is not supported on this platform.
+func mkfifo(path string) error {
+	return errors.New("named pipes are not supported on this platform")
+}
+
+// openFIFO is not supported on this platform.
+func openFIFO(path string) (r, keep *os.File, err error) {
+	return nil, nil, errors.New("named pipes are not supported on this platform")
+}
@@ -0,0 +1,29 @@
+//go:build unix
+
+package deputy
+
+import (
+	"os"
+	"syscall"
+)
+
+// mkfifo makes a named pipe at path.
+func mkfifo(path string) error {
+	return syscall.Mkfifo(path, 0600)
+}
+
+// openFIFO opens the named pipe at path for reading without waiting for a
+// writer, along with a writer of its own that keeps the reader from seeing
+// the end of the pipe before the command has opened it.
+func openFIFO(path string) (r, keep *os.File, err error) {
+	r, err = os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	keep, err = os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		r.Close()
+		return nil, nil, err
+	}
+	return r, keep, nil
+}
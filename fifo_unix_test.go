@@ -0,0 +1,42 @@
+//go:build unix
+
+package deputy
+
+import (
+	"os"
+	"sort"
+	"testing"
+)
+
+func TestFIFO(t *testing.T) {
+	f, err := NewFIFO("log", Stderr)
+	if err != nil {
+		t.Fatalf("unexpected error from NewFIFO: %v", err)
+	}
+	defer f.Remove()
+	var lines []string
+	d := Deputy{
+		FIFOs: []*FIFO{f},
+		Log:   func(l Line) { lines = append(lines, l.Stream.String()+": "+string(l.Text)) },
+	}
+	if err := d.Shell("echo logged > " + f.Path + "; echo printed"); err != nil {
+		t.Fatalf("unexpected error returned from Shell: %v", err)
+	}
+	// the FIFO and stdout are read separately, so their lines may be
+	// handled in either order.
+	sort.Strings(lines)
+	if len(lines) != 2 || lines[0] != "stderr: logged" || lines[1] != "stdout: printed" {
+		t.Fatalf("expected the FIFO's line as stderr, got %q", lines)
+	}
+
+	// a command that never opens the FIFO doesn't hold up Run.
+	if err := d.Shell("exit 0"); err != nil {
+		t.Fatalf("unexpected error returned from Shell: %v", err)
+	}
+	if err := f.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(f.Path); !os.IsNotExist(err) {
+		t.Fatalf("expected the FIFO to be removed, got %v", err)
+	}
+}
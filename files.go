@@ -0,0 +1,70 @@
+package deputy
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FileEnvPrefix is the prefix of the environment variables that tell a child
+// which file descriptor each file passed with a Deputy's Files has.
+const FileEnvPrefix = "DEPUTY_FD_"
+
+// passFiles appends the Deputy's Files to cmd.ExtraFiles in name order, and
+// sets FileEnvPrefix+NAME=fd in the command's environment for each of them.
+func (d Deputy) passFiles(cmd *exec.Cmd) error {
+	if len(d.Files) == 0 {
+		return nil
+	}
+	if runtime.GOOS == "windows" {
+		return fmt.Errorf("deputy: passing Files is not supported on %s", runtime.GOOS)
+	}
+	names := make([]string, 0, len(d.Files))
+	for name := range d.Files {
+		if !validFileName(name) {
+			return fmt.Errorf("deputy: invalid file name %q, must be letters, digits, and underscores", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	for _, name := range names {
+		// ExtraFiles[i] becomes file descriptor 3+i in the child.
+		fd := 3 + len(cmd.ExtraFiles)
+		cmd.ExtraFiles = append(cmd.ExtraFiles, d.Files[name])
+		cmd.Env = append(cmd.Env, FileEnvPrefix+strings.ToUpper(name)+"="+strconv.Itoa(fd))
+	}
+	return nil
+}
+
+func validFileName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// InheritedFile returns the file passed to this process under name by a
+// parent process using a Deputy's Files, or nil if no such file was passed.
+func InheritedFile(name string) (*os.File, error) {
+	v, ok := os.LookupEnv(FileEnvPrefix + strings.ToUpper(name))
+	if !ok {
+		return nil, nil
+	}
+	fd, err := strconv.Atoi(v)
+	if err != nil || fd < 3 {
+		return nil, fmt.Errorf("deputy: invalid file descriptor %q for %s", v, name)
+	}
+	return os.NewFile(uintptr(fd), name), nil
+}
@@ -0,0 +1,45 @@
+package deputy
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestFiles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("extra files are not supported on windows")
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	cmd := maker{}.make()
+	cmd.Env = append(cmd.Env, helperWriteFile+"=status")
+	err = Deputy{}.Run(cmd, WithFiles(map[string]*os.File{"status": w}))
+	w.Close()
+	if err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(b)); got != "hello from the child" {
+		t.Fatalf("unexpected data from child %q", got)
+	}
+}
+
+func TestFilesInvalidName(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("extra files are not supported on windows")
+	}
+	err := Deputy{Files: map[string]*os.File{"bad-name": os.Stdin}}.Run(maker{}.make())
+	if err == nil {
+		t.Fatal("expected error for invalid file name")
+	}
+}
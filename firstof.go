@@ -0,0 +1,33 @@
+package deputy
+
+import "errors"
+
+// RunFirstOf runs the commands described by specs in order, until one of them
+// starts and succeeds, for when any of several programs will do, such as rg
+// with grep as a fallback.  It returns the Result of the command that
+// succeeded, whose Alternative is its index in specs.  The output of the
+// commands that failed has already been logged by then.  If every command
+// fails, it returns the Result of the last one and a *MultiError holding all
+// of them.  A command that is canceled isn't followed by the rest.
+func (d Deputy) RunFirstOf(specs ...Spec) (Result, error) {
+	if len(specs) == 0 {
+		return Result{}, errors.New("deputy: RunFirstOf needs at least one command")
+	}
+	m := &MultiError{Total: len(specs)}
+	var res Result
+	for i, spec := range specs {
+		d.alternative = i
+		var err error
+		res, err = d.RunResult(spec.Command())
+		if err == nil {
+			return res, nil
+		}
+		m.Failures = append(m.Failures, Failure{Index: i, Result: res})
+		var canceled *CanceledError
+		if errors.As(err, &canceled) {
+			break
+		}
+		d.logf(Normal, "deputy: trying the next command after %s failed: %v", describe(res.Args), err)
+	}
+	return res, m
+}
@@ -0,0 +1,33 @@
+package deputy
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestRunFirstOf(t *testing.T) {
+	helper := func(m maker) Spec {
+		return Spec{Name: os.Args[0], Args: []string{"-test.run=TestHelperProcess"}, Env: m.make().Env}
+	}
+	var stdout string
+	d := Deputy{StdoutLog: func(b []byte) { stdout = string(b) }}
+	res, err := d.RunFirstOf(
+		Spec{Name: "deputy-no-such-program"},
+		helper(maker{stdout: "failed", exit: 1}),
+		helper(maker{stdout: "fallback"}),
+		helper(maker{stdout: "never run"}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error returned from RunFirstOf: %v", err)
+	}
+	if res.Alternative != 2 || stdout != "fallback" {
+		t.Fatalf("expected the third command to run, got %d with %q", res.Alternative, stdout)
+	}
+
+	res, err = d.RunFirstOf(Spec{Name: "deputy-no-such-program"}, helper(maker{exit: 3}))
+	var m *MultiError
+	if !errors.As(err, &m) || len(m.Failures) != 2 || res.ExitCode != 3 || res.Alternative != 1 {
+		t.Fatalf("expected both commands to fail, got %v and %+v", err, res)
+	}
+}
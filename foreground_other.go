@@ -0,0 +1,14 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package deputy
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// foreground is not supported on this platform.
+func foreground(cmd *exec.Cmd, raw bool) (restore func(), err error) {
+	return nil, fmt.Errorf("deputy: Foreground is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,51 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package deputy
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// foreground sets cmd up to be started as the foreground process group of
+// this process's controlling terminal, in raw mode if raw is true.  The
+// returned function gives the terminal back to the group that had it, as it
+// was, and must be called once the command is done.
+func foreground(cmd *exec.Cmd, raw bool) (restore func(), err error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, errors.New("deputy: Foreground needs a controlling terminal")
+	}
+	var pgrp int32
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, tty.Fd(), syscall.TIOCGPGRP, uintptr(unsafe.Pointer(&pgrp))); e != 0 {
+		tty.Close()
+		return nil, os.NewSyscallError("ioctl", e)
+	}
+	unraw := func() error { return nil }
+	if raw {
+		if unraw, err = makeRaw(tty.Fd()); err != nil {
+			tty.Close()
+			return nil, err
+		}
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid = false
+	cmd.SysProcAttr.Setpgid = true
+	cmd.SysProcAttr.Foreground = true
+	cmd.SysProcAttr.Ctty = int(tty.Fd())
+	return func() {
+		defer tty.Close()
+		// a background process group taking the terminal back is sent
+		// SIGTTOU, which would stop this process.
+		signal.Ignore(syscall.SIGTTOU)
+		defer signal.Reset(syscall.SIGTTOU)
+		_, _, _ = syscall.Syscall(syscall.SYS_IOCTL, tty.Fd(), syscall.TIOCSPGRP, uintptr(unsafe.Pointer(&pgrp)))
+		_ = unraw()
+	}, nil
+}
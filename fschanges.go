@@ -0,0 +1,103 @@
+package deputy
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ChangeKind is how a file was changed during a run.
+type ChangeKind string
+
+const (
+	// FileCreated is a file that didn't exist before the run.
+	FileCreated ChangeKind = "created"
+	// FileModified is a file whose size, modification time or mode changed.
+	FileModified ChangeKind = "modified"
+	// FileDeleted is a file that no longer exists after the run.
+	FileDeleted ChangeKind = "deleted"
+)
+
+// FileChange is a change to a file under a Deputy's WatchFiles directory.
+type FileChange struct {
+	// Path is the file's path relative to the watched directory, in
+	// slash-separated form.
+	Path string `json:"path"`
+	// Kind is how the file was changed.
+	Kind ChangeKind `json:"kind"`
+}
+
+// fileState is what is compared to tell whether a file changed.
+type fileState struct {
+	size    int64
+	modTime time.Time
+	mode    fs.FileMode
+}
+
+// snapshotFiles returns the state of every file and directory under root,
+// by slash-separated path relative to root.  Entries that can't be read are
+// skipped.
+func snapshotFiles(root string) (map[string]fileState, error) {
+	if _, err := os.Stat(root); err != nil {
+		return nil, err
+	}
+	files := map[string]fileState{}
+	err := filepath.WalkDir(root, func(path string, e fs.DirEntry, err error) error {
+		if err != nil || path == root {
+			return nil
+		}
+		fi, err := e.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		st := fileState{mode: fi.Mode()}
+		if !fi.IsDir() {
+			// a directory's size and time change whenever its entries do,
+			// which is already reported for the entries themselves.
+			st.size, st.modTime = fi.Size(), fi.ModTime()
+		}
+		files[filepath.ToSlash(rel)] = st
+		return nil
+	})
+	return files, err
+}
+
+// diffFiles returns the changes from before to after, sorted by path.
+func diffFiles(before, after map[string]fileState) []FileChange {
+	var changes []FileChange
+	for path, st := range after {
+		old, ok := before[path]
+		switch {
+		case !ok:
+			changes = append(changes, FileChange{Path: path, Kind: FileCreated})
+		case old != st:
+			changes = append(changes, FileChange{Path: path, Kind: FileModified})
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changes = append(changes, FileChange{Path: path, Kind: FileDeleted})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// watchFiles snapshots the Deputy's WatchFiles directory, and returns a
+// function that records the changes since then in the Result.
+func (d Deputy) watchFiles() (finish func(), err error) {
+	before, err := snapshotFiles(d.WatchFiles)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		after, _ := snapshotFiles(d.WatchFiles)
+		d.result.FileChanges = diffFiles(before, after)
+	}, nil
+}
@@ -0,0 +1,61 @@
+package deputy
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestWatchFiles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	dir := t.TempDir()
+	for _, name := range []string{"keep", "change", "remove"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := shellCommand("echo more >> change; rm remove; mkdir sub; echo new > sub/file")
+	cmd.Dir = dir
+	res, err := Deputy{WatchFiles: dir}.RunResult(cmd)
+	if err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	want := []FileChange{
+		{Path: "change", Kind: FileModified},
+		{Path: "remove", Kind: FileDeleted},
+		{Path: "sub", Kind: FileCreated},
+		{Path: "sub/file", Kind: FileCreated},
+	}
+	if !reflect.DeepEqual(res.FileChanges, want) {
+		t.Fatalf("expected changes %+v, got %+v", want, res.FileChanges)
+	}
+
+	if err := (Deputy{WatchFiles: filepath.Join(dir, "missing")}).Run(maker{}.make()); err == nil {
+		t.Fatal("expected an error watching a missing directory")
+	}
+}
+
+func TestWatchFilesError(t *testing.T) {
+	sink := &testSink{}
+	missing := filepath.Join(t.TempDir(), "missing")
+	err := Deputy{WatchFiles: missing, Sinks: []Sink{sink}}.Run(maker{}.make())
+	if !os.IsNotExist(err) {
+		t.Fatalf("expected an error for the missing directory, got %v", err)
+	}
+	opens, closes := 0, 0
+	for _, call := range sink.calls {
+		switch call {
+		case "open":
+			opens++
+		case "close":
+			closes++
+		}
+	}
+	if opens != 1 || closes != 1 {
+		t.Fatalf("expected the sink to be opened and closed once, got %d opens and %d closes", opens, closes)
+	}
+}
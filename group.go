@@ -0,0 +1,383 @@
+package deputy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Service is a long-running command in a Group.
+type Service struct {
+	// Name identifies the service.  It is the id of the service's job in the
+	// group's registry, so it must not be empty, and no two services in a
+	// group may share it.
+	Name string
+	// Spec is the command to run.
+	Spec Spec
+	// Deputy runs the command.  Its Grace is how long the service is given to
+	// exit when the group shuts down.
+	Deputy Deputy
+	// After names the services that must be ready before this one is
+	// started.
+	After []string
+	// Ready, if set, says when the service is ready, once it has started.
+	// Without it, a service is ready as soon as it has started.
+	Ready Readiness
+	// ReadyTimeout is how long the service has to become ready.  Zero means
+	// a minute.
+	ReadyTimeout time.Duration
+}
+
+// defaultReadyTimeout is how long a service has to become ready, if its
+// ReadyTimeout isn't set.
+const defaultReadyTimeout = time.Minute
+
+// Group runs several long-running commands together, in the manner of a
+// Procfile runner.  The services are started one at a time, each after the
+// services it comes After are ready, and as soon as any of them exits, the
+// rest are stopped, one at a time in the reverse of the order they were
+// started in.  The services can be changed while the group is running with
+// Update.
+type Group struct {
+	// Services are the commands to run.  Services without an ordering between
+	// them are started in the order they are listed.
+	Services []Service
+
+	mu   sync.Mutex
+	jobs *Jobs
+	run  *groupRun
+}
+
+// Run starts every service and waits until they have all exited.  The group
+// shuts down when any service exits or doesn't become ready, or when cancel
+// is closed.  It returns a *MultiError describing the services that failed,
+// with the index each had in Services when it was started.  A service that
+// is stopped because the group is shutting down, or because Update removed
+// or changed it, has not failed, unless it couldn't be killed.
+func (g *Group) Run(cancel <-chan struct{}) error {
+	g.mu.Lock()
+	services := g.Services
+	g.mu.Unlock()
+	order, err := startOrder(services)
+	if err != nil || len(order) == 0 {
+		return err
+	}
+	r := &groupRun{jobs: &Jobs{}, stopping: make(chan struct{})}
+	g.mu.Lock()
+	g.jobs = r.jobs
+	g.run = r
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		g.run = nil
+		g.mu.Unlock()
+	}()
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-cancel:
+		case <-r.stopping:
+		}
+		r.stopAll()
+	}()
+	_ = r.startAll(services, order)
+	<-stopped
+	r.wg.Wait()
+
+	if len(r.failures) > 0 {
+		sort.Slice(r.failures, func(i, j int) bool { return r.failures[i].Index < r.failures[j].Index })
+		return &MultiError{Failures: r.failures, Total: len(services)}
+	}
+	return nil
+}
+
+// RunUntilSignal runs the group, as Run does, until it shuts down by itself,
+// ctx is done, or this process receives one of the given signals, which
+// default to os.Interrupt and SIGTERM.  The services are stopped gracefully,
+// each given its Deputy's Grace to exit.  The signals are only caught while
+// the group runs.
+func (g *Group) RunUntilSignal(ctx context.Context, sigs ...os.Signal) error {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	defer signal.Stop(ch)
+	cancel := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ch:
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
+		close(cancel)
+	}()
+	return g.Run(cancel)
+}
+
+// Update changes the group's services.  If the group is running, services
+// that have been removed, or whose Spec has changed, are stopped in the
+// reverse of the order they were started in, and then new and changed
+// services are started in order, as Run does.  Services that haven't changed
+// are left running.  Update returns an error if the new services' order is
+// invalid, leaving the group as it was, or if a service doesn't become ready,
+// in which case the group shuts down.
+func (g *Group) Update(services []Service) error {
+	order, err := startOrder(services)
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	g.Services = services
+	r := g.run
+	g.mu.Unlock()
+	if r == nil {
+		return nil
+	}
+
+	byName := map[string]int{}
+	for i, s := range services {
+		byName[s.Name] = i
+	}
+	keep := map[string]bool{}
+	running := r.running()
+	for j := len(running) - 1; j >= 0; j-- {
+		sr := running[j]
+		i, ok := byName[sr.s.Name]
+		if ok && reflect.DeepEqual(services[i].Spec, sr.s.Spec) {
+			keep[sr.s.Name] = true
+			continue
+		}
+		r.retire(sr)
+	}
+	var start []int
+	for _, i := range order {
+		if !keep[services[i].Name] {
+			start = append(start, i)
+		}
+	}
+	return r.startAll(services, start)
+}
+
+// startOrder returns the indexes of the services in the order they should be
+// started, so that each comes after the services it names in After.
+func startOrder(services []Service) ([]int, error) {
+	index := map[string]int{}
+	for i, s := range services {
+		if s.Name == "" {
+			return nil, fmt.Errorf("deputy: service %d has no name", i)
+		}
+		if _, ok := index[s.Name]; ok {
+			return nil, fmt.Errorf("deputy: more than one service is named %s", s.Name)
+		}
+		index[s.Name] = i
+	}
+	for _, s := range services {
+		for _, name := range s.After {
+			if _, ok := index[name]; !ok {
+				return nil, fmt.Errorf("deputy: service %s starts after unknown service %s", s.Name, name)
+			}
+		}
+	}
+	placed := make([]bool, len(services))
+	order := make([]int, 0, len(services))
+	for len(order) < len(services) {
+		next := -1
+		for i, s := range services {
+			if placed[i] {
+				continue
+			}
+			ok := true
+			for _, name := range s.After {
+				ok = ok && placed[index[name]]
+			}
+			if ok {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			return nil, errors.New("deputy: services have a cycle in their start order")
+		}
+		placed[next] = true
+		order = append(order, next)
+	}
+	return order, nil
+}
+
+// Status returns the jobs of the group's services from its current or last
+// run, oldest first.
+func (g *Group) Status() ([]Job, error) {
+	g.mu.Lock()
+	jobs := g.jobs
+	g.mu.Unlock()
+	if jobs == nil {
+		return nil, nil
+	}
+	return jobs.List()
+}
+
+// groupRun is the state of a single run of a Group.
+type groupRun struct {
+	jobs *Jobs
+	// stopping is closed once the group starts shutting down.
+	stopping chan struct{}
+	once     sync.Once
+	wg       sync.WaitGroup
+
+	mu sync.Mutex
+	// started holds the running services that haven't been retired, in the
+	// order they were started.
+	started  []*serviceRun
+	failures []Failure
+}
+
+// serviceRun is a run of a service in a group.
+type serviceRun struct {
+	index int
+	s     Service
+	// retired is set, while holding the group's lock, when the service is
+	// stopped by Update.
+	retired bool
+	// stop is closed to stop the service, and done is closed once it has
+	// exited.
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// startAll starts the services with the given indexes in order, waiting for
+// each that has a Ready to become ready before starting the next.  It stops
+// early if the group shuts down, and shuts the group down if a service
+// doesn't become ready.
+func (r *groupRun) startAll(services []Service, order []int) error {
+	for _, i := range order {
+		s := services[i]
+		if !r.start(i, s) {
+			return nil
+		}
+		if s.Ready == nil {
+			continue
+		}
+		if err := r.ready(s); err != nil {
+			err = fmt.Errorf("deputy: service %s not ready: %w", s.Name, err)
+			r.fail(i, Result{Err: err})
+			r.shutdown()
+			return err
+		}
+	}
+	return nil
+}
+
+// start starts service i, unless the group is shutting down, in which case
+// it returns false.
+func (r *groupRun) start(i int, s Service) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if isClosed(r.stopping) {
+		return false
+	}
+	sr := &serviceRun{index: i, s: s, stop: make(chan struct{}), done: make(chan struct{})}
+	r.started = append(r.started, sr)
+	r.wg.Add(1)
+	go r.run(sr)
+	return true
+}
+
+// run runs a service, shutting down the group when it exits, unless it was
+// retired.
+func (r *groupRun) run(sr *serviceRun) {
+	defer r.wg.Done()
+	d := sr.s.Deputy
+	d.Jobs = r.jobs
+	cancel, stop := mergeCancel(d.Cancel, sr.stop)
+	res, _ := d.RunResult(sr.s.Spec.Command(), WithCancel(cancel), WithJobID(sr.s.Name))
+	stop()
+	if res.Err != nil && (!isClosed(sr.stop) || errors.Is(res.Err, ErrUnkillable)) {
+		r.fail(sr.index, res)
+	}
+	r.mu.Lock()
+	retired := sr.retired
+	r.mu.Unlock()
+	close(sr.done)
+	if !retired {
+		r.shutdown()
+	}
+}
+
+// ready waits for the service to become ready, giving up if the group shuts
+// down first.
+func (r *groupRun) ready(s Service) error {
+	timeout := s.ReadyTimeout
+	if timeout == 0 {
+		timeout = defaultReadyTimeout
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- s.Ready.Ready(timeout) }()
+	select {
+	case err := <-errc:
+		return err
+	case <-r.stopping:
+		return nil
+	}
+}
+
+// fail records the failure of the service with index i.
+func (r *groupRun) fail(i int, res Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failures = append(r.failures, Failure{Index: i, Result: res})
+}
+
+// shutdown starts shutting the group down.
+func (r *groupRun) shutdown() {
+	r.once.Do(func() { close(r.stopping) })
+}
+
+// running returns the services that are running and not retired, in the
+// order they were started.
+func (r *groupRun) running() []*serviceRun {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*serviceRun(nil), r.started...)
+}
+
+// retire stops a service without shutting the group down, and waits for it
+// to exit.
+func (r *groupRun) retire(sr *serviceRun) {
+	r.mu.Lock()
+	sr.retired = true
+	for j, other := range r.started {
+		if other == sr {
+			r.started = append(r.started[:j:j], r.started[j+1:]...)
+			break
+		}
+	}
+	r.mu.Unlock()
+	sr.stopOnce.Do(func() { close(sr.stop) })
+	<-sr.done
+}
+
+// stopAll stops the running services in the reverse of the order they were
+// started in, waiting for each to exit before stopping the next.
+func (r *groupRun) stopAll() {
+	r.shutdown()
+	running := r.running()
+	for j := len(running) - 1; j >= 0; j-- {
+		sr := running[j]
+		sr.stopOnce.Do(func() { close(sr.stop) })
+		<-sr.done
+	}
+}
@@ -0,0 +1,207 @@
+package deputy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGroup(t *testing.T) {
+	g := &Group{Services: []Service{
+		{Name: "server", Spec: cmdSpec(maker{timeout: 10 * time.Second}.make())},
+		{Name: "worker", Spec: cmdSpec(maker{exit: 3, timeout: 100 * time.Millisecond}.make())},
+	}}
+	start := time.Now()
+	err := g.Run(nil)
+	var merr *MultiError
+	if !errors.As(err, &merr) || len(merr.Failures) != 1 || merr.Failures[0].Index != 1 {
+		t.Fatalf("expected only the worker to fail, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("server was not stopped when the worker exited")
+	}
+	jobs, err := g.Status()
+	if err != nil || len(jobs) != 2 {
+		t.Fatalf("unexpected status %+v, %v", jobs, err)
+	}
+	for _, j := range jobs {
+		if j.State != JobDone {
+			t.Fatalf("expected every service to be done, got %+v", j)
+		}
+	}
+}
+
+func TestGroupCancel(t *testing.T) {
+	g := &Group{Services: []Service{
+		{Name: "a", Spec: cmdSpec(maker{timeout: 10 * time.Second}.make())},
+		{Name: "b", Spec: cmdSpec(maker{timeout: 10 * time.Second}.make())},
+	}}
+	cancel := make(chan struct{})
+	time.AfterFunc(100*time.Millisecond, func() { close(cancel) })
+	if err := g.Run(cancel); err != nil {
+		t.Fatalf("unexpected error from canceled group: %v", err)
+	}
+}
+
+func TestGroupOrder(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a unix shell")
+	}
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	// each service notes when it starts and when it is stopped.
+	service := func(name string) Spec {
+		script := fmt.Sprintf("trap 'echo stop %[1]s >> %[2]s; exit 0' TERM; echo start %[1]s >> %[2]s; touch %[3]s; sleep 10 & wait",
+			name, log, filepath.Join(dir, name))
+		return cmdSpec(shellCommand(script))
+	}
+	grace := Deputy{Grace: 5 * time.Second}
+	g := &Group{Services: []Service{
+		{Name: "app", Spec: service("app"), Deputy: grace, After: []string{"db"}, Ready: FileReady(filepath.Join(dir, "app"))},
+		{Name: "db", Spec: service("db"), Deputy: grace, Ready: FileReady(filepath.Join(dir, "db"))},
+		{Name: "worker", Spec: service("worker"), Deputy: grace, After: []string{"app"}, Ready: FileReady(filepath.Join(dir, "worker"))},
+	}}
+	cancel := make(chan struct{})
+	done := make(chan error)
+	go func() { done <- g.Run(cancel) }()
+	if err := WaitForFile(filepath.Join(dir, "worker"), 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	close(cancel)
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error from group: %v", err)
+	}
+	b, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "start db\nstart app\nstart worker\nstop worker\nstop app\nstop db\n"
+	if string(b) != want {
+		t.Fatalf("expected order\n%s\nbut got\n%s", want, b)
+	}
+}
+
+func TestGroupBadOrder(t *testing.T) {
+	g := &Group{Services: []Service{
+		{Name: "a", After: []string{"b"}},
+		{Name: "b", After: []string{"a"}},
+	}}
+	if err := g.Run(nil); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("expected cycle error, got %v", err)
+	}
+	g = &Group{Services: []Service{{Name: "a", After: []string{"nope"}}}}
+	if err := g.Run(nil); err == nil || !strings.Contains(err.Error(), "unknown") {
+		t.Fatalf("expected unknown service error, got %v", err)
+	}
+}
+
+func TestGroupBadNames(t *testing.T) {
+	g := &Group{Services: []Service{{Name: "a"}, {}}}
+	if err := g.Run(nil); err == nil || !strings.Contains(err.Error(), "no name") {
+		t.Fatalf("expected an error for a service with no name, got %v", err)
+	}
+	g = &Group{Services: []Service{{Name: "a"}, {Name: "a"}}}
+	if err := g.Run(nil); err == nil || !strings.Contains(err.Error(), "more than one") {
+		t.Fatalf("expected an error for services with the same name, got %v", err)
+	}
+	if err := g.Update(g.Services); err == nil {
+		t.Fatal("expected Update to check the names too")
+	}
+}
+
+func TestGroupUpdate(t *testing.T) {
+	long := cmdSpec(maker{timeout: 10 * time.Second}.make())
+	changed := long
+	changed.Env = append(append([]string(nil), long.Env...), "CHANGED=1")
+	g := &Group{Services: []Service{{Name: "a", Spec: long}, {Name: "b", Spec: long}, {Name: "c", Spec: long}}}
+	cancel := make(chan struct{})
+	done := make(chan error)
+	go func() { done <- g.Run(cancel) }()
+	waitRunning := func(n int) {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			jobs, _ := g.Status()
+			running := 0
+			for _, j := range jobs {
+				if j.State == JobRunning {
+					running++
+				}
+			}
+			if running == n {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d services running, got %+v", n, jobs)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitRunning(3)
+	a, _ := g.Status()
+	pids := map[string]int{}
+	for _, j := range a {
+		pids[j.ID] = j.Pid
+	}
+
+	err := g.Update([]Service{{Name: "b", Spec: changed}, {Name: "c", Spec: long}, {Name: "d", Spec: long}})
+	if err != nil {
+		t.Fatalf("unexpected error from Update: %v", err)
+	}
+	waitRunning(3)
+	jobs, _ := g.Status()
+	state := map[string]Job{}
+	for _, j := range jobs {
+		state[j.ID] = j
+	}
+	if state["a"].State != JobDone {
+		t.Fatalf("removed service still running: %+v", state["a"])
+	}
+	if state["b"].Pid == pids["b"] {
+		t.Fatal("changed service was not restarted")
+	}
+	if state["c"].Pid != pids["c"] {
+		t.Fatal("unchanged service was restarted")
+	}
+	if state["d"].State != JobRunning {
+		t.Fatalf("added service not running: %+v", state["d"])
+	}
+	if err := g.Update([]Service{{Name: "x", After: []string{"y"}}}); err == nil {
+		t.Fatal("expected error updating to an invalid order")
+	}
+
+	close(cancel)
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error from group: %v", err)
+	}
+}
+
+func TestGroupRunUntilSignal(t *testing.T) {
+	g := &Group{Services: []Service{{Name: "a", Spec: cmdSpec(maker{timeout: 10 * time.Second}.make())}}}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := g.RunUntilSignal(ctx); err != nil {
+		t.Fatalf("unexpected error from group stopped by context: %v", err)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(100*time.Millisecond, func() { p.Signal(os.Interrupt) })
+	start := time.Now()
+	if err := g.RunUntilSignal(context.Background(), os.Interrupt); err != nil {
+		t.Fatalf("unexpected error from group stopped by signal: %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("group was not stopped by the signal")
+	}
+}
@@ -0,0 +1,109 @@
+package deputy
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// GzipSink is a Sink that streams lines of command output into a gzip
+// compressed file.  The compressed data is flushed to the file periodically,
+// so the file can be read while the command is running, and what was written
+// survives a crash.
+type GzipSink struct {
+	// Path is the file to write.  It is created, or truncated if it exists,
+	// when the sink is opened.
+	Path string
+	// FlushEvery, if positive, is how often compressed data is flushed to the
+	// file.
+	FlushEvery time.Duration
+	// BufferSize, if positive, is the size of a buffer kept between the
+	// compressor and the file, so that compressed data is written to the file
+	// in fewer, bigger writes.  It is flushed along with the compressor.
+	BufferSize int
+
+	mu   sync.Mutex
+	f    *os.File
+	bw   *bufio.Writer
+	zw   *gzip.Writer
+	done chan struct{}
+}
+
+// Open implements Sink.
+func (g *GzipSink) Open() error {
+	f, err := os.Create(g.Path)
+	if err != nil {
+		return err
+	}
+	g.f = f
+	g.bw = nil
+	var w io.Writer = f
+	if g.BufferSize > 0 {
+		g.bw = bufio.NewWriterSize(f, g.BufferSize)
+		w = g.bw
+	}
+	g.zw = gzip.NewWriter(w)
+	g.done = make(chan struct{})
+	if g.FlushEvery > 0 {
+		go g.flushLoop(g.FlushEvery, g.done)
+	}
+	return nil
+}
+
+func (g *GzipSink) flushLoop(every time.Duration, done <-chan struct{}) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			// errors will show up again in the next write or in Close.
+			_ = g.Flush()
+		case <-done:
+			return
+		}
+	}
+}
+
+// WriteLine implements Sink, writing the line's text and a newline.
+func (g *GzipSink) WriteLine(l Line) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, err := g.zw.Write(l.Text); err != nil {
+		return err
+	}
+	_, err := g.zw.Write([]byte{'\n'})
+	return err
+}
+
+// Flush implements Sink.
+func (g *GzipSink) Flush() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.zw.Flush(); err != nil {
+		return err
+	}
+	if g.bw != nil {
+		return g.bw.Flush()
+	}
+	return nil
+}
+
+// Close implements Sink, finishing the compressed stream and closing the file.
+func (g *GzipSink) Close() error {
+	close(g.done)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	err := g.zw.Close()
+	if g.bw != nil {
+		if ferr := g.bw.Flush(); err == nil {
+			err = ferr
+		}
+	}
+	if cerr := g.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
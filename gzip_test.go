@@ -0,0 +1,41 @@
+package deputy
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGzipSink(t *testing.T) {
+	for _, size := range []int{0, 4096} {
+		path := filepath.Join(t.TempDir(), "out.gz")
+		g := &GzipSink{Path: path, FlushEvery: time.Millisecond, BufferSize: size}
+		cmd := maker{
+			stdout: "foo!",
+			stderr: "bar!",
+		}.make()
+		if err := (Deputy{Sinks: []Sink{g}}).Run(cmd); err != nil {
+			t.Fatalf("unexpected error returned from Run: %v", err)
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := string(b); s != "foo!\nbar!\n" && s != "bar!\nfoo!\n" {
+			t.Fatalf("unexpected contents %q with buffer size %d", s, size)
+		}
+	}
+}
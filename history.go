@@ -0,0 +1,76 @@
+package deputy
+
+import (
+	"sync"
+	"time"
+)
+
+// History keeps the Results of the most recent runs of the Deputies that use
+// it, so that a long-running program can show its recent command activity,
+// such as on a debug page.  The zero value keeps nothing until Size is set.
+// A History is safe for concurrent use.
+type History struct {
+	// Size is how many Results are kept.  Once it is reached, each new
+	// Result replaces the oldest.  It must not be changed once the History
+	// is in use.
+	Size int
+
+	mu      sync.Mutex
+	results []Result
+	// next is the index in results of the oldest Result, once results is
+	// full.
+	next int
+}
+
+// add records res, dropping the oldest Result if the History is full.
+func (h *History) add(res Result) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.Size <= 0 {
+		return
+	}
+	if len(h.results) < h.Size {
+		h.results = append(h.results, res)
+		return
+	}
+	h.results[h.next] = res
+	h.next = (h.next + 1) % len(h.results)
+}
+
+// Results returns the kept Results, oldest first.
+func (h *History) Results() []Result {
+	return h.Query(nil)
+}
+
+// Query returns the kept Results that match reports true for, oldest first.
+// A nil match matches every Result.
+func (h *History) Query(match func(Result) bool) []Result {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var out []Result
+	for i := range h.results {
+		res := h.results[(h.next+i)%len(h.results)]
+		if match == nil || match(res) {
+			out = append(out, res)
+		}
+	}
+	return out
+}
+
+// Failed returns the kept Results of runs that failed, oldest first.
+func (h *History) Failed() []Result {
+	return h.Query(func(res Result) bool { return res.Err != nil })
+}
+
+// Since returns the kept Results of runs that started at or after t, oldest
+// first.
+func (h *History) Since(t time.Time) []Result {
+	return h.Query(func(res Result) bool { return !res.Start.Before(t) })
+}
+
+// Len returns how many Results are kept.
+func (h *History) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.results)
+}
@@ -0,0 +1,35 @@
+package deputy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	h := &History{Size: 3}
+	d := Deputy{History: h}
+	for _, code := range []int{0, 1, 2, 0} {
+		_ = d.Run(maker{exit: code}.make())
+	}
+	res := h.Results()
+	if len(res) != 3 || h.Len() != 3 {
+		t.Fatalf("expected the last 3 results, got %d", len(res))
+	}
+	for i, code := range []int{1, 2, 0} {
+		if res[i].ExitCode != code {
+			t.Fatalf("expected exit code %d for result %d, got %d", code, i, res[i].ExitCode)
+		}
+	}
+	if failed := h.Failed(); len(failed) != 2 || failed[0].ExitCode != 1 || failed[1].ExitCode != 2 {
+		t.Fatalf("expected the 2 failed runs, got %+v", failed)
+	}
+	if recent := h.Since(res[2].Start); len(recent) != 1 || recent[0].ExitCode != 0 {
+		t.Fatalf("expected only the last run, got %+v", recent)
+	}
+	if len(h.Since(time.Now())) != 0 {
+		t.Fatal("expected no runs started from now")
+	}
+	if got := (&History{}).Results(); len(got) != 0 {
+		t.Fatalf("expected a History without a Size to keep nothing, got %d", len(got))
+	}
+}
@@ -0,0 +1,398 @@
+package deputy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// JobState is the state of a job in a Jobs registry.
+type JobState int
+
+const (
+	// JobQueued means the run has begun, but the command hasn't started.
+	JobQueued JobState = iota
+	// JobRunning means the command is running.
+	JobRunning
+	// JobDone means the run is over, and the job's Result is set.
+	JobDone
+)
+
+// String returns the name of the state.
+func (s JobState) String() string {
+	switch s {
+	case JobQueued:
+		return "queued"
+	case JobRunning:
+		return "running"
+	case JobDone:
+		return "done"
+	}
+	return "unknown"
+}
+
+// Job is a snapshot of a run tracked by a Jobs registry.
+type Job struct {
+	// ID identifies the job in its registry.
+	ID string
+	// Spec describes the command being run, with the values of secrets
+	// redacted as described in Spec.MarshalJSON, so that they don't reach
+	// the registry's Store.
+	Spec Spec
+	// State is the state of the job.
+	State JobState
+	// Pid is the command's process id, once it has started.
+	Pid int
+	// Start is when the command started.
+	Start time.Time
+	// Result is the result of the run, once the job is done, with its
+	// arguments redacted the same way as the Spec's.
+	Result Result
+}
+
+// ErrNoJob is returned when a Jobs registry or JobStore has no job with the
+// requested id.
+var ErrNoJob = errors.New("deputy: no such job")
+
+// Jobs is a registry of the runs of the Deputies that use it, so that a
+// long-running program can report what it is running and what it has run.
+// The zero value is an empty registry, kept in memory, ready to use.  A Jobs
+// is safe for concurrent use.
+type Jobs struct {
+	// Store, if set, holds the registry's jobs and kept output, so that they
+	// can be shared between processes.  Jobs are kept in memory if it is nil.
+	Store JobStore
+	// MaxDone, if positive, is the most finished jobs kept.  When it is
+	// exceeded, the oldest finished jobs are forgotten.  So as not to list
+	// the whole Store every time a job finishes, this is done once for every
+	// MaxDone/8+1 jobs that finish, so up to that many more may be kept for
+	// a while.
+	MaxDone int
+	// KeepOutput, if positive, is how many bytes of output are kept for each
+	// job, for retrieval with Output.  Only the most recent lines are kept,
+	// the oldest being dropped once their total size exceeds this.
+	KeepOutput int
+	// StoreError, if set, is called with errors from the Store that happen
+	// while a command is running, which can't be returned from Run.  If it is
+	// nil, they are written to the standard logger.
+	StoreError func(error)
+
+	mu    sync.Mutex
+	mem   JobStore
+	local map[string]*localJob
+	// untrimmed counts the jobs finished since the last trim.
+	untrimmed int
+}
+
+// localJob is the bookkeeping needed to cancel a job run by this process.
+type localJob struct {
+	cancel chan struct{}
+	reason string
+}
+
+// store returns the registry's JobStore.
+func (j *Jobs) store() JobStore {
+	if j.Store != nil {
+		return j.Store
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.mem == nil {
+		j.mem = &MemoryJobStore{}
+	}
+	return j.mem
+}
+
+// storeError reports an error from the store that can't be returned.
+func (j *Jobs) storeError(err error) {
+	if err == nil {
+		return
+	}
+	if j.StoreError != nil {
+		j.StoreError(err)
+		return
+	}
+	log.Print(err)
+}
+
+// jobOutput keeps the output of a job in its registry's store.
+type jobOutput struct {
+	jobs  *Jobs
+	id    string
+	limit int
+}
+
+// log returns a log function that keeps lines of the given stream.
+func (o *jobOutput) log(stream Stream) func([]byte) {
+	return func(b []byte) {
+		line := Line{Stream: stream, Text: b}
+		o.jobs.storeError(o.jobs.store().AppendOutput(o.id, line, o.limit))
+	}
+}
+
+// Output returns the output kept for the job with the given id.  The output of
+// a running job is whatever it has written so far.  It returns ErrNoJob if
+// the registry has no such job.
+func (j *Jobs) Output(id string) ([]Line, error) {
+	return j.store().Output(id)
+}
+
+// Get returns the job with the given id, or ErrNoJob if the registry has no
+// such job.
+func (j *Jobs) Get(id string) (Job, error) {
+	return j.store().Get(id)
+}
+
+// Cancel stops the job with the given id, if it is queued or running, the same
+// way closing the Deputy's Cancel channel would, including giving the command
+// the Deputy's Grace period to exit.  The reason is recorded in the
+// CancelReason of the job's Result.  Only jobs run by this process can be
+// canceled.
+func (j *Jobs) Cancel(id, reason string) error {
+	j.mu.Lock()
+	job, ok := j.local[id]
+	if ok && !isClosed(job.cancel) {
+		job.reason = reason
+		close(job.cancel)
+	}
+	j.mu.Unlock()
+	if ok {
+		return nil
+	}
+	stored, err := j.Get(id)
+	switch {
+	case errors.Is(err, ErrNoJob):
+		return fmt.Errorf("deputy: no job with id %q", id)
+	case err != nil:
+		return err
+	case stored.State == JobDone:
+		return fmt.Errorf("deputy: job %q is already done", id)
+	}
+	return fmt.Errorf("deputy: job %q is not being run by this process", id)
+}
+
+// List returns every job in the registry, oldest first.
+func (j *Jobs) List() ([]Job, error) {
+	return j.store().List()
+}
+
+// Running returns the jobs whose commands are currently running, oldest
+// first.
+func (j *Jobs) Running() ([]Job, error) {
+	all, err := j.List()
+	if err != nil {
+		return nil, err
+	}
+	var jobs []Job
+	for _, job := range all {
+		if job.State == JobRunning {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+// add registers a new queued job for cmd, using id if it isn't empty.  It
+// returns the job's id, a channel that is closed if the job is canceled, and
+// the job's output if the registry keeps output.  A reused id replaces the old
+// job, unless it isn't done yet.
+func (j *Jobs) add(id string, cmd *exec.Cmd) (string, <-chan struct{}, *jobOutput, error) {
+	store := j.store()
+	local := &localJob{cancel: make(chan struct{})}
+	if id == "" {
+		id = newJobID()
+	}
+	// the id is claimed before the store is touched, so that two runs
+	// given the same id at once can't both take it.
+	j.mu.Lock()
+	if _, ok := j.local[id]; ok {
+		j.mu.Unlock()
+		return "", nil, nil, fmt.Errorf("deputy: job %q is still running", id)
+	}
+	if j.local == nil {
+		j.local = map[string]*localJob{}
+	}
+	j.local[id] = local
+	j.mu.Unlock()
+
+	err := j.replace(store, id)
+	if err == nil {
+		err = store.Put(Job{ID: id, Spec: jobSpec(cmd), State: JobQueued})
+	}
+	if err != nil {
+		j.mu.Lock()
+		delete(j.local, id)
+		j.mu.Unlock()
+		return "", nil, nil, err
+	}
+	var out *jobOutput
+	if j.KeepOutput > 0 {
+		out = &jobOutput{jobs: j, id: id, limit: j.KeepOutput}
+	}
+	return id, local.cancel, out, nil
+}
+
+// replace deletes the stored job with the given id, so that the id can be
+// reused, unless the job, which may belong to another process sharing the
+// store, isn't done yet.
+func (j *Jobs) replace(store JobStore, id string) error {
+	old, err := store.Get(id)
+	switch {
+	case errors.Is(err, ErrNoJob):
+		return nil
+	case err != nil:
+		return err
+	case old.State != JobDone:
+		return fmt.Errorf("deputy: job %q is still running", id)
+	}
+	return store.Delete(id)
+}
+
+// newJobID returns a random job id, so that registries in different processes
+// sharing a store don't hand out the same ids.
+func newJobID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// captureOutput arranges for the command's output to be kept in out, through
+// the Deputy's log functions where it has them and by teeing the command's
+// writers otherwise.  It returns a function to call once the command is done.
+func (d *Deputy) captureOutput(cmd *exec.Cmd, out *jobOutput) (flush func()) {
+	var writers []*lineWriter
+	if d.StdoutLog != nil {
+		d.StdoutLog = joinLogs(d.StdoutLog, out.log(Stdout))
+	} else {
+		w := &lineWriter{log: out.log(Stdout)}
+		cmd.Stdout = dualWriter(cmd.Stdout, w)
+		writers = append(writers, w)
+	}
+	if d.StderrLog != nil {
+		d.StderrLog = joinLogs(d.StderrLog, out.log(Stderr))
+	} else {
+		w := &lineWriter{log: out.log(Stderr)}
+		cmd.Stderr = dualWriter(cmd.Stderr, w)
+		writers = append(writers, w)
+	}
+	return func() {
+		for _, w := range writers {
+			w.flush()
+		}
+	}
+}
+
+// started marks the job as running.
+func (j *Jobs) started(id string, cmd *exec.Cmd, start time.Time) {
+	store := j.store()
+	job, err := store.Get(id)
+	if err != nil {
+		j.storeError(err)
+		return
+	}
+	job.Spec = jobSpec(cmd)
+	job.State = JobRunning
+	job.Pid = cmd.Process.Pid
+	job.Start = start
+	j.storeError(store.Put(job))
+}
+
+// finished marks the job as done, filling in the result's CancelReason if the
+// job was canceled.
+func (j *Jobs) finished(id string, res *Result) {
+	j.mu.Lock()
+	if local, ok := j.local[id]; ok {
+		if isClosed(local.cancel) {
+			res.CancelReason = local.reason
+		}
+		delete(j.local, id)
+	}
+	j.mu.Unlock()
+
+	store := j.store()
+	job, err := store.Get(id)
+	if err != nil {
+		j.storeError(err)
+		return
+	}
+	job.State = JobDone
+	job.Result = *res
+	job.Result.Args = redactArgs(res.Args)
+	if err := store.Put(job); err != nil {
+		j.storeError(err)
+		return
+	}
+	if j.trimDue() {
+		j.storeError(j.trim())
+	}
+}
+
+// trimDue reports whether enough jobs have finished since the last trim to
+// trim again.
+func (j *Jobs) trimDue() bool {
+	if j.MaxDone <= 0 {
+		return false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.untrimmed++
+	if j.untrimmed < j.MaxDone/8+1 {
+		return false
+	}
+	j.untrimmed = 0
+	return true
+}
+
+// trim forgets the oldest finished jobs beyond MaxDone.
+func (j *Jobs) trim() error {
+	jobs, err := j.store().List()
+	if err != nil {
+		return err
+	}
+	done := 0
+	for _, job := range jobs {
+		if job.State == JobDone {
+			done++
+		}
+	}
+	for _, job := range jobs {
+		if done <= j.MaxDone {
+			break
+		}
+		if job.State == JobDone {
+			if err := j.store().Delete(job.ID); err != nil {
+				return err
+			}
+			done--
+		}
+	}
+	return nil
+}
+
+// jobSpec returns a Spec describing cmd, with the values of secrets
+// redacted.
+func jobSpec(cmd *exec.Cmd) Spec {
+	s := cmdSpec(cmd)
+	s.Args = redactArgs(s.Args)
+	s.Env = redactEnv(s.Env)
+	return s
+}
+
+// cmdSpec returns a Spec describing cmd.
+func cmdSpec(cmd *exec.Cmd) Spec {
+	if cmd == nil {
+		return Spec{}
+	}
+	s := Spec{Name: cmd.Path, Env: cmd.Env, Dir: cmd.Dir}
+	if len(cmd.Args) > 1 {
+		s.Args = cmd.Args[1:]
+	}
+	return s
+}
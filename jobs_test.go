@@ -0,0 +1,238 @@
+package deputy
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobs(t *testing.T) {
+	jobs := &Jobs{}
+	d := Deputy{Jobs: jobs}
+
+	done := make(chan error)
+	go func() {
+		done <- d.Run(maker{timeout: 200 * time.Millisecond}.make(), WithJobID("slow"))
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for running, _ := jobs.Running(); len(running) == 0; running, _ = jobs.Running() {
+		if time.Now().After(deadline) {
+			t.Fatal("job never showed up as running")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	job, err := jobs.Get("slow")
+	if err != nil || job.State != JobRunning || job.Pid == 0 || job.Start.IsZero() {
+		t.Fatalf("unexpected running job %+v", job)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+
+	var res Result
+	if err := d.Run(maker{exit: 2}.make(), WithDefer(func(r Result) { res = r })); err == nil {
+		t.Fatal("expected error from Run")
+	}
+	list, _ := jobs.List()
+	if len(list) != 2 || list[0].ID != "slow" || list[1].ID != res.JobID {
+		t.Fatalf("unexpected jobs %+v", list)
+	}
+	if list[1].State != JobDone || list[1].Result.ExitCode != 2 {
+		t.Fatalf("unexpected finished job %+v", list[1])
+	}
+	if running, _ := jobs.Running(); len(running) != 0 {
+		t.Fatal("finished jobs still listed as running")
+	}
+}
+
+func TestJobsMaxDone(t *testing.T) {
+	jobs := &Jobs{MaxDone: 2}
+	var ids []string
+	d := Deputy{Jobs: jobs, Defer: []func(Result){func(r Result) { ids = append(ids, r.JobID) }}}
+	for i := 0; i < 4; i++ {
+		if err := d.Run(maker{}.make()); err != nil {
+			t.Fatalf("unexpected error returned from Run: %v", err)
+		}
+	}
+	list, _ := jobs.List()
+	if len(list) != 2 || list[0].ID != ids[2] || list[1].ID != ids[3] {
+		t.Fatalf("unexpected jobs %+v", list)
+	}
+}
+
+func TestJobsCancel(t *testing.T) {
+	jobs := &Jobs{}
+	var res Result
+	done := make(chan error)
+	go func() {
+		done <- Deputy{Jobs: jobs}.Run(maker{timeout: 5 * time.Second}.make(),
+			WithJobID("slow"), WithDefer(func(r Result) { res = r }))
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for running, _ := jobs.Running(); len(running) == 0; running, _ = jobs.Running() {
+		if time.Now().After(deadline) {
+			t.Fatal("job never showed up as running")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := jobs.Cancel("nope", "because"); err == nil {
+		t.Fatal("expected error canceling an unknown job")
+	}
+	if err := jobs.Cancel("slow", "user asked"); err != nil {
+		t.Fatalf("unexpected error from Cancel: %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("job was never canceled")
+	}
+	if res.CancelReason != "user asked" {
+		t.Fatalf("expected cancel reason in result, got %+v", res)
+	}
+	if job, _ := jobs.Get("slow"); job.State != JobDone || job.Result.CancelReason != "user asked" {
+		t.Fatalf("unexpected job after cancel %+v", job)
+	}
+	if err := jobs.Cancel("slow", "again"); err == nil {
+		t.Fatal("expected error canceling a finished job")
+	}
+}
+
+func TestJobsOutput(t *testing.T) {
+	jobs := &Jobs{KeepOutput: 1024}
+	out := &bytes.Buffer{}
+	cmd := maker{stdout: "foo!", stderr: "bar!"}.make()
+	cmd.Stdout = out
+	err := Deputy{Jobs: jobs, StderrLog: func([]byte) {}}.Run(cmd, WithJobID("job"))
+	if err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	if out.String() != "foo!" {
+		t.Fatalf("command's own stdout got %q", out)
+	}
+	lines, err := jobs.Output("job")
+	if err != nil || len(lines) != 2 {
+		t.Fatalf("unexpected output %v", lines)
+	}
+	for _, l := range lines {
+		want := map[Stream]string{Stdout: "foo!", Stderr: "bar!"}[l.Stream]
+		if string(l.Text) != want {
+			t.Errorf("expected %s line %q but got %q", l.Stream, want, l.Text)
+		}
+	}
+	if _, err := (&Jobs{}).Output("job"); !errors.Is(err, ErrNoJob) {
+		t.Fatalf("expected ErrNoJob from an empty registry, got %v", err)
+	}
+}
+
+func TestJobsOutputLimit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a unix shell")
+	}
+	jobs := &Jobs{KeepOutput: 8}
+	if err := (Deputy{Jobs: jobs}).Shell("printf 'one\\ntwo\\nthree'", WithJobID("job")); err != nil {
+		t.Fatalf("unexpected error returned from Shell: %v", err)
+	}
+	lines, _ := jobs.Output("job")
+	var got []string
+	for _, l := range lines {
+		got = append(got, string(l.Text))
+	}
+	if strings.Join(got, ",") != "three" {
+		t.Fatalf("expected only the last line to be kept, got %q", got)
+	}
+}
+
+func TestJobsStore(t *testing.T) {
+	store := &MemoryJobStore{}
+	first := &Jobs{Store: store, KeepOutput: 1024}
+	second := &Jobs{Store: store}
+	cmd := maker{stdout: "foo!"}.make()
+	if err := (Deputy{Jobs: first}).Run(cmd, WithJobID("job")); err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	job, err := second.Get("job")
+	if err != nil || job.State != JobDone {
+		t.Fatalf("expected finished job in shared store, got %+v, %v", job, err)
+	}
+	lines, err := second.Output("job")
+	if err != nil || len(lines) != 1 || string(lines[0].Text) != "foo!" {
+		t.Fatalf("unexpected output from shared store %v, %v", lines, err)
+	}
+	if err := second.Cancel("job", "late"); err == nil {
+		t.Fatal("expected error canceling a finished job")
+	}
+}
+
+func TestJobsStoreError(t *testing.T) {
+	err := Deputy{Jobs: &Jobs{Store: failingStore{}}}.Run(maker{}.make())
+	if err != errStore {
+		t.Fatalf("expected store error from Run, got %v", err)
+	}
+}
+
+var errStore = errors.New("store is down")
+
+// failingStore is a JobStore whose every call fails.
+type failingStore struct{}
+
+func (failingStore) Put(Job) error                        { return errStore }
+func (failingStore) Get(string) (Job, error)              { return Job{}, errStore }
+func (failingStore) List() ([]Job, error)                 { return nil, errStore }
+func (failingStore) Delete(string) error                  { return errStore }
+func (failingStore) AppendOutput(string, Line, int) error { return errStore }
+func (failingStore) Output(string) ([]Line, error)        { return nil, errStore }
+
+func TestJobsReusedID(t *testing.T) {
+	jobs := &Jobs{}
+	d := Deputy{Jobs: jobs}
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			errs <- d.Run(maker{timeout: 200 * time.Millisecond}.make(), WithJobID("same"))
+		}()
+	}
+	var failed int
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			if !strings.Contains(err.Error(), "still running") {
+				t.Fatalf("unexpected error returned from Run: %v", err)
+			}
+			failed++
+		}
+	}
+	if failed != 1 {
+		t.Fatalf("expected one of the runs to be refused the id, got %d", failed)
+	}
+	job, err := jobs.Get("same")
+	if err != nil || job.State != JobDone || job.Result.Err != nil {
+		t.Fatalf("expected the job that ran to be recorded, got %+v, %v", job, err)
+	}
+	if err := d.Run(maker{}.make(), WithJobID("same")); err != nil {
+		t.Fatalf("expected the id of a finished job to be reusable, got %v", err)
+	}
+}
+
+func TestJobsRedacted(t *testing.T) {
+	jobs := &Jobs{}
+	cmd := maker{}.make()
+	cmd.Args = append(cmd.Args, "--", "--token=abc")
+	cmd.Env = append(cmd.Env, "API_TOKEN=abc")
+	if err := (Deputy{Jobs: jobs}).Run(cmd, WithJobID("secret")); err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	job, err := jobs.Get("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range [][]string{job.Spec.Args, job.Spec.Env, job.Result.Args} {
+		if strings.Contains(strings.Join(s, " "), "abc") {
+			t.Fatalf("secret not redacted in the stored job: %q", s)
+		}
+	}
+	if cmd.Args[len(cmd.Args)-1] != "--token=abc" {
+		t.Fatal("redacting modified the command")
+	}
+}
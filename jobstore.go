@@ -0,0 +1,120 @@
+package deputy
+
+import "sync"
+
+// JobStore holds the jobs and kept output of a Jobs registry.  Implementations
+// backed by a database let several processes share one view of what they are
+// running.  A JobStore must be safe for concurrent use.
+type JobStore interface {
+	// Put saves job, replacing any job with the same ID.  A replaced job keeps
+	// its place in the order of List.
+	Put(job Job) error
+	// Get returns the job with the given id, or ErrNoJob.
+	Get(id string) (Job, error)
+	// List returns every job, in the order they were first put.
+	List() ([]Job, error)
+	// Delete forgets the job with the given id and its output.  Deleting a
+	// job that doesn't exist is not an error.
+	Delete(id string) error
+	// AppendOutput adds line to the output of the job with the given id, then
+	// drops the job's oldest lines while the total size of its lines, counting
+	// a newline after each, is more than limit.  The line's Text is only valid
+	// for the duration of the call.
+	AppendOutput(id string, line Line, limit int) error
+	// Output returns the output of the job with the given id, oldest line
+	// first, or ErrNoJob.
+	Output(id string) ([]Line, error)
+}
+
+// MemoryJobStore is a JobStore that keeps jobs in memory.  It is what a Jobs
+// registry uses when it has no Store.  The zero value is an empty store ready
+// to use.
+type MemoryJobStore struct {
+	mu    sync.Mutex
+	jobs  map[string]*memoryJob
+	order []string
+}
+
+// memoryJob is a job and its output.
+type memoryJob struct {
+	Job
+	output lineBuffer
+}
+
+// Put implements JobStore.
+func (s *MemoryJobStore) Put(job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.jobs[job.ID]; ok {
+		old.Job = job
+		return nil
+	}
+	if s.jobs == nil {
+		s.jobs = map[string]*memoryJob{}
+	}
+	s.jobs[job.ID] = &memoryJob{Job: job}
+	s.order = append(s.order, job.ID)
+	return nil
+}
+
+// Get implements JobStore.
+func (s *MemoryJobStore) Get(id string) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, ErrNoJob
+	}
+	return job.Job, nil
+}
+
+// List implements JobStore.
+func (s *MemoryJobStore) List() ([]Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]Job, 0, len(s.order))
+	for _, id := range s.order {
+		jobs = append(jobs, s.jobs[id].Job)
+	}
+	return jobs, nil
+}
+
+// Delete implements JobStore.
+func (s *MemoryJobStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[id]; !ok {
+		return nil
+	}
+	delete(s.jobs, id)
+	for i, oid := range s.order {
+		if oid == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// AppendOutput implements JobStore.
+func (s *MemoryJobStore) AppendOutput(id string, line Line, limit int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return ErrNoJob
+	}
+	job.output.add(line, limit)
+	return nil
+}
+
+// Output implements JobStore.
+func (s *MemoryJobStore) Output(id string) ([]Line, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, ErrNoJob
+	}
+	return append([]Line(nil), job.output.lines...), nil
+}
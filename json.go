@@ -0,0 +1,166 @@
+package deputy
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces the values of secrets when a Spec or Result is marshalled
+// to JSON.
+const Redacted = "REDACTED"
+
+// secretWords are the words that mark an environment variable or flag as
+// holding a secret.
+var secretWords = []string{
+	"PASSWORD", "PASSWD", "SECRET", "TOKEN", "APIKEY", "API_KEY", "CREDENTIAL", "PRIVATE_KEY",
+}
+
+// MarshalJSON marshals s to JSON.  The values of environment variables whose
+// names look like they hold secrets, such as DB_PASSWORD or GITHUB_TOKEN, are
+// replaced with Redacted, as are the values of similarly named flags in the
+// arguments, whether given as --token=value or --token value.
+func (s Spec) MarshalJSON() ([]byte, error) {
+	type spec Spec
+	s.Args = redactArgs(s.Args)
+	s.Env = redactEnv(s.Env)
+	return json.Marshal(spec(s))
+}
+
+// resultJSON is the JSON form of a Result.
+type resultJSON struct {
+	result
+	Err        string   `json:"error,omitempty"`
+	PipeErrors []string `json:"pipe_errors,omitempty"`
+}
+
+// result has the fields of Result without its methods.
+type result Result
+
+// MarshalJSON marshals r to JSON, with its errors as their text and its
+// arguments redacted the same way as Spec's.  Since error messages and the
+// Tail often repeat the command's arguments, the values of its secret flags
+// are also redacted wherever they appear in those, as are the values of
+// assignments to secret names, such as API_TOKEN=value.  Secrets that appear
+// in them some other way, or that are shorter than four bytes, are not.
+func (r Result) MarshalJSON() ([]byte, error) {
+	secrets := secretArgValues(r.Args)
+	r.Args = redactArgs(r.Args)
+	r.Tail = redactText(r.Tail, secrets)
+	j := resultJSON{result: result(r)}
+	if r.Err != nil {
+		j.Err = redactText(r.Err.Error(), secrets)
+	}
+	for _, err := range r.PipeErrors {
+		j.PipeErrors = append(j.PipeErrors, redactText(err.Error(), secrets))
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON unmarshals r from JSON.  The errors can only be restored as
+// errors with the same text.
+func (r *Result) UnmarshalJSON(b []byte) error {
+	var j resultJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	*r = Result(j.result)
+	if j.Err != "" {
+		r.Err = errors.New(j.Err)
+	}
+	for _, text := range j.PipeErrors {
+		r.PipeErrors = append(r.PipeErrors, errors.New(text))
+	}
+	return nil
+}
+
+// isSecret reports whether the environment variable or flag with the given
+// name looks like it holds a secret.
+func isSecret(name string) bool {
+	name = strings.ToUpper(strings.Replace(strings.TrimLeft(name, "-"), "-", "_", -1))
+	for _, w := range secretWords {
+		if strings.Contains(name, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactEnv returns a copy of env with the values of secrets redacted.
+func redactEnv(env []string) []string {
+	if env == nil {
+		return nil
+	}
+	out := make([]string, len(env))
+	for i, kv := range env {
+		out[i] = kv
+		if eq := strings.IndexByte(kv, '='); eq > 0 && isSecret(kv[:eq]) {
+			out[i] = kv[:eq+1] + Redacted
+		}
+	}
+	return out
+}
+
+// redactArgs returns a copy of args with the values of secret flags redacted.
+func redactArgs(args []string) []string {
+	if args == nil {
+		return nil
+	}
+	out := make([]string, len(args))
+	secretNext := false
+	for i, arg := range args {
+		out[i] = arg
+		switch {
+		case secretNext:
+			out[i] = Redacted
+			secretNext = false
+		case !strings.HasPrefix(arg, "-"):
+		case strings.IndexByte(arg, '=') > 0:
+			if eq := strings.IndexByte(arg, '='); isSecret(arg[:eq]) {
+				out[i] = arg[:eq+1] + Redacted
+			}
+		default:
+			secretNext = isSecret(arg)
+		}
+	}
+	return out
+}
+
+// secretArgValues returns the values of the secret flags in args.
+func secretArgValues(args []string) []string {
+	var values []string
+	for i, arg := range redactArgs(args) {
+		if arg == args[i] {
+			continue
+		}
+		v := args[i]
+		if strings.HasPrefix(v, "-") {
+			v = v[strings.IndexByte(v, '=')+1:]
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// assignmentPattern matches name=value pairs in text.
+var assignmentPattern = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_-]*)=([^\s'"]+)`)
+
+// redactText returns text with each of the secret values, and the values of
+// assignments to secret names, replaced with Redacted.  Values shorter than
+// four bytes are left alone, since replacing them would mangle the text
+// without hiding much.
+func redactText(text string, secrets []string) string {
+	for _, v := range secrets {
+		if len(v) >= 4 {
+			text = strings.Replace(text, v, Redacted, -1)
+		}
+	}
+	return assignmentPattern.ReplaceAllStringFunc(text, func(m string) string {
+		name, value, _ := strings.Cut(m, "=")
+		if !isSecret(name) || value == Redacted || len(value) < 4 {
+			return m
+		}
+		return name + "=" + Redacted
+	})
+}
@@ -0,0 +1,109 @@
+package deputy
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpecJSON(t *testing.T) {
+	s := Spec{
+		Name: "deploy",
+		Args: []string{"-v", "--api-token", "abc", "--password=hunter2", "target"},
+		Env:  []string{"HOME=/root", "DB_PASSWORD=hunter2", "GITHUB_TOKEN=abc"},
+		Dir:  "/srv",
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("unexpected error marshalling spec: %v", err)
+	}
+	if strings.Contains(string(b), "hunter2") || strings.Contains(string(b), "abc") {
+		t.Fatalf("secrets not redacted: %s", b)
+	}
+	var got Spec
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("unexpected error unmarshalling spec: %v", err)
+	}
+	want := Spec{
+		Name: "deploy",
+		Args: []string{"-v", "--api-token", Redacted, "--password=" + Redacted, "target"},
+		Env:  []string{"HOME=/root", "DB_PASSWORD=" + Redacted, "GITHUB_TOKEN=" + Redacted},
+		Dir:  "/srv",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v but got %+v", want, got)
+	}
+	if s.Env[1] != "DB_PASSWORD=hunter2" {
+		t.Fatal("marshalling modified the spec")
+	}
+}
+
+func TestSpecJSONEmptyEnv(t *testing.T) {
+	for _, env := range [][]string{nil, {}} {
+		b, err := json.Marshal(Spec{Name: "env", Env: env})
+		if err != nil {
+			t.Fatalf("unexpected error marshalling spec: %v", err)
+		}
+		var got Spec
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatalf("unexpected error unmarshalling spec: %v", err)
+		}
+		if (got.Env == nil) != (env == nil) || len(got.Env) != 0 {
+			t.Fatalf("expected Env %#v to round trip, got %#v from %s", env, got.Env, b)
+		}
+	}
+}
+
+func TestResultJSON(t *testing.T) {
+	r := Result{
+		Path:     "/bin/false",
+		Args:     []string{"false"},
+		Pid:      42,
+		Start:    time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Duration: time.Second,
+		ExitCode: 1,
+		Err:      errors.New("exit status 1"),
+		JobID:    "job",
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("unexpected error marshalling result: %v", err)
+	}
+	if !strings.Contains(string(b), `"exit_code":1`) || !strings.Contains(string(b), `"error":"exit status 1"`) {
+		t.Fatalf("unexpected JSON %s", b)
+	}
+	var got Result
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("unexpected error unmarshalling result: %v", err)
+	}
+	if got.Err == nil || got.Err.Error() != r.Err.Error() {
+		t.Fatalf("expected error %q, got %v", r.Err, got.Err)
+	}
+	got.Err, r.Err = nil, nil
+	if !reflect.DeepEqual(got, r) {
+		t.Fatalf("expected %+v but got %+v", r, got)
+	}
+}
+
+func TestResultJSONRedactsText(t *testing.T) {
+	r := Result{
+		Args: []string{"deploy", "--api-token", "s3cr3t-abc", "--password=hunter2"},
+		Err:  errors.New("deploy --api-token s3cr3t-abc --password=hunter2 failed"),
+		Tail: "bad token s3cr3t-abc\nDB_PASSWORD=letmein HOME=/root",
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("unexpected error marshalling result: %v", err)
+	}
+	for _, secret := range []string{"s3cr3t-abc", "hunter2", "letmein"} {
+		if strings.Contains(string(b), secret) {
+			t.Fatalf("secret %q not redacted: %s", secret, b)
+		}
+	}
+	if !strings.Contains(string(b), "HOME=/root") {
+		t.Fatalf("expected other text to be kept: %s", b)
+	}
+}
@@ -0,0 +1,227 @@
+package deputy
+
+import (
+	"bytes"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Stream identifies one of a command's output streams.
+type Stream int
+
+const (
+	// Stdout is the command's standard output.
+	Stdout Stream = iota + 1
+	// Stderr is the command's standard error.
+	Stderr
+)
+
+// String returns "stdout" or "stderr".
+func (s Stream) String() string {
+	switch s {
+	case Stdout:
+		return "stdout"
+	case Stderr:
+		return "stderr"
+	}
+	return "unknown"
+}
+
+// Line is a line of output from a command.
+type Line struct {
+	// Stream is the stream the line was written to.
+	Stream Stream
+	// Text is the line, without its trailing newline.  It is only valid until
+	// the function receiving the Line returns, so it must be copied to be kept.
+	Text []byte
+}
+
+// prepareLogs folds the Deputy's Log function and line annotations into its
+// per-stream log functions, so the rest of the run only has to deal with
+// those, and sets up the run's sinks.  Calling it again is a no-op.
+func (d *Deputy) prepareLogs() {
+	if d.prepared {
+		return
+	}
+	d.prepared = true
+	d.mergeLog()
+	d.failures = &pipeFailures{policy: d.PipeErrors, logf: d.logf}
+	d.sinks = &sinkSet{sinks: d.Sinks, ctx: d.context(), fail: d.failures.fail}
+	if len(d.Sinks) > 0 {
+		if d.StdoutWriter == nil {
+			d.StdoutLog = joinLogs(d.StdoutLog, d.sinks.log(Stdout))
+		}
+		if d.StderrWriter == nil {
+			d.StderrLog = joinLogs(d.StderrLog, d.sinks.log(Stderr))
+		}
+	}
+	if d.Quiet > 0 {
+		d.holdOutput()
+	}
+	if d.Timestamp != "" || d.Elapsed {
+		start := time.Now()
+		if d.StdoutLog != nil {
+			d.StdoutLog = annotate(d.StdoutLog, d.Timestamp, d.Elapsed, start)
+		}
+		if d.StderrLog != nil {
+			d.StderrLog = annotate(d.StderrLog, d.Timestamp, d.Elapsed, start)
+		}
+	}
+	if d.Prefix != "" {
+		if d.StdoutLog != nil {
+			d.StdoutLog = prefixLines(d.StdoutLog, d.Prefix)
+		}
+		if d.StderrLog != nil {
+			d.StderrLog = prefixLines(d.StderrLog, d.Prefix)
+		}
+	}
+}
+
+// prefixLines returns a log function that adds prefix to the start of each
+// line before passing it to log.
+func prefixLines(log func([]byte), prefix string) func([]byte) {
+	// as in annotate, the buffer can be reused for every line.
+	var buf []byte
+	return func(b []byte) {
+		buf = append(append(buf[:0], prefix...), b...)
+		log(buf)
+	}
+}
+
+// annotate returns a log function that prefixes each line with the current
+// time in the given layout (if any) and the time elapsed since start (if
+// elapsed is true) before passing it to log.
+func annotate(log func([]byte), layout string, elapsed bool, start time.Time) func([]byte) {
+	// each stream is read by a single goroutine, so the buffer can be
+	// reused for every line.
+	var buf []byte
+	return func(b []byte) {
+		now := time.Now()
+		buf = buf[:0]
+		if layout != "" {
+			buf = now.AppendFormat(buf, layout)
+			buf = append(buf, ' ')
+		}
+		if elapsed {
+			buf = append(buf, '+')
+			buf = strconv.AppendFloat(buf, now.Sub(start).Seconds(), 'f', 3, 64)
+			buf = append(buf, 's', ' ')
+		}
+		buf = append(buf, b...)
+		log(buf)
+	}
+}
+
+// mergeLog folds the Deputy's Log function into its per-stream log functions.
+func (d *Deputy) mergeLog() {
+	if d.Log == nil {
+		return
+	}
+	// Log is documented as never being called concurrently, but the streams
+	// are read in separate goroutines.
+	var mu sync.Mutex
+	log := d.Log
+	if d.StdoutWriter == nil {
+		d.StdoutLog = joinLogs(d.StdoutLog, streamLog(&mu, Stdout, log))
+	}
+	if d.StderrWriter == nil {
+		d.StderrLog = joinLogs(d.StderrLog, streamLog(&mu, Stderr, log))
+	}
+}
+
+// streamLog returns a function that sends lines of the given stream to log
+// while holding mu.
+func streamLog(mu *sync.Mutex, s Stream, log func(Line)) func([]byte) {
+	return func(b []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		log(Line{Stream: s, Text: b})
+	}
+}
+
+// joinLogs returns a log function that calls both log1 and log2, either of
+// which may be nil.
+func joinLogs(log1, log2 func([]byte)) func([]byte) {
+	if log1 == nil {
+		return log2
+	}
+	if log2 == nil {
+		return log1
+	}
+	return func(b []byte) {
+		log1(b)
+		log2(b)
+	}
+}
+
+// lineWriter is an io.Writer that passes each complete line written to it to
+// log, the same way the lines read from a pipe are.
+type lineWriter struct {
+	log func([]byte)
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+// Write implements io.Writer.
+func (w *lineWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// complete lines in p are logged straight from it, and only a partial
+	// line is kept in buf, which is reused from write to write.
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			w.buf = append(w.buf, p...)
+			break
+		}
+		line := p[:i]
+		if len(w.buf) > 0 {
+			w.buf = append(w.buf, line...)
+			line = w.buf
+		}
+		w.log(dropCR(line))
+		w.buf = w.buf[:0]
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// flush passes any final unterminated line to log.
+func (w *lineWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) > 0 {
+		w.log(dropCR(w.buf))
+		w.buf = w.buf[:0]
+	}
+}
+
+// dropCR drops a trailing \r, as bufio.ScanLines does.
+func dropCR(b []byte) []byte {
+	if len(b) > 0 && b[len(b)-1] == '\r' {
+		return b[:len(b)-1]
+	}
+	return b
+}
+
+// lineBuffer holds the most recent lines of output, up to a limit.
+type lineBuffer struct {
+	size  int
+	lines []Line
+}
+
+// add adds a copy of line, then drops the oldest lines while the total size
+// of the lines, counting a newline after each, is more than limit.
+func (b *lineBuffer) add(line Line, limit int) {
+	line.Text = append([]byte(nil), line.Text...)
+	b.lines = append(b.lines, line)
+	b.size += len(line.Text) + 1
+	for len(b.lines) > 0 && b.size > limit {
+		b.size -= len(b.lines[0].Text) + 1
+		b.lines[0] = Line{}
+		b.lines = b.lines[1:]
+	}
+}
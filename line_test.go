@@ -0,0 +1,102 @@
+package deputy
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLog(t *testing.T) {
+	cmd := maker{
+		stdout: "foo!",
+		stderr: "bar!",
+	}.make()
+	got := map[Stream]string{}
+	var stdout []byte
+	err := Deputy{
+		StdoutLog: func(b []byte) { stdout = append([]byte(nil), b...) },
+		Log:       func(l Line) { got[l.Stream] += string(l.Text) },
+	}.Run(cmd)
+	if err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	if got[Stdout] != "foo!" || got[Stderr] != "bar!" {
+		t.Fatalf("unexpected lines logged: %q", got)
+	}
+	if string(stdout) != "foo!" {
+		t.Fatalf("expected StdoutLog to get %q but got %q", "foo!", stdout)
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	cmd := maker{
+		stdout: "foo!",
+		stderr: "bar!",
+		exit:   1,
+	}.make()
+	var stdout, stderr string
+	err := Deputy{
+		Errors:    FromStderr,
+		Timestamp: "2006",
+		Elapsed:   true,
+		StdoutLog: func(b []byte) { stdout = string(b) },
+		Log: func(l Line) {
+			if l.Stream == Stderr {
+				stderr = string(l.Text)
+			}
+		},
+	}.Run(cmd)
+	if err == nil || !strings.HasSuffix(err.Error(), ": bar!") {
+		t.Fatalf("expected unannotated error text but got %v", err)
+	}
+	for _, s := range []string{stdout, stderr} {
+		fields := strings.Fields(s)
+		if len(fields) != 3 || len(fields[0]) != 4 || !strings.HasPrefix(fields[1], "+0.") {
+			t.Errorf("unexpected annotated line %q", s)
+		}
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	var got []string
+	w := &lineWriter{log: func(b []byte) { got = append(got, string(b)) }}
+	for _, s := range []string{"one\ntw", "o\r\n", "thr", "ee\nfour"} {
+		w.Write([]byte(s))
+	}
+	w.flush()
+	if strings.Join(got, ",") != "one,two,three,four" {
+		t.Fatalf("unexpected lines %q", got)
+	}
+}
+
+// lines is a chunk of output for the benchmarks.
+var lines = bytes.Repeat([]byte("some line of output from a busy command\n"), 1000)
+
+func BenchmarkPipe(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(lines)))
+	done := make(chan struct{}, 1)
+	r := bytes.NewReader(lines)
+	for i := 0; i < b.N; i++ {
+		r.Reset(lines)
+		pipe(func([]byte) {}, r, Stdout, 0, nil, done)
+		<-done
+	}
+}
+
+func BenchmarkLineWriter(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(lines)))
+	w := &lineWriter{log: func([]byte) {}}
+	for i := 0; i < b.N; i++ {
+		// odd sized writes, so that lines are split between them.
+		for p := lines; len(p) > 0; {
+			n := 4093
+			if n > len(p) {
+				n = len(p)
+			}
+			w.Write(p[:n])
+			p = p[n:]
+		}
+	}
+}
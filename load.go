@@ -0,0 +1,77 @@
+package deputy
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// LoadTest runs many copies of a command at the same time, for stress testing
+// a service by way of its client programs.
+type LoadTest struct {
+	// Deputy runs each command.
+	Deputy Deputy
+	// Copies is how many copies of the command run at the same time.
+	Copies int
+	// Runs is how many times each copy runs the command, one run after
+	// another.  Zero means once.
+	Runs int
+	// RampUp, if non-zero, spreads out the starts of the copies evenly over
+	// this long, rather than starting them all at once.
+	RampUp time.Duration
+}
+
+// LoadResult is the outcome of a load test.
+type LoadResult struct {
+	// Succeeded and Failed count the runs that succeeded and failed.
+	Succeeded, Failed int
+	// Timing holds the result of every run, in the order they finished,
+	// and statistics about how long they took.
+	Timing *Timing
+	// Elapsed is how long the whole test took.
+	Elapsed time.Duration
+}
+
+// Run runs the load test with the command described by spec, and waits for
+// every run to finish.  Failed runs are counted in the LoadResult rather than
+// returned as an error; their errors are in their Results.
+func (l LoadTest) Run(spec Spec) (*LoadResult, error) {
+	if l.Copies <= 0 {
+		return nil, errors.New("deputy: LoadTest needs at least one copy")
+	}
+	if l.Runs < 0 || l.RampUp < 0 {
+		return nil, errors.New("deputy: negative Runs or RampUp in LoadTest")
+	}
+	runs := l.Runs
+	if runs == 0 {
+		runs = 1
+	}
+
+	var mu sync.Mutex
+	lr := &LoadResult{}
+	results := make([]Result, 0, l.Copies*runs)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < l.Copies; i++ {
+		wg.Add(1)
+		go func(delay time.Duration) {
+			defer wg.Done()
+			time.Sleep(delay)
+			for j := 0; j < runs; j++ {
+				res, err := l.Deputy.RunResult(spec.Command())
+				mu.Lock()
+				results = append(results, res)
+				if err != nil {
+					lr.Failed++
+				} else {
+					lr.Succeeded++
+				}
+				mu.Unlock()
+			}
+		}(l.RampUp * time.Duration(i) / time.Duration(l.Copies))
+	}
+	wg.Wait()
+	lr.Elapsed = time.Since(start)
+	lr.Timing = newTiming(results)
+	return lr, nil
+}
@@ -0,0 +1,30 @@
+package deputy
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLoadTest(t *testing.T) {
+	spec := Spec{Name: os.Args[0], Args: []string{"-test.run=TestHelperProcess"}, Env: maker{timeout: 50 * time.Millisecond}.make().Env}
+	lt := LoadTest{Copies: 4, Runs: 2, RampUp: 100 * time.Millisecond}
+	res, err := lt.Run(spec)
+	if err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	if res.Succeeded != 8 || res.Failed != 0 || len(res.Timing.Results) != 8 {
+		t.Fatalf("expected 8 successful runs, got %+v", res)
+	}
+	// the last copy starts 75ms in and runs twice, but the copies run at the
+	// same time, so the whole test takes much less than all eight runs.
+	if res.Elapsed < 175*time.Millisecond || res.Elapsed > 8*res.Timing.Min {
+		t.Fatalf("unexpected elapsed time %v for runs of at least %v", res.Elapsed, res.Timing.Min)
+	}
+
+	spec.Env = maker{exit: 1}.make().Env
+	res, err = LoadTest{Copies: 3}.Run(spec)
+	if err != nil || res.Failed != 3 || res.Succeeded != 0 {
+		t.Fatalf("expected 3 failed runs, got %+v, %v", res, err)
+	}
+}
@@ -0,0 +1,128 @@
+package deputy
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// PathCache resolves program names to absolute paths by searching a list of
+// directories, and remembers the results so that later lookups of the same
+// name are fast and always resolve to the same program, even if PATH or the
+// file system changes.  Its LookPath method can be used as a Deputy's
+// LookPath.  The zero value searches the PATH environment variable.  A
+// PathCache is safe for concurrent use.
+type PathCache struct {
+	// Path is the list of directories to search, in the format of the PATH
+	// environment variable.  If empty, the PATH environment variable is
+	// searched.
+	Path string
+
+	mu    sync.Mutex
+	found map[string]string
+}
+
+// LookPath returns the absolute path of the program called file.  If file
+// contains a path separator it is not searched for, just checked.  Like
+// exec.LookPath, it refuses a program found through a relative directory in
+// the path, returning an error that wraps exec.ErrDot.
+func (c *PathCache) LookPath(file string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok := c.found[file]; ok {
+		return p, nil
+	}
+	p, err := c.lookPath(file)
+	if err != nil {
+		// as with exec.LookPath, a program found relative to the current
+		// directory is returned along with exec.ErrDot.
+		return p, err
+	}
+	if c.found == nil {
+		c.found = map[string]string{}
+	}
+	c.found[file] = p
+	return p, nil
+}
+
+// Forget clears all remembered lookups.
+func (c *PathCache) Forget() {
+	c.mu.Lock()
+	c.found = nil
+	c.mu.Unlock()
+}
+
+func (c *PathCache) lookPath(file string) (string, error) {
+	if c.Path == "" || strings.ContainsAny(file, `/\`) {
+		p, err := exec.LookPath(file)
+		if err != nil {
+			return p, err
+		}
+		return filepath.Abs(p)
+	}
+	for _, dir := range filepath.SplitList(c.Path) {
+		if dir == "" || !filepath.IsAbs(dir) {
+			// Like exec.LookPath, refuse to find programs relative to the
+			// current directory.
+			continue
+		}
+		if p, ok := findExecutable(filepath.Join(dir, file)); ok {
+			return p, nil
+		}
+	}
+	return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+}
+
+// findExecutable returns the path of the executable file at path, trying the
+// executable extensions on windows.
+func findExecutable(path string) (string, bool) {
+	if runtime.GOOS != "windows" {
+		fi, err := os.Stat(path)
+		return path, err == nil && fi.Mode().IsRegular() && fi.Mode()&0111 != 0
+	}
+	exts := filepath.SplitList(os.Getenv("PATHEXT"))
+	if len(exts) == 0 {
+		exts = []string{".com", ".exe", ".bat", ".cmd"}
+	}
+	if filepath.Ext(path) != "" {
+		exts = append([]string{""}, exts...)
+	}
+	for _, ext := range exts {
+		if fi, err := os.Stat(path + ext); err == nil && fi.Mode().IsRegular() {
+			return path + ext, true
+		}
+	}
+	return "", false
+}
+
+// lookPath finds the program called file as a command's name is resolved,
+// with the Deputy's LookPath if it has one.
+func (d Deputy) lookPath(file string) (string, error) {
+	if d.LookPath != nil {
+		return d.LookPath(file)
+	}
+	p, err := exec.LookPath(file)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(p)
+}
+
+// resolvePath sets cmd.Path using the Deputy's LookPath, if it has one.
+func (d Deputy) resolvePath(cmd *exec.Cmd) error {
+	if d.LookPath == nil || len(cmd.Args) == 0 {
+		return nil
+	}
+	p, err := d.LookPath(cmd.Args[0])
+	if err != nil {
+		return err
+	}
+	cmd.Path = p
+	// exec.Command records its own lookup failure here, which would make
+	// Start fail even though we found the program.
+	cmd.Err = nil
+	return nil
+}
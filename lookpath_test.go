@@ -0,0 +1,70 @@
+package deputy
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestPathCache(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses unix permissions")
+	}
+	dir := t.TempDir()
+	prog := filepath.Join(dir, "myprog")
+	if err := os.WriteFile(prog, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	c := &PathCache{Path: dir}
+	p, err := c.LookPath("myprog")
+	if err != nil {
+		t.Fatalf("unexpected error from LookPath: %v", err)
+	}
+	if p != prog {
+		t.Fatalf("expected %q but got %q", prog, p)
+	}
+
+	// the result stays pinned even if the program goes away.
+	os.Remove(prog)
+	if p, err := c.LookPath("myprog"); err != nil || p != prog {
+		t.Fatalf("expected cached %q but got %q, %v", prog, p, err)
+	}
+	c.Forget()
+	if _, err := c.LookPath("myprog"); err == nil {
+		t.Fatal("expected error after Forget")
+	}
+}
+
+func TestPathCacheDot(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses unix permissions")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "myprog"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+	t.Setenv("PATH", ".")
+	if _, err := (&PathCache{}).LookPath("myprog"); !errors.Is(err, exec.ErrDot) {
+		t.Fatalf("expected exec.ErrDot, got %v", err)
+	}
+	cmd := exec.Command("myprog")
+	if err := (Deputy{LookPath: (&PathCache{}).LookPath}).Run(cmd); !errors.Is(err, exec.ErrDot) || cmd.Process != nil {
+		t.Fatalf("expected the program in the current directory not to be run, got %v", err)
+	}
+}
+
+func TestDeputyLookPath(t *testing.T) {
+	cmd := exec.Command("deputy-helper-that-does-not-exist", "-test.run=TestHelperProcess")
+	cmd.Env = maker{}.make().Env
+	d := Deputy{LookPath: func(string) (string, error) { return os.Args[0], nil }}
+	if err := d.Run(cmd); err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	if cmd.Path != os.Args[0] {
+		t.Fatalf("expected path %q but got %q", os.Args[0], cmd.Path)
+	}
+}
@@ -0,0 +1,331 @@
+package deputy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricsExporter exports metrics about runs of commands in the Prometheus
+// text format, so that short-lived jobs, such as those run by cron, can be
+// monitored.  The metrics can be pushed to a Prometheus pushgateway, written
+// to a file for the node exporter's textfile collector, or both.  Its Export
+// method can be used as a Deputy's Defer function.
+//
+// The metrics, each labelled with the program's name and the run's Labels,
+// are:
+//
+//	deputy_run_duration_seconds   how long the command ran
+//	deputy_run_exit_code          the command's exit code, -1 if it didn't exit
+//	deputy_run_success            1 if the run succeeded, 0 if it failed
+//	deputy_run_start_time_seconds when the command was started, as a Unix time
+//	deputy_run_attempts           how many times a Retry has run the command,
+//	                              counting this run; 1 outside of a Retry
+//
+// Labels named job or instance, which Prometheus sets itself, are renamed to
+// exported_job and exported_instance, as Prometheus renames them when it
+// scrapes conflicting labels.
+type MetricsExporter struct {
+	// Job is the pushgateway job name.  It defaults to "deputy".
+	Job string
+	// Labels are added to every metric, unless a run has a label of the
+	// same name.  Their names, like those of a run's labels, must be valid
+	// Prometheus label names, or the run's metrics aren't exported.
+	Labels map[string]string
+	// Program, if set, returns the program label for the path of a run's
+	// program, such as to strip temporary directories or version numbers from
+	// it, so that there aren't more distinct labels than the metrics can
+	// afford.  It defaults to the base name of the path.
+	Program func(path string) string
+	// PushURL, if set, is the base URL of a pushgateway, such as
+	// "http://localhost:9091", to push the metrics to.  They are pushed to
+	// the group keyed by the job and the metrics' labels, so that runs with
+	// other labels don't replace them.
+	PushURL string
+	// TextFile, if set, is the file to write the metrics to, replacing it
+	// atomically.  The metrics of earlier runs with other labels are kept in
+	// it.  Its name should end in ".prom".
+	TextFile string
+	// Client pushes the metrics.  It defaults to a client that gives up
+	// after ten seconds, so that a pushgateway that doesn't answer can't
+	// hold up the run that is being exported.
+	Client *http.Client
+	// ExportError, if set, is called with errors exporting the metrics of a
+	// run from Export.  It defaults to log.Print.
+	ExportError func(error)
+}
+
+// Export exports the metrics of res, passing any error to ExportError.
+func (m MetricsExporter) Export(res Result) {
+	if err := m.export(res); err != nil {
+		if m.ExportError != nil {
+			m.ExportError(err)
+			return
+		}
+		log.Print(err)
+	}
+}
+
+// export writes the metrics of res to the configured destinations.
+func (m MetricsExporter) export(res Result) error {
+	labels, err := m.labels(res)
+	if err != nil {
+		return err
+	}
+	if m.TextFile != "" {
+		if err := m.writeTextFile(res, labels); err != nil {
+			return fmt.Errorf("deputy: writing metrics: %v", err)
+		}
+	}
+	if m.PushURL != "" {
+		var buf bytes.Buffer
+		if err := writeMetrics(&buf, formatLabels(labels), runMetrics(res), nil); err != nil {
+			return err
+		}
+		if err := m.push(buf.Bytes(), labels); err != nil {
+			return fmt.Errorf("deputy: pushing metrics: %v", err)
+		}
+	}
+	return nil
+}
+
+// WriteMetrics writes the metrics of res to w in the Prometheus text format.
+// It returns an error if a label's name isn't a valid Prometheus label name.
+func (m MetricsExporter) WriteMetrics(w io.Writer, res Result) error {
+	labels, err := m.labels(res)
+	if err != nil {
+		return err
+	}
+	return writeMetrics(w, formatLabels(labels), runMetrics(res), nil)
+}
+
+// runMetric is one of the metrics exported for a run.
+type runMetric struct {
+	name, help string
+	value      interface{}
+}
+
+// runMetrics returns the metrics of res.
+func runMetrics(res Result) []runMetric {
+	success := 0
+	if res.Err == nil {
+		success = 1
+	}
+	attempts := res.Attempts
+	if attempts == 0 {
+		attempts = 1
+	}
+	var start float64
+	if !res.Start.IsZero() {
+		start = float64(res.Start.UnixNano()) / 1e9
+	}
+	return []runMetric{
+		{"deputy_run_duration_seconds", "How long the command ran.", res.Duration.Seconds()},
+		{"deputy_run_exit_code", "The command's exit code, -1 if it didn't exit.", res.ExitCode},
+		{"deputy_run_success", "Whether the run succeeded.", success},
+		{"deputy_run_start_time_seconds", "When the command was started.", start},
+		{"deputy_run_attempts", "How many times a Retry has run the command, counting this run.", attempts},
+	}
+}
+
+// writeMetrics writes metrics with the formatted labels to w, each after the
+// lines in other for the metric of the same name.
+func writeMetrics(w io.Writer, labels string, metrics []runMetric, other map[string][]string) error {
+	for _, mt := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", mt.name, mt.help, mt.name); err != nil {
+			return err
+		}
+		for _, line := range other[mt.name] {
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s%s %v\n", mt.name, labels, mt.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reservedLabels are the labels Prometheus sets on the metrics it collects.
+var reservedLabels = []string{"job", "instance"}
+
+// labelName matches valid Prometheus label names.
+var labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// labels returns the labels for the metrics of res, or an error if one of
+// them has an invalid name.
+func (m MetricsExporter) labels(res Result) (map[string]string, error) {
+	all := map[string]string{}
+	for k, v := range m.Labels {
+		all[k] = v
+	}
+	for k, v := range res.Labels {
+		all[k] = v
+	}
+	if res.Path != "" {
+		if m.Program != nil {
+			all["program"] = m.Program(res.Path)
+		} else {
+			all["program"] = filepath.Base(res.Path)
+		}
+	}
+	for _, k := range reservedLabels {
+		if v, ok := all[k]; ok {
+			delete(all, k)
+			all["exported_"+k] = v
+		}
+	}
+	for k := range all {
+		if !labelName.MatchString(k) {
+			return nil, fmt.Errorf("deputy: invalid metric label name %q", k)
+		}
+	}
+	return all, nil
+}
+
+// sortedKeys returns the names of labels in order.
+func sortedKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatLabels formats labels as they follow a metric's name.
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := sortedKeys(labels)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + `="` + labelEscaper.Replace(labels[k]) + `"`
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// labelEscaper escapes label values as the Prometheus text format requires.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// pushClient is the client metrics are pushed with, if the exporter has none.
+var pushClient = &http.Client{Timeout: 10 * time.Second}
+
+// push replaces the metrics in the pushgateway's group for the job and labels
+// with body.
+func (m MetricsExporter) push(body []byte, labels map[string]string) error {
+	job := m.Job
+	if job == "" {
+		job = "deputy"
+	}
+	u := strings.TrimSuffix(m.PushURL, "/") + "/metrics/job/" + url.PathEscape(job)
+	for _, k := range sortedKeys(labels) {
+		u += "/" + groupingPair(k, labels[k])
+	}
+	req, err := http.NewRequest(http.MethodPut, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	client := m.Client
+	if client == nil {
+		client = pushClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// groupingPair returns the path segments for a label in a pushgateway
+// grouping key.  Values that can't be a path segment are base64 encoded.
+func groupingPair(name, value string) string {
+	if value == "" {
+		return name + "@base64/="
+	}
+	if strings.Contains(value, "/") {
+		return name + "@base64/" + base64.URLEncoding.EncodeToString([]byte(value))
+	}
+	return name + "/" + url.PathEscape(value)
+}
+
+// textFileMu serializes the writing of textfiles, so that runs exported to
+// the same file at once don't lose each other's metrics.
+var textFileMu sync.Mutex
+
+// writeTextFile writes the metrics of res with the labels all to the
+// exporter's TextFile, keeping the metrics already in it of runs with other
+// labels.
+func (m MetricsExporter) writeTextFile(res Result, all map[string]string) error {
+	textFileMu.Lock()
+	defer textFileMu.Unlock()
+	labels := formatLabels(all)
+	old, err := os.ReadFile(m.TextFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	other := map[string][]string{}
+	for _, line := range strings.Split(string(old), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		series := line
+		if i := strings.LastIndexByte(line, ' '); i >= 0 {
+			series = line[:i]
+		}
+		name, lbls := series, ""
+		if i := strings.IndexByte(series, '{'); i >= 0 {
+			name, lbls = series[:i], series[i:]
+		}
+		if lbls != labels {
+			other[name] = append(other[name], line)
+		}
+	}
+	var buf bytes.Buffer
+	if err := writeMetrics(&buf, labels, runMetrics(res), other); err != nil {
+		return err
+	}
+	return writeFileAtomic(m.TextFile, buf.Bytes())
+}
+
+// writeFileAtomic writes data to a temporary file next to name and renames it
+// into place, so readers never see a partly written file.
+func writeFileAtomic(name string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
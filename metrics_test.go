@@ -0,0 +1,219 @@
+package deputy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsExporter(t *testing.T) {
+	var pushed, path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		pushed, path = string(b), r.URL.Path
+	}))
+	defer srv.Close()
+
+	file := filepath.Join(t.TempDir(), "job.prom")
+	m := MetricsExporter{
+		Job:         "nightly",
+		Labels:      map[string]string{"env": `prod "eu"`},
+		PushURL:     srv.URL,
+		TextFile:    file,
+		ExportError: func(err error) { t.Errorf("unexpected export error: %v", err) },
+	}
+	res := Result{Path: "/usr/bin/backup", Start: time.Unix(1000, 0), Duration: 1500 * time.Millisecond, ExitCode: 2, Err: errors.New("exit status 2")}
+	m.Export(res)
+
+	if path != `/metrics/job/nightly/env/prod "eu"/program/backup` {
+		t.Errorf("pushed to %q", path)
+	}
+	written, err := os.ReadFile(file)
+	if err != nil || string(written) != pushed {
+		t.Fatalf("expected the textfile to match what was pushed, got %q, %v", written, err)
+	}
+	for _, want := range []string{
+		`deputy_run_duration_seconds{env="prod \"eu\"",program="backup"} 1.5`,
+		`deputy_run_exit_code{env="prod \"eu\"",program="backup"} 2`,
+		`deputy_run_success{env="prod \"eu\"",program="backup"} 0`,
+		`deputy_run_start_time_seconds{env="prod \"eu\"",program="backup"} 1000`,
+		"# TYPE deputy_run_success gauge",
+	} {
+		if !strings.Contains(pushed, want+"\n") {
+			t.Errorf("expected metrics to contain %q, got:\n%s", want, pushed)
+		}
+	}
+}
+
+func TestMetricsLabels(t *testing.T) {
+	var res Result
+	d := Deputy{Labels: map[string]string{"tenant": "acme"}, Defer: []func(Result){func(r Result) { res = r }}}
+	if err := d.Run(maker{}.make(), WithLabel("job", "nightly")); err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	if len(d.Labels) != 1 {
+		t.Fatalf("WithLabel changed the Deputy's Labels: %v", d.Labels)
+	}
+	res.Path = "/tmp/tmp.x1y2/backup-v1.2.3"
+	m := MetricsExporter{
+		Labels: map[string]string{"tenant": "default"},
+		Program: func(path string) string {
+			name, _, _ := strings.Cut(filepath.Base(path), "-v")
+			return name
+		},
+	}
+	var b strings.Builder
+	if err := m.WriteMetrics(&b, res); err != nil {
+		t.Fatal(err)
+	}
+	want := `deputy_run_success{exported_job="nightly",program="backup",tenant="acme"} 1`
+	if !strings.Contains(b.String(), want+"\n") {
+		t.Fatalf("expected metrics to contain %q, got:\n%s", want, b.String())
+	}
+}
+
+func TestMetricsPushTimeout(t *testing.T) {
+	if pushClient.Timeout <= 0 {
+		t.Fatal("expected pushes to time out by default")
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	old := pushClient.Timeout
+	pushClient.Timeout = 50 * time.Millisecond
+	defer func() { pushClient.Timeout = old }()
+	var exportErr error
+	start := time.Now()
+	MetricsExporter{PushURL: srv.URL, ExportError: func(err error) { exportErr = err }}.Export(Result{Path: "/bin/true"})
+	if exportErr == nil || time.Since(start) > 5*time.Second {
+		t.Fatalf("expected the push to time out, got %v after %v", exportErr, time.Since(start))
+	}
+}
+
+func TestMetricsGroups(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	file := filepath.Join(t.TempDir(), "job.prom")
+	m := MetricsExporter{
+		PushURL:     srv.URL,
+		TextFile:    file,
+		ExportError: func(err error) { t.Errorf("unexpected export error: %v", err) },
+	}
+	m.Export(Result{Path: "/usr/bin/backup", ExitCode: 1, Err: errors.New("exit status 1")})
+	m.Export(Result{Path: "/usr/bin/restore", Labels: map[string]string{"dir": "/var/lib", "note": ""}})
+	m.Export(Result{Path: "/usr/bin/backup"})
+
+	want := []string{
+		"/metrics/job/deputy/program/backup",
+		"/metrics/job/deputy/dir@base64/L3Zhci9saWI=/note@base64/=/program/restore",
+		"/metrics/job/deputy/program/backup",
+	}
+	if strings.Join(paths, " ") != strings.Join(want, " ") {
+		t.Errorf("expected pushes to %q, got %q", want, paths)
+	}
+	written, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(written)
+	for _, want := range []string{
+		"deputy_run_exit_code{program=\"backup\"} 0\n",
+		"deputy_run_exit_code{dir=\"/var/lib\",note=\"\",program=\"restore\"} 0\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected the textfile to contain %q, got:\n%s", want, got)
+		}
+	}
+	if n := strings.Count(got, "# TYPE deputy_run_exit_code gauge"); n != 1 {
+		t.Errorf("expected one TYPE line per metric, got %d:\n%s", n, got)
+	}
+	if n := strings.Count(got, "deputy_run_exit_code{"); n != 2 {
+		t.Errorf("expected the textfile to hold two runs, got %d:\n%s", n, got)
+	}
+}
+
+func TestMetricsBadLabel(t *testing.T) {
+	pushed := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pushed = true
+	}))
+	defer srv.Close()
+
+	for _, name := range []string{"team-name", "1st", ""} {
+		var exportErr error
+		m := MetricsExporter{
+			Labels:      map[string]string{name: "x"},
+			PushURL:     srv.URL,
+			ExportError: func(err error) { exportErr = err },
+		}
+		m.Export(Result{Path: "/bin/true"})
+		if exportErr == nil || !strings.Contains(exportErr.Error(), "invalid metric label name") {
+			t.Errorf("expected an error for the label %q, got %v", name, exportErr)
+		}
+		if err := m.WriteMetrics(io.Discard, Result{}); err == nil {
+			t.Errorf("expected WriteMetrics to reject the label %q", name)
+		}
+	}
+	if pushed {
+		t.Error("metrics with invalid labels were pushed")
+	}
+}
+
+func TestMetricsReservedLabels(t *testing.T) {
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+	}))
+	defer srv.Close()
+
+	m := MetricsExporter{
+		Job:         "nightly",
+		Labels:      map[string]string{"instance": "db1"},
+		PushURL:     srv.URL,
+		ExportError: func(err error) { t.Errorf("unexpected export error: %v", err) },
+	}
+	m.Export(Result{Path: "/usr/bin/backup", Labels: map[string]string{"job": "backup"}})
+	want := "/metrics/job/nightly/exported_instance/db1/exported_job/backup/program/backup"
+	if path != want {
+		t.Errorf("expected a push to %q, got %q", want, path)
+	}
+}
+
+func TestMetricsAttempts(t *testing.T) {
+	var b strings.Builder
+	m := MetricsExporter{}
+	d := Deputy{Defer: []func(Result){func(r Result) {
+		b.Reset()
+		if err := m.WriteMetrics(&b, r); err != nil {
+			t.Error(err)
+		}
+	}}}
+	spec := Spec{Name: os.Args[0], Args: []string{"-test.run=TestHelperProcess"}, Env: maker{exit: 28}.make().Env}
+	if _, err := (Retry{Deputy: d, Attempts: 2, RetryExitCodes: []int{28}}).Run(spec); err == nil {
+		t.Fatal("expected the retried command to fail")
+	}
+	want := `deputy_run_attempts{program="` + filepath.Base(os.Args[0]) + `"} 2`
+	if !strings.Contains(b.String(), want+"\n") {
+		t.Fatalf("expected metrics to contain %q, got:\n%s", want, b.String())
+	}
+
+	b.Reset()
+	if err := m.WriteMetrics(&b, Result{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "deputy_run_attempts 1\n") {
+		t.Fatalf("expected a run outside a Retry to count one attempt, got:\n%s", b.String())
+	}
+}
@@ -0,0 +1,255 @@
+package deputy
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Option is a function that changes the configuration of a Deputy.  Options
+// are used to derive new Deputies from existing ones with With.
+type Option func(*Deputy)
+
+// With returns a copy of d with the given options applied.  The original
+// Deputy is not modified, so a base Deputy can be shared and specialized for
+// individual call sites.
+func (d Deputy) With(opts ...Option) Deputy {
+	for _, opt := range opts {
+		opt(&d)
+	}
+	return d
+}
+
+// WithCancel sets the Deputy's Cancel channel.
+func WithCancel(cancel <-chan struct{}) Option {
+	return func(d *Deputy) {
+		d.Cancel = cancel
+	}
+}
+
+// WithTimeout sets the Deputy's Timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(d *Deputy) {
+		d.Timeout = timeout
+	}
+}
+
+// WithErrors sets how the Deputy handles errors.
+func WithErrors(errs ErrorHandling) Option {
+	return func(d *Deputy) {
+		d.Errors = errs
+	}
+}
+
+// WithStdoutLog sets the function that receives lines written to stdout.
+func WithStdoutLog(log func([]byte)) Option {
+	return func(d *Deputy) {
+		d.StdoutLog = log
+	}
+}
+
+// WithStderrLog sets the function that receives lines written to stderr.
+func WithStderrLog(log func([]byte)) Option {
+	return func(d *Deputy) {
+		d.StderrLog = log
+	}
+}
+
+// WithStdoutWriter sets the writer that receives the command's stdout as it
+// is written, leaving stdout out of the Deputy's line handling.
+func WithStdoutWriter(w io.Writer) Option {
+	return func(d *Deputy) {
+		d.StdoutWriter = w
+	}
+}
+
+// WithStderrWriter sets the writer that receives the command's stderr as it
+// is written, leaving stderr out of the Deputy's line handling.
+func WithStderrWriter(w io.Writer) Option {
+	return func(d *Deputy) {
+		d.StderrWriter = w
+	}
+}
+
+// WithFiles sets the extra files passed to the command.
+func WithFiles(files map[string]*os.File) Option {
+	return func(d *Deputy) {
+		d.Files = files
+	}
+}
+
+// WithLog sets the function that receives lines written to both stdout and
+// stderr.
+func WithLog(log func(Line)) Option {
+	return func(d *Deputy) {
+		d.Log = log
+	}
+}
+
+// WithTimestamp sets the time layout used to prefix logged lines.
+func WithTimestamp(layout string) Option {
+	return func(d *Deputy) {
+		d.Timestamp = layout
+	}
+}
+
+// WithPrefix sets the prefix added to each line of output.
+func WithPrefix(prefix string) Option {
+	return func(d *Deputy) {
+		d.Prefix = prefix
+	}
+}
+
+// WithElapsed sets whether logged lines are prefixed with the time since the
+// command started.
+func WithElapsed(elapsed bool) Option {
+	return func(d *Deputy) {
+		d.Elapsed = elapsed
+	}
+}
+
+// WithSinks sets the sinks that receive lines written to stdout and stderr.
+func WithSinks(sinks ...Sink) Option {
+	return func(d *Deputy) {
+		d.Sinks = sinks
+	}
+}
+
+// WithPipeErrors sets how errors reading output or writing it to sinks are
+// handled.
+func WithPipeErrors(policy PipeErrorPolicy) Option {
+	return func(d *Deputy) {
+		d.PipeErrors = policy
+	}
+}
+
+// WithDefer adds f to the functions called with the Result of each run.
+func WithDefer(f func(Result)) Option {
+	return func(d *Deputy) {
+		d.Defer = append(d.Defer[:len(d.Defer):len(d.Defer)], f)
+	}
+}
+
+// WithLabel adds a label to the Deputy's Labels.
+func WithLabel(name, value string) Option {
+	return func(d *Deputy) {
+		labels := make(map[string]string, len(d.Labels)+1)
+		for k, v := range d.Labels {
+			labels[k] = v
+		}
+		labels[name] = value
+		d.Labels = labels
+	}
+}
+
+// WithEnv adds environment variables, in "key=value" form, to the command's
+// environment.
+func WithEnv(env ...string) Option {
+	return func(d *Deputy) {
+		d.Env = append(d.Env[:len(d.Env):len(d.Env)], env...)
+	}
+}
+
+// WithClearEnv sets ClearEnv, keeping only the environment variables named in
+// allow.
+func WithClearEnv(allow ...string) Option {
+	return func(d *Deputy) {
+		d.ClearEnv = true
+		d.EnvAllowlist = allow
+	}
+}
+
+// WithJobID sets the id the run is recorded under in the Deputy's Jobs
+// registry.  Without it, runs are given random ids.  Reusing the id of a job
+// that is done replaces it; reusing the id of a job that isn't done is an
+// error.
+func WithJobID(id string) Option {
+	return func(d *Deputy) {
+		d.jobID = id
+	}
+}
+
+// WithGrace sets how long a command being stopped is given to exit before it
+// is killed.
+func WithGrace(grace time.Duration) Option {
+	return func(d *Deputy) {
+		d.Grace = grace
+	}
+}
+
+// WithStopSignal sets the signal that asks the command to stop when Grace is
+// set.
+func WithStopSignal(sig os.Signal) Option {
+	return func(d *Deputy) {
+		d.StopSignal = sig
+	}
+}
+
+// WithGraceEnv sets the name of the environment variable in which the command
+// is told its Grace.
+func WithGraceEnv(name string) Option {
+	return func(d *Deputy) {
+		d.GraceEnv = name
+	}
+}
+
+// WithWaitDelay sets how long the command's output is given to end once the
+// command has exited or been stopped.
+func WithWaitDelay(delay time.Duration) Option {
+	return func(d *Deputy) {
+		d.WaitDelay = delay
+	}
+}
+
+// WithPassDeadline sets whether the command is told its deadline in the
+// DeadlineEnv environment variable.
+func WithPassDeadline(pass bool) Option {
+	return func(d *Deputy) {
+		d.PassDeadline = pass
+	}
+}
+
+// WithReadBuffer sets the size of the buffer each logged stream is read into.
+func WithReadBuffer(size int) Option {
+	return func(d *Deputy) {
+		d.ReadBuffer = size
+	}
+}
+
+// WithDecompress sets how the command's stdout is decompressed.
+func WithDecompress(format string) Option {
+	return func(d *Deputy) {
+		d.Decompress = format
+	}
+}
+
+// WithQuiet sets how much of the command's output to hold back, to be
+// passed on only if it fails.
+func WithQuiet(size int) Option {
+	return func(d *Deputy) {
+		d.Quiet = size
+	}
+}
+
+// WithShellProgram sets the shell that Shell runs commands with.
+func WithShellProgram(shell ShellProgram) Option {
+	return func(d *Deputy) {
+		d.ShellProgram = shell
+	}
+}
+
+// WithVerbosity sets how much the Deputy reports about what it is doing.
+func WithVerbosity(v Verbosity) Option {
+	return func(d *Deputy) {
+		d.Verbosity = v
+	}
+}
+
+// WithPreStart sets a function to call with the command just before it is
+// started.
+func WithPreStart(f func(*exec.Cmd) error) Option {
+	return func(d *Deputy) {
+		d.PreStart = f
+	}
+}
@@ -0,0 +1,162 @@
+package deputy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWith(t *testing.T) {
+	base := Deputy{Errors: FromStderr}
+	d := base.With(WithTimeout(time.Second), WithErrors(FromStdout))
+	if base.Timeout != 0 || base.Errors != FromStderr {
+		t.Fatalf("With modified the original deputy: %+v", base)
+	}
+	if d.Timeout != time.Second || d.Errors != FromStdout {
+		t.Fatalf("With did not apply options: %+v", d)
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	cmd := maker{
+		timeout: time.Second * 2,
+	}.make()
+	start := time.Now()
+	err := Deputy{Timeout: 50 * time.Millisecond}.Run(cmd)
+	var terr *TimeoutError
+	if !errors.As(err, &terr) || terr.Timeout != 50*time.Millisecond || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected timeout error but got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("command was not killed at the timeout")
+	}
+}
+
+func TestNegativeTimeout(t *testing.T) {
+	if err := (Deputy{Timeout: -time.Second}).Validate(); err == nil {
+		t.Fatal("expected error from Validate for negative timeout")
+	}
+}
+
+func TestRunOptions(t *testing.T) {
+	output := "foooo"
+	d := Deputy{Errors: FromStderr}
+	err := d.Run(maker{stdout: output, exit: 1}.make(), WithErrors(FromStdout))
+	if err == nil || !strings.HasSuffix(err.Error(), output) {
+		t.Fatalf("Expected output of %q but got %v", output, err)
+	}
+	if d.Errors != FromStderr {
+		t.Fatal("per-call options modified the deputy")
+	}
+}
+
+func TestGrace(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("commands are killed right away on windows")
+	}
+	var res Result
+	cmd := shellCommand("trap 'exit 7' TERM; sleep 5 & wait")
+	err := Deputy{
+		Timeout: 100 * time.Millisecond,
+		Grace:   2 * time.Second,
+		Defer:   []func(Result){func(r Result) { res = r }},
+	}.Run(cmd)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected timeout error but got %v", err)
+	}
+	if res.ExitCode != 7 || !res.Graceful {
+		t.Fatalf("expected the command to exit on its own with 7, got %d", res.ExitCode)
+	}
+}
+
+func TestStopSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("commands are killed right away on windows")
+	}
+	var res Result
+	var grace string
+	cmd := shellCommand(`trap 'echo "$DEPUTY_GRACE"; exit 0' INT; sleep 5 >/dev/null & wait`)
+	err := Deputy{
+		Timeout:    100 * time.Millisecond,
+		Grace:      1500 * time.Millisecond,
+		StopSignal: os.Interrupt,
+		GraceEnv:   "DEPUTY_GRACE",
+		StdoutLog:  func(b []byte) { grace = string(b) },
+		Defer:      []func(Result){func(r Result) { res = r }},
+	}.Run(cmd)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected timeout error but got %v", err)
+	}
+	if grace != "1.5" || !res.Graceful {
+		t.Fatalf("expected the command to be told its grace and exit in it, got %q and %v", grace, res.Graceful)
+	}
+}
+
+func TestTimeoutReaps(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a unix shell")
+	}
+	// the background sleep keeps stdout open after the shell is killed.
+	cmd := shellCommand("sleep 10 & sleep 10")
+	start := time.Now()
+	err := Deputy{Timeout: 50 * time.Millisecond, StdoutLog: func([]byte) {}}.Run(cmd)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected timeout error but got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("Run waited for the command's children")
+	}
+	if cmd.ProcessState == nil {
+		t.Fatal("killed command was not waited for")
+	}
+}
+
+func TestPreStart(t *testing.T) {
+	var stdout string
+	d := Deputy{StdoutLog: func(b []byte) { stdout = string(b) }}
+	err := d.Run(maker{}.make(), WithPreStart(func(cmd *exec.Cmd) error {
+		if cmd.Stdout == nil {
+			t.Error("PreStart called before stdout was set up")
+		}
+		cmd.Env = append(cmd.Env, helperStdout+"=from prestart")
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	if stdout != "from prestart" {
+		t.Fatalf("PreStart change not applied, got %q", stdout)
+	}
+
+	cmd := maker{}.make()
+	perr := errors.New("not today")
+	if err := d.Run(cmd, WithPreStart(func(*exec.Cmd) error { return perr })); err != perr {
+		t.Fatalf("expected PreStart error, got %v", err)
+	}
+	if cmd.Process != nil {
+		t.Fatal("command started despite PreStart error")
+	}
+}
+
+func TestForeground(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("not supported on windows")
+	}
+	// whether there is a controlling terminal depends on how the tests are
+	// run, but either way this process must get its terminal back.
+	for _, raw := range []bool{false, true} {
+		sink := &testSink{}
+		err := Deputy{Foreground: true, RawTerminal: raw, Sinks: []Sink{sink}}.Run(maker{}.make())
+		if err != nil && !strings.Contains(err.Error(), "controlling terminal") {
+			t.Fatalf("unexpected error returned from Run: %v", err)
+		}
+		if got := strings.Join(sink.calls, ","); got != "open,flush,close" {
+			t.Fatalf("expected the sink to be closed once, got %s", got)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package deputy
+
+import "os/exec"
+
+// setpgid does nothing on this platform.
+func setpgid(cmd *exec.Cmd) {}
+
+// processGroup returns the pid of cmd, since there are no process groups on
+// this platform.
+func processGroup(cmd *exec.Cmd) int {
+	return cmd.Process.Pid
+}
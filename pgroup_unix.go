@@ -0,0 +1,28 @@
+//go:build unix
+
+package deputy
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setpgid starts cmd in a process group of its own, unless it is already
+// set up to join or lead one.
+func setpgid(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	if !cmd.SysProcAttr.Setsid {
+		cmd.SysProcAttr.Setpgid = true
+	}
+}
+
+// processGroup returns the process group of cmd, which must have been
+// started.
+func processGroup(cmd *exec.Cmd) int {
+	if a := cmd.SysProcAttr; a != nil && a.Setpgid && a.Pgid != 0 {
+		return a.Pgid
+	}
+	return cmd.Process.Pid
+}
@@ -0,0 +1,156 @@
+package deputy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// PipeError is an error reading a command's output, or writing it to a Sink.
+type PipeError struct {
+	// Stream is the stream being read or written, if any.  It is zero for
+	// errors flushing or closing a Sink.
+	Stream Stream
+	// Sink is the sink that failed, or nil if reading the stream failed.
+	Sink Sink
+	// Err is the underlying error.
+	Err error
+}
+
+// Error implements error.
+func (e *PipeError) Error() string {
+	switch {
+	case e.Sink == nil:
+		return fmt.Sprintf("deputy: reading %s: %v", e.Stream, e.Err)
+	case e.Stream == 0:
+		return fmt.Sprintf("deputy: sink %T: %v", e.Sink, e.Err)
+	default:
+		return fmt.Sprintf("deputy: writing %s to sink %T: %v", e.Stream, e.Sink, e.Err)
+	}
+}
+
+// Unwrap returns the underlying error.
+func (e *PipeError) Unwrap() error {
+	return e.Err
+}
+
+// CallbackPanicError is the error Run returns when one of the Deputy's log
+// functions or sinks panics while handling the command's output.  The command
+// is killed, whatever the Deputy's PipeErrors policy, and the rest of its
+// output is discarded.
+type CallbackPanicError struct {
+	// Stream is the stream whose line was being handled.
+	Stream Stream
+	// Value is the value the function panicked with.
+	Value interface{}
+	// Stack is the stack trace of the panic.
+	Stack []byte
+}
+
+// Error implements error.
+func (e *CallbackPanicError) Error() string {
+	return fmt.Sprintf("deputy: log function for %s panicked: %v", e.Stream, e.Value)
+}
+
+// PipeErrorPolicy tells a Deputy what to do when reading a command's output or
+// writing it to a Sink fails.  Output that can't be read is discarded, so
+// that the command doesn't block writing to a full pipe.
+type PipeErrorPolicy int
+
+const (
+	// FailOnPipeError lets the command run to completion, and then returns
+	// the PipeErrors from Run, joined with the command's own error if it
+	// failed as well, so that either can be found with errors.Is and
+	// errors.As.
+	FailOnPipeError PipeErrorPolicy = iota
+
+	// IgnorePipeError lets the command run to completion and doesn't let
+	// pipe errors make Run fail.  They are only recorded in the Result's
+	// PipeErrors.
+	IgnorePipeError
+
+	// LogPipeError lets the command run to completion, reporting each pipe
+	// error through the Deputy's Logger, unless its Verbosity is Silent, and
+	// recording it in the Result's PipeErrors, without letting it make Run
+	// fail.
+	LogPipeError
+
+	// KillOnPipeError kills the command as soon as a pipe error occurs, and
+	// returns the PipeError from Run.
+	KillOnPipeError
+)
+
+// pipeFailures applies a PipeErrorPolicy to the pipe errors of a single run.
+type pipeFailures struct {
+	policy PipeErrorPolicy
+	// logf reports pipe errors under LogPipeError.
+	logf func(v Verbosity, format string, args ...interface{})
+
+	mu   sync.Mutex
+	errs []error
+	proc *os.Process
+	// panic is the first panic in a log function, if any.
+	panic *CallbackPanicError
+}
+
+// started records the process to kill for KillOnPipeError.
+func (p *pipeFailures) started(proc *os.Process) {
+	p.mu.Lock()
+	p.proc = proc
+	p.mu.Unlock()
+}
+
+// fail records a pipe error and handles it according to the policy.
+func (p *pipeFailures) fail(err *PipeError) {
+	if p.policy == LogPipeError {
+		p.logf(ErrorsOnly, "%v", err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.errs = append(p.errs, err)
+	if len(p.errs) == 1 && p.policy == KillOnPipeError && p.proc != nil {
+		// this may fail if the process has already exited, which is fine.
+		_ = p.proc.Kill()
+	}
+}
+
+// panicked records a panic in a log function, and kills the command.
+func (p *pipeFailures) panicked(err *CallbackPanicError) {
+	p.logf(Normal, "%v", err)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.panic != nil {
+		return
+	}
+	p.panic = err
+	if p.proc != nil {
+		_ = p.proc.Kill()
+	}
+}
+
+// all returns every pipe error recorded, whatever the policy.
+func (p *pipeFailures) all() []error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]error(nil), p.errs...)
+}
+
+// result returns the error Run should return, given the command's own error.
+func (p *pipeFailures) result(err error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case p.panic != nil:
+		// the command's own error is just from being killed.
+		return p.panic
+	case len(p.errs) == 0 || p.policy == IgnorePipeError || p.policy == LogPipeError:
+		return err
+	case p.policy == KillOnPipeError:
+		// the command's own error is just from being killed.
+		return p.errs[0]
+	case err == nil && len(p.errs) == 1:
+		return p.errs[0]
+	}
+	return errors.Join(append([]error{err}, p.errs...)...)
+}
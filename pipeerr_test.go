@@ -0,0 +1,95 @@
+package deputy
+
+import (
+	"bufio"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPipeErrorTooLong(t *testing.T) {
+	long := strings.Repeat("x", bufio.MaxScanTokenSize+1)
+	log := func([]byte) {}
+
+	err := Deputy{StdoutLog: log}.Run(maker{stdout: long}.make())
+	var perr *PipeError
+	if !errors.As(err, &perr) || perr.Stream != Stdout || !errors.Is(err, bufio.ErrTooLong) {
+		t.Fatalf("expected stdout PipeError but got %v", err)
+	}
+
+	var res Result
+	err = Deputy{StdoutLog: log, PipeErrors: IgnorePipeError}.Run(maker{stdout: long}.make(), WithDefer(func(r Result) { res = r }))
+	if err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	if len(res.PipeErrors) != 1 || !errors.Is(res.PipeErrors[0], bufio.ErrTooLong) {
+		t.Fatalf("expected the ignored error in the Result, got %v", res.PipeErrors)
+	}
+
+	err = Deputy{StdoutLog: log}.Run(maker{stdout: long, exit: 1}.make())
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || !errors.As(err, &perr) || perr.Stream != Stdout {
+		t.Fatalf("expected the command's error and the PipeError but got %v", err)
+	}
+}
+
+func TestPipeErrorKill(t *testing.T) {
+	cmd := maker{
+		stdout:  "foo",
+		timeout: 2 * time.Second,
+	}.make()
+	writeErr := errors.New("write failed")
+	start := time.Now()
+	// the helper's regular output comes after its timeout, so the sink has
+	// to fail on a line written before that.
+	cmd.Env = append(cmd.Env, helperEarlyStdout+"=early")
+	err := Deputy{
+		Sinks:      []Sink{&testSink{writeErr: writeErr}},
+		PipeErrors: KillOnPipeError,
+	}.Run(cmd)
+	if !errors.Is(err, writeErr) {
+		t.Fatalf("expected write error but got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("command was not killed on the pipe error")
+	}
+}
+
+func TestReadBuffer(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	var got []string
+	d := Deputy{ReadBuffer: 256, StdoutLog: func(b []byte) { got = append(got, string(b)) }}
+	if err := d.Run(maker{stdout: long}.make()); err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	if len(got) != 1 || got[0] != long {
+		t.Fatalf("unexpected lines %q", got)
+	}
+
+	d.ReadBuffer = 16
+	err := d.Run(maker{stdout: long}.make())
+	var perr *PipeError
+	if !errors.As(err, &perr) || !errors.Is(err, bufio.ErrTooLong) {
+		t.Fatalf("expected line too long pipe error, got %v", err)
+	}
+}
+
+func TestCallbackPanic(t *testing.T) {
+	d := Deputy{StdoutLog: func(b []byte) { panic("boom") }}
+	start := time.Now()
+	err := d.Run(maker{stdout: "line", timeout: 100 * time.Millisecond}.make())
+	var pe *CallbackPanicError
+	if !errors.As(err, &pe) || pe.Value != "boom" || pe.Stream != Stdout || !strings.Contains(string(pe.Stack), "TestCallbackPanic") {
+		t.Fatalf("expected a CallbackPanicError, got %v", err)
+	}
+
+	// the panicking function kills a command that would otherwise run on.
+	cmd := maker{timeout: 5 * time.Second}.make()
+	cmd.Env = append(cmd.Env, helperEarlyStdout+"=early")
+	err = d.Run(cmd)
+	if !errors.As(err, &pe) || time.Since(start) > 3*time.Second {
+		t.Fatalf("expected the command to be killed after the panic, got %v after %v", err, time.Since(start))
+	}
+}
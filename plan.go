@@ -0,0 +1,78 @@
+package deputy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Plan is a batch of commands and the settings to run them with, that can be
+// written out on one machine and read back and run on another.  The Deputy
+// the plan is run with supplies everything that can't be written out, such as
+// log functions and sinks.
+//
+// Plans are written as JSON, so the values of secrets in the commands are
+// redacted as described in Spec.MarshalJSON.  The machine running the plan
+// has to supply the secrets in the commands' environments, through the
+// Deputy's Env, whose values take the place of the redacted ones.  Secrets in
+// arguments can't be supplied that way, so a plan with a redacted argument
+// refuses to run; pass such secrets in the environment instead.
+type Plan struct {
+	// Commands are the commands to run, in batch order.
+	Commands []Spec `json:"commands"`
+	// Parallel is the most commands run at the same time, as in Batch.
+	Parallel int `json:"parallel,omitempty"`
+	// Timeout, if non-zero, limits how long the whole plan may take, as in
+	// Batch.
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// Ordered keeps the output of each command together, as in Batch.
+	Ordered bool `json:"ordered,omitempty"`
+	// CommandTimeout, if non-zero, limits how long each command may run.
+	CommandTimeout time.Duration `json:"command_timeout,omitempty"`
+	// Grace, if non-zero, is the Deputy's Grace period for each command.
+	Grace time.Duration `json:"grace,omitempty"`
+	// Errors, if non-zero, is how errors from the commands are handled.
+	Errors ErrorHandling `json:"errors,omitempty"`
+}
+
+// ReadPlan reads a plan written by Plan.Write.
+func ReadPlan(r io.Reader) (Plan, error) {
+	var p Plan
+	err := json.NewDecoder(r).Decode(&p)
+	return p, err
+}
+
+// Write writes the plan to w as JSON.
+func (p Plan) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(p)
+}
+
+// Run runs the plan's commands as a Batch with d, after applying the plan's
+// settings to it.
+func (p Plan) Run(d Deputy) ([]Result, error) {
+	if p.CommandTimeout != 0 {
+		d.Timeout = p.CommandTimeout
+	}
+	if p.Grace != 0 {
+		d.Grace = p.Grace
+	}
+	if p.Errors != 0 {
+		d.Errors = p.Errors
+	}
+	cmds := make([]*exec.Cmd, len(p.Commands))
+	for i, s := range p.Commands {
+		for _, arg := range s.Args {
+			if arg == Redacted || strings.HasSuffix(arg, "="+Redacted) {
+				return nil, fmt.Errorf("deputy: command %d of the plan has a redacted argument %q", i, arg)
+			}
+		}
+		cmds[i] = s.Command()
+	}
+	b := Batch{Deputy: d, Parallel: p.Parallel, Timeout: p.Timeout, Ordered: p.Ordered}
+	return b.Run(cmds...)
+}
@@ -0,0 +1,57 @@
+package deputy
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlan(t *testing.T) {
+	p := Plan{
+		Commands: []Spec{
+			cmdSpec(maker{stdout: "foo!"}.make()),
+			cmdSpec(maker{stderr: "bar!", exit: 1}.make()),
+		},
+		Parallel:       1,
+		CommandTimeout: time.Minute,
+		Errors:         FromStderr,
+	}
+	buf := &bytes.Buffer{}
+	if err := p.Write(buf); err != nil {
+		t.Fatalf("unexpected error writing plan: %v", err)
+	}
+	read, err := ReadPlan(buf)
+	if err != nil {
+		t.Fatalf("unexpected error reading plan: %v", err)
+	}
+	if !reflect.DeepEqual(read, p) {
+		t.Fatalf("expected plan %+v but read %+v", p, read)
+	}
+
+	results, err := read.Run(Deputy{})
+	var merr *MultiError
+	if !errors.As(err, &merr) || len(merr.Failures) != 1 || merr.Failures[0].Index != 1 {
+		t.Fatalf("expected second command to fail, got %v", err)
+	}
+	if len(results) != 2 || results[0].Err != nil || results[1].Err.Error() != "exit status 1: bar!" {
+		t.Fatalf("unexpected results %+v", results)
+	}
+}
+
+func TestPlanRedactedArgs(t *testing.T) {
+	p := Plan{Commands: []Spec{{Name: "deploy", Args: []string{"--token", "abc"}}}}
+	buf := &bytes.Buffer{}
+	if err := p.Write(buf); err != nil {
+		t.Fatalf("unexpected error writing plan: %v", err)
+	}
+	read, err := ReadPlan(buf)
+	if err != nil {
+		t.Fatalf("unexpected error reading plan: %v", err)
+	}
+	if _, err := read.Run(Deputy{}); err == nil || !strings.Contains(err.Error(), "redacted argument") {
+		t.Fatalf("expected a plan with a redacted argument not to run, got %v", err)
+	}
+}
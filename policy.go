@@ -0,0 +1,242 @@
+package deputy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Policy decides whether a command may be run.  A Deputy with a Policy checks
+// every command with it just before the command is started, and refuses to
+// start commands the Policy rejects.
+type Policy interface {
+	// Check returns a non-nil error if the program at path may not be run
+	// with the given arguments (including the program name, as in
+	// exec.Cmd.Args) and environment.
+	Check(path string, args, env []string) error
+}
+
+// PolicyFunc adapts an ordinary function to the Policy interface.
+type PolicyFunc func(path string, args, env []string) error
+
+// Check calls f(path, args, env).
+func (f PolicyFunc) Check(path string, args, env []string) error {
+	return f(path, args, env)
+}
+
+// ErrPolicy is wrapped by the error returned from Run when a Deputy's Policy
+// rejects a command.
+var ErrPolicy = errors.New("deputy: command rejected by policy")
+
+// Allowlist is a Policy that only allows running the programs it lists.  An
+// entry containing a path separator must match the command's full path.
+// Other entries are looked up in this process's PATH, as exec.Command looks
+// up a program's name, and match only the program found, so that "git"
+// allows /usr/bin/git but not a git in some other directory.
+type Allowlist []string
+
+// Check implements Policy.
+func (a Allowlist) Check(path string, args, env []string) error {
+	for _, entry := range a {
+		if strings.ContainsAny(entry, `/\`) {
+			if filepath.Clean(entry) == filepath.Clean(path) {
+				return nil
+			}
+			continue
+		}
+		if found, err := exec.LookPath(entry); err == nil && sameFile(found, path) {
+			return nil
+		}
+	}
+	return errors.New(path + " is not in the allowlist")
+}
+
+// sameFile reports whether a and b are paths to the same file.
+func sameFile(a, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	afi, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bfi, err := os.Stat(b)
+	return err == nil && os.SameFile(afi, bfi)
+}
+
+// Denylist is a Policy that allows running any program except those it lists.
+// An entry containing a path separator must match the command's full path;
+// other entries match the program's base name wherever it is (ignoring the
+// extension on windows), so that "rm" denies every rm.
+type Denylist []string
+
+// Check implements Policy.
+func (d Denylist) Check(path string, args, env []string) error {
+	for _, entry := range d {
+		if matchProgram(entry, path) {
+			return errors.New(path + " is in the denylist")
+		}
+	}
+	return nil
+}
+
+// matchProgram reports whether the denylist entry matches the program at
+// path.
+func matchProgram(entry, path string) bool {
+	if strings.ContainsAny(entry, `/\`) {
+		return filepath.Clean(entry) == filepath.Clean(path)
+	}
+	name := filepath.Base(path)
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(entry, name) ||
+			strings.EqualFold(entry, strings.TrimSuffix(name, filepath.Ext(name)))
+	}
+	return entry == name
+}
+
+// Policies is a Policy that allows a command only if every one of its
+// policies does.
+type Policies []Policy
+
+// Check implements Policy, returning the first error from its policies.
+func (ps Policies) Check(path string, args, env []string) error {
+	for _, p := range ps {
+		if err := p.Check(path, args, env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InjectionGuard is a Policy that rejects commands whose arguments look like
+// untrusted input was pasted into them.  It rejects arguments with embedded
+// NUL bytes or newlines, and scripts for a shell's -c flag (or cmd's /c, or
+// powershell's -Command) that contain:
+//
+//	$( ` ${          command substitution and parameter expansion
+//	; & && | ||      chained or background commands, unless AllowChaining
+//	> <              redirection, unless AllowRedirects
+//
+// Nothing else is checked; in particular cmd's %VAR% expansion and glob
+// characters are allowed.  It is a heuristic, meant to catch mistakes before
+// they are exploited, and will reject some legitimate commands, such as
+// multi-line commit messages, so it is opt-in.
+type InjectionGuard struct {
+	// AllowChaining, if true, allows shell scripts to chain commands with
+	// ;, &, &&, || and |, for callers that build pipelines on purpose.
+	AllowChaining bool
+	// AllowRedirects, if true, allows shell scripts to redirect with > and
+	// <.
+	AllowRedirects bool
+	// AllowNewlines, if true, allows newlines in arguments other than shell
+	// scripts.
+	AllowNewlines bool
+}
+
+// shellNames are the programs InjectionGuard treats as shells.
+var shellNames = []string{"sh", "bash", "dash", "zsh", "ksh", "ash", "fish", "cmd", "powershell", "pwsh"}
+
+// substitutions are the shell syntax that substitutes a command's output or
+// a variable's value into a script.
+var substitutions = []string{"$(", "`", "${"}
+
+// chainOperators are the shell operators that chain commands together, or
+// run them in the background.
+var chainOperators = []string{";", "&&", "||", "|", "&"}
+
+// redirectOperators are the shell operators that redirect a command's input
+// or output.
+var redirectOperators = []string{">", "<"}
+
+// Check implements Policy.
+func (g InjectionGuard) Check(path string, args, env []string) error {
+	script := -1
+	if name := shellName(path); name != "" {
+		script = shellScript(name, args)
+	}
+	for i, arg := range args {
+		if strings.ContainsRune(arg, 0) {
+			return fmt.Errorf("argument %d contains a NUL byte", i)
+		}
+		if i == script {
+			if err := g.checkScript(arg); err != nil {
+				return fmt.Errorf("argument %d to %s: %v", i, path, err)
+			}
+			continue
+		}
+		if !g.AllowNewlines && strings.ContainsAny(arg, "\r\n") {
+			return fmt.Errorf("argument %d contains a newline", i)
+		}
+	}
+	return nil
+}
+
+// checkScript returns an error if a shell script looks injected.
+func (g InjectionGuard) checkScript(script string) error {
+	if strings.ContainsAny(script, "\r\n") {
+		return errors.New("script contains a newline")
+	}
+	for _, sub := range substitutions {
+		if strings.Contains(script, sub) {
+			return fmt.Errorf("script contains substitution %q", sub)
+		}
+	}
+	if !g.AllowChaining {
+		for _, op := range chainOperators {
+			if strings.Contains(script, op) {
+				return fmt.Errorf("script chains commands with %q", op)
+			}
+		}
+	}
+	if !g.AllowRedirects {
+		for _, op := range redirectOperators {
+			if strings.Contains(script, op) {
+				return fmt.Errorf("script redirects with %q", op)
+			}
+		}
+	}
+	return nil
+}
+
+// shellName returns the name of the shell at path, in lower case and without
+// an .exe extension, or "" if the program isn't a shell.
+func shellName(path string) string {
+	// windows paths are split here too, so the guard works the same on every
+	// platform.
+	name := strings.ToLower(path[strings.LastIndexAny(path, `/\`)+1:])
+	name = strings.TrimSuffix(name, ".exe")
+	for _, sh := range shellNames {
+		if name == sh {
+			return name
+		}
+	}
+	return ""
+}
+
+// shellScript returns the index in args of the script given to the shell
+// called name by its -c flag (or cmd's /c, or powershell's -Command), or -1 if
+// there isn't one.  Flags combined with c, such as -ec, are only recognized
+// for POSIX shells, since powershell's flags, such as -NonInteractive, are
+// whole words.
+func shellScript(name string, args []string) int {
+	for i := 1; i < len(args)-1; i++ {
+		switch a := args[i]; {
+		case strings.EqualFold(a, "/c"), strings.EqualFold(a, "-c"), strings.EqualFold(a, "-command"):
+			return i + 1
+		}
+	}
+	if name == "cmd" || name == "powershell" || name == "pwsh" {
+		return -1
+	}
+	for i := 1; i < len(args)-1; i++ {
+		a := args[i]
+		if strings.HasPrefix(a, "-") && !strings.HasPrefix(a, "--") && strings.ContainsRune(a[1:], 'c') {
+			return i + 1
+		}
+	}
+	return -1
+}
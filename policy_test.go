@@ -0,0 +1,117 @@
+package deputy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestPolicyRejects(t *testing.T) {
+	cmd := maker{}.make()
+	name := filepath.Base(os.Args[0])
+	err := Deputy{Policy: Denylist{name}}.Run(cmd)
+	if !errors.Is(err, ErrPolicy) {
+		t.Fatalf("expected policy error but got %v", err)
+	}
+	if cmd.Process != nil {
+		t.Fatal("command was started despite being rejected")
+	}
+
+	t.Setenv("PATH", filepath.Dir(os.Args[0]))
+	err = Deputy{Policy: Allowlist{name}}.Run(maker{}.make())
+	if err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+}
+
+func TestPolicyFunc(t *testing.T) {
+	var gotArgs []string
+	p := PolicyFunc(func(path string, args, env []string) error {
+		gotArgs = args
+		return nil
+	})
+	cmd := maker{}.make()
+	if err := (Deputy{Policy: p}).Run(cmd); err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	if len(gotArgs) != len(cmd.Args) || gotArgs[0] != cmd.Args[0] {
+		t.Fatalf("policy got args %q, expected %q", gotArgs, cmd.Args)
+	}
+}
+
+func TestAllowlistMatch(t *testing.T) {
+	ext := ""
+	if runtime.GOOS == "windows" {
+		ext = ".exe"
+	}
+	bin, evil := t.TempDir(), t.TempDir()
+	for _, p := range []string{filepath.Join(bin, "tool"+ext), filepath.Join(evil, "tool"+ext), filepath.Join(bin, "toolkit"+ext)} {
+		if err := os.WriteFile(p, nil, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin)
+	a := Allowlist{"tool", "/usr/bin/make"}
+	for _, path := range []string{filepath.Join(bin, "tool"+ext), "/usr/bin/make"} {
+		if err := a.Check(path, nil, nil); err != nil {
+			t.Errorf("expected %s to be allowed: %v", path, err)
+		}
+	}
+	for _, path := range []string{filepath.Join(evil, "tool"+ext), filepath.Join(bin, "toolkit"+ext), "/usr/local/bin/make"} {
+		if err := a.Check(path, nil, nil); err == nil {
+			t.Errorf("expected %s to be rejected", path)
+		}
+	}
+}
+
+func TestInjectionGuard(t *testing.T) {
+	tests := []struct {
+		guard InjectionGuard
+		path  string
+		args  []string
+		ok    bool
+	}{
+		{InjectionGuard{}, "/bin/sh", []string{"sh", "-c", "ls -l"}, true},
+		{InjectionGuard{}, "/bin/sh", []string{"sh", "-c", "ls $(cat list)"}, false},
+		{InjectionGuard{}, "/bin/bash", []string{"bash", "-ec", "echo `id`"}, false},
+		{InjectionGuard{}, "/bin/sh", []string{"sh", "-c", "ls; rm -rf /"}, false},
+		{InjectionGuard{AllowChaining: true}, "/bin/sh", []string{"sh", "-c", "ls | wc -l"}, true},
+		{InjectionGuard{}, `C:\Windows\System32\cmd.exe`, []string{"cmd", "/C", "dir && del x"}, false},
+		{InjectionGuard{}, "/usr/bin/git", []string{"git", "commit", "-m", "a;b|c"}, true},
+		{InjectionGuard{}, "/usr/bin/git", []string{"git", "commit", "-m", "title\n\nbody"}, false},
+		{InjectionGuard{AllowNewlines: true}, "/usr/bin/git", []string{"git", "commit", "-m", "title\n\nbody"}, true},
+		{InjectionGuard{AllowNewlines: true}, "/bin/sh", []string{"sh", "-c", "ls\nrm x"}, false},
+		{InjectionGuard{}, "/bin/ls", []string{"ls", "a\x00b"}, false},
+		{InjectionGuard{}, "/bin/sh", []string{"sh", "-c", "sleep 100 & curl evil"}, false},
+		{InjectionGuard{AllowChaining: true}, "/bin/sh", []string{"sh", "-c", "sleep 1 & wait"}, true},
+		{InjectionGuard{}, "/bin/sh", []string{"sh", "-c", "echo x > /etc/passwd"}, false},
+		{InjectionGuard{}, "/bin/sh", []string{"sh", "-c", "mail me < /etc/shadow"}, false},
+		{InjectionGuard{AllowRedirects: true}, "/bin/sh", []string{"sh", "-c", "ls > out.txt"}, true},
+		{InjectionGuard{AllowChaining: true, AllowRedirects: true}, "/bin/sh", []string{"sh", "-c", "echo ${HOME}"}, false},
+	}
+	for _, test := range tests {
+		err := test.guard.Check(test.path, test.args, nil)
+		if (err == nil) != test.ok {
+			t.Errorf("%+v checking %q: got error %v", test.guard, test.args, err)
+		}
+	}
+
+	for _, sh := range Shells["windows"] {
+		cmd := sh.Command("dir; whoami | more $(whoami)")
+		if err := (InjectionGuard{}).Check(sh.Path, cmd.Args, nil); err == nil {
+			t.Errorf("expected the guard to check the script given to %s %q", sh.Path, sh.Args)
+		}
+		cmd = sh.Command("dir")
+		if err := (InjectionGuard{}).Check(sh.Path, cmd.Args, nil); err != nil {
+			t.Errorf("unexpected error for a plain script given to %s: %v", sh.Path, err)
+		}
+	}
+
+	cmd := shellCommand("echo $(id)")
+	err := Deputy{Policy: Policies{Denylist{"nothing"}, InjectionGuard{}}}.Run(cmd)
+	if !errors.Is(err, ErrPolicy) || cmd.Process != nil {
+		t.Fatalf("expected the guard to reject the command, got %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package deputy
+
+import "time"
+
+// Strict returns a Deputy for running commands from services, where a
+// command must not be allowed to hang or to fail silently.  Commands are
+// stopped after ten minutes, given five seconds to exit after SIGTERM, and
+// given five seconds after exiting for their output to end.  A failed
+// command's error ends with what it wrote to stderr, and the scripts given to
+// shells are checked by an InjectionGuard, which also rejects NUL bytes in
+// any argument but allows newlines outside of scripts.  Arguments that look
+// like secrets are always redacted from errors and logs.  Only the command
+// itself is stopped, not the processes it started, since there is no way to
+// kill a whole process tree yet; set FindOrphans to see any it leaves behind.
+// Adjust the returned Deputy as needed.
+func Strict() Deputy {
+	return Deputy{
+		Timeout:   10 * time.Minute,
+		Grace:     5 * time.Second,
+		WaitDelay: 5 * time.Second,
+		Errors:    FromStderr,
+		Policy:    InjectionGuard{AllowNewlines: true},
+	}
+}
+
+// Interactive returns a Deputy for running commands a user interacts with,
+// such as an editor, from a terminal program.  The command gets this
+// process's stdin, stdout and stderr, and is given a second to exit after
+// SIGTERM when canceled.  Set Foreground as well when the command reads from
+// the terminal itself.
+func Interactive() Deputy {
+	return Deputy{
+		InheritStdio: true,
+		Grace:        time.Second,
+	}
+}
+
+// Unattended returns a Deputy for running commands from cron jobs and batch
+// scripts, where output is only wanted when something goes wrong.  Output is
+// copied to this process's stdout and stderr only if the command fails, up to
+// its last 64KiB, in the manner of chronic(1), and a failed command's error
+// ends with what it wrote to stderr.  Wrap it in a Retry to retry transient
+// failures.
+func Unattended() Deputy {
+	return Deputy{
+		InheritStdio: true,
+		Quiet:        64 << 10,
+		Errors:       FromStderr,
+		Grace:        5 * time.Second,
+	}
+}
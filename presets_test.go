@@ -0,0 +1,22 @@
+package deputy
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPresets(t *testing.T) {
+	for name, d := range map[string]Deputy{"Strict": Strict(), "Interactive": Interactive(), "Unattended": Unattended()} {
+		if err := d.Validate(); err != nil {
+			t.Errorf("%s preset is invalid: %v", name, err)
+		}
+	}
+	if err := Strict().Shell("echo hi; echo there"); !errors.Is(err, ErrPolicy) {
+		t.Fatal("expected Strict to reject chained shell commands")
+	}
+	cmd := maker{}.make()
+	cmd.Args = append(cmd.Args, "--", "title\n\nbody")
+	if err := Strict().Run(cmd); err != nil {
+		t.Fatalf("expected Strict to allow newlines in a program's arguments, got %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+package deputy
+
+// ProcAttr is a set of process attributes that are applied to a command's
+// SysProcAttr in the right way for each platform.  Attributes that don't
+// apply to a platform are ignored on it.
+type ProcAttr uint
+
+const (
+	// NewProcessGroup starts the command in a process group of its own, so
+	// that signals sent to this process's group, such as from Ctrl-C, don't
+	// reach it.  On windows it is created with CREATE_NEW_PROCESS_GROUP.
+	NewProcessGroup ProcAttr = 1 << iota
+	// NewSession starts the command in a new session, and so a new process
+	// group, without a controlling terminal.  Unix only.
+	NewSession
+	// Detached starts the command detached from this process's terminal or
+	// console: in a new session on unix, and with DETACHED_PROCESS and
+	// CREATE_NEW_PROCESS_GROUP on windows.
+	Detached
+	// HideWindow keeps the command from opening a console window.  Windows
+	// only.
+	HideWindow
+)
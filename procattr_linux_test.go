@@ -0,0 +1,29 @@
+package deputy
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestProcAttr(t *testing.T) {
+	// fields 5 and 6 of stat are the process group and session.
+	for _, test := range []struct {
+		attr  ProcAttr
+		field string
+	}{
+		{NewProcessGroup, "5"},
+		{NewSession, "6"},
+		{Detached, "6"},
+	} {
+		var res Result
+		out, err := Deputy{ProcAttr: test.attr}.Output(shellCommand("cut -d' ' -f"+test.field+" /proc/$$/stat"),
+			WithDefer(func(r Result) { res = r }))
+		if err != nil {
+			t.Fatalf("unexpected error returned from Output: %v", err)
+		}
+		if got := strings.TrimSpace(string(out)); got != strconv.Itoa(res.Pid) {
+			t.Errorf("expected field %s to be the command's pid %d with attr %d, got %s", test.field, res.Pid, test.attr, got)
+		}
+	}
+}
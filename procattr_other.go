@@ -0,0 +1,8 @@
+//go:build !unix && !windows
+
+package deputy
+
+import "os/exec"
+
+// applyProcAttr does nothing on this platform.
+func applyProcAttr(cmd *exec.Cmd, attr ProcAttr) {}
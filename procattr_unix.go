@@ -0,0 +1,28 @@
+//go:build unix
+
+package deputy
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// applyProcAttr sets up cmd's SysProcAttr according to attr.
+func applyProcAttr(cmd *exec.Cmd, attr ProcAttr) {
+	if attr == 0 {
+		return
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	if attr&(NewSession|Detached) != 0 {
+		// a session leader is already the leader of a new process group,
+		// and can't be moved to another.
+		cmd.SysProcAttr.Setsid = true
+		cmd.SysProcAttr.Setpgid = false
+		return
+	}
+	if attr&NewProcessGroup != 0 {
+		cmd.SysProcAttr.Setpgid = true
+	}
+}
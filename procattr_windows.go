@@ -0,0 +1,32 @@
+package deputy
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// process creation flags missing from syscall.
+const (
+	detachedProcess = 0x00000008
+	createNoWindow  = 0x08000000
+)
+
+// applyProcAttr sets up cmd's SysProcAttr according to attr.
+func applyProcAttr(cmd *exec.Cmd, attr ProcAttr) {
+	if attr == 0 {
+		return
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	if attr&(NewProcessGroup|Detached) != 0 {
+		cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+	}
+	if attr&Detached != 0 {
+		cmd.SysProcAttr.CreationFlags |= detachedProcess
+	}
+	if attr&HideWindow != 0 {
+		cmd.SysProcAttr.HideWindow = true
+		cmd.SysProcAttr.CreationFlags |= createNoWindow
+	}
+}
@@ -0,0 +1,52 @@
+package deputy
+
+import "sync"
+
+// quietOutput holds back a command's output, in the manner of chronic(1),
+// until it is known whether the command failed.
+type quietOutput struct {
+	limit int
+	// stdout and stderr are where the held lines go if the command fails.
+	stdout, stderr func([]byte)
+
+	mu  sync.Mutex
+	buf lineBuffer
+}
+
+// holdOutput replaces the Deputy's log functions with ones that hold their
+// lines back until the command is done.
+func (d *Deputy) holdOutput() {
+	q := &quietOutput{limit: d.Quiet, stdout: d.StdoutLog, stderr: d.StderrLog}
+	if d.StdoutLog != nil {
+		d.StdoutLog = q.log(Stdout)
+	}
+	if d.StderrLog != nil {
+		d.StderrLog = q.log(Stderr)
+	}
+	d.quiet = q
+}
+
+// log returns a log function that holds the lines of stream s.
+func (q *quietOutput) log(s Stream) func([]byte) {
+	return func(b []byte) {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		q.buf.add(Line{Stream: s, Text: b}, q.limit)
+	}
+}
+
+// release passes the held lines on, in the order they were written.
+func (q *quietOutput) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, l := range q.buf.lines {
+		log := q.stdout
+		if l.Stream == Stderr {
+			log = q.stderr
+		}
+		if log != nil {
+			log(l.Text)
+		}
+	}
+	q.buf = lineBuffer{}
+}
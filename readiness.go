@@ -0,0 +1,102 @@
+package deputy
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Readiness is a check that a command that has been started is ready for
+// use, such as a server that is accepting connections.
+type Readiness interface {
+	// Ready waits until the command is ready, returning an error if it isn't
+	// within timeout.
+	Ready(timeout time.Duration) error
+}
+
+// ReadinessFunc is a function that implements Readiness.
+type ReadinessFunc func(timeout time.Duration) error
+
+// Ready implements Readiness by calling f.
+func (f ReadinessFunc) Ready(timeout time.Duration) error {
+	return f(timeout)
+}
+
+// PortReady returns a Readiness that waits for connections to be accepted on
+// addr, as WaitForPort does.
+func PortReady(addr string) Readiness {
+	return ReadinessFunc(func(timeout time.Duration) error {
+		return WaitForPort(addr, timeout)
+	})
+}
+
+// FileReady returns a Readiness that waits for a file to exist at path, as
+// WaitForFile does.
+func FileReady(path string) Readiness {
+	return ReadinessFunc(func(timeout time.Duration) error {
+		return WaitForFile(path, timeout)
+	})
+}
+
+// SocketReady returns a Readiness that waits for connections to be accepted
+// on the unix socket at path, as WaitForSocket does.
+func SocketReady(path string) Readiness {
+	return ReadinessFunc(func(timeout time.Duration) error {
+		return WaitForSocket(path, timeout)
+	})
+}
+
+// HTTPReady returns a Readiness that waits for a GET of url to return the
+// given status, as WaitForHTTP does.
+func HTTPReady(url string, status int) Readiness {
+	return ReadinessFunc(func(timeout time.Duration) error {
+		return WaitForHTTP(url, status, timeout)
+	})
+}
+
+// OutputReady is a Readiness that waits for the command to output a line
+// matching a pattern, such as "listening on".  It is also a Sink, and must be
+// in the Sinks of the Deputy running the command to see its output.  Once it
+// is ready it stays ready.
+type OutputReady struct {
+	pattern *regexp.Regexp
+
+	once    sync.Once
+	matched chan struct{}
+}
+
+// NewOutputReady returns an OutputReady that waits for a line matching
+// pattern.
+func NewOutputReady(pattern *regexp.Regexp) *OutputReady {
+	return &OutputReady{pattern: pattern, matched: make(chan struct{})}
+}
+
+// Ready implements Readiness.
+func (o *OutputReady) Ready(timeout time.Duration) error {
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-o.matched:
+		return nil
+	case <-t.C:
+		return fmt.Errorf("deputy: no output matching %q within %v", o.pattern, timeout)
+	}
+}
+
+// Open implements Sink.
+func (o *OutputReady) Open() error { return nil }
+
+// Flush implements Sink.
+func (o *OutputReady) Flush() error { return nil }
+
+// Close implements Sink.
+func (o *OutputReady) Close() error { return nil }
+
+// WriteLine implements Sink, checking the line against the pattern.
+func (o *OutputReady) WriteLine(l Line) error {
+	if o.pattern.Match(l.Text) {
+		o.once.Do(func() { close(o.matched) })
+	}
+	return nil
+}
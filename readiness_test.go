@@ -0,0 +1,35 @@
+package deputy
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestOutputReady(t *testing.T) {
+	ready := NewOutputReady(regexp.MustCompile("^listening on"))
+	done := make(chan error)
+	go func() {
+		done <- Deputy{Sinks: []Sink{ready}}.Run(maker{stderr: "listening on :80", timeout: 200 * time.Millisecond}.make())
+	}()
+	if err := ready.Ready(5 * time.Second); err != nil {
+		t.Fatalf("unexpected error waiting for output: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	if err := NewOutputReady(regexp.MustCompile("never")).Ready(10 * time.Millisecond); err == nil {
+		t.Fatal("expected error waiting for output that never comes")
+	}
+}
+
+func TestReadinessFunc(t *testing.T) {
+	var got time.Duration
+	var r Readiness = ReadinessFunc(func(timeout time.Duration) error {
+		got = timeout
+		return nil
+	})
+	if err := r.Ready(time.Second); err != nil || got != time.Second {
+		t.Fatalf("unexpected call %v, %v", got, err)
+	}
+}
@@ -0,0 +1,152 @@
+package deputy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// readyPoll is how often readiness probes check for readiness.
+const readyPoll = 50 * time.Millisecond
+
+// WaitReady waits for a command started with Start to become ready, as ready
+// says, such as with PortReady(":5432").  It returns an error at once if the
+// command exits first, wrapping the command's own error if it has one.  If the
+// command isn't ready within timeout, or ctx is done first, it is killed, and
+// WaitReady returns once it has exited; Wait still returns the run's error.
+func (c *Cmd) WaitReady(ctx context.Context, ready Readiness, timeout time.Duration) error {
+	if c.done == nil {
+		return errors.New("deputy: not started")
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- ready.Ready(timeout) }()
+	var err error
+	select {
+	case err = <-errc:
+		if err == nil {
+			return nil
+		}
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-c.done:
+		if c.err != nil {
+			return fmt.Errorf("deputy: command exited before it was ready: %w", c.err)
+		}
+		return errors.New("deputy: command exited before it was ready")
+	}
+	// the command may have exited already, which is fine.
+	_ = c.Process.Kill()
+	<-c.done
+	return err
+}
+
+// WaitForPort waits until something accepts TCP connections on addr, such as
+// a server command that has just been started, checking every 50ms.  It
+// returns an error if nothing does within timeout.  Cmd.WaitReady with
+// PortReady also kills the command if it doesn't become ready.
+func WaitForPort(addr string, timeout time.Duration) error {
+	return waitForDial("tcp", addr, time.Now().Add(timeout), timeout)
+}
+
+// WaitForFile waits until a file exists at path, for commands that signal
+// they are ready by creating a file.  On linux it is woken by inotify when the
+// file's directory changes; elsewhere it checks every 50ms.  It returns an
+// error if the file doesn't appear within timeout.
+func WaitForFile(path string, timeout time.Duration) error {
+	if err := waitForFile(path, time.Now().Add(timeout)); err != nil {
+		return fmt.Errorf("deputy: %s did not appear within %v: %v", path, timeout, err)
+	}
+	return nil
+}
+
+// WaitForSocket waits until a unix socket exists at path and something
+// accepts connections on it.  It returns an error if that doesn't happen
+// within timeout.
+func WaitForSocket(path string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	if err := waitForFile(path, deadline); err != nil {
+		return fmt.Errorf("deputy: %s did not appear within %v: %v", path, timeout, err)
+	}
+	return waitForDial("unix", path, deadline, timeout)
+}
+
+// WaitForHTTP waits until a GET of url returns the given status code, such as
+// a web service's health endpoint returning 200, or any 2xx status if status
+// is zero.  It checks first after 50ms, backing off to once a second.  It
+// returns an error if url doesn't return the status within timeout.
+func WaitForHTTP(url string, status int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	client := &http.Client{}
+	backoff := Backoff{Initial: readyPoll, Multiplier: 2, Max: time.Second}
+	for attempt := 2; ; attempt++ {
+		client.Timeout = capWait(time.Second, deadline)
+		err := checkHTTP(client, url, status)
+		if err == nil {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("deputy: %s not ready after %v: %v", url, timeout, err)
+		}
+		time.Sleep(capWait(backoff.Delay(attempt), deadline))
+	}
+}
+
+// capWait returns d, or the time left until the deadline if that is shorter,
+// but at least a millisecond, so that it can be used as a timeout.
+func capWait(d time.Duration, deadline time.Time) time.Duration {
+	if left := time.Until(deadline); left < d {
+		d = left
+	}
+	if d < time.Millisecond {
+		d = time.Millisecond
+	}
+	return d
+}
+
+// checkHTTP returns an error unless a GET of url returns the given status, or
+// a 2xx status if status is zero.
+func checkHTTP(client *http.Client, url string, status int) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode == status || status == 0 && resp.StatusCode/100 == 2 {
+		return nil
+	}
+	return fmt.Errorf("status %s", resp.Status)
+}
+
+// waitForDial waits until addr can be dialed, or the deadline passes.
+func waitForDial(network, addr string, deadline time.Time, timeout time.Duration) error {
+	for {
+		conn, err := net.DialTimeout(network, addr, capWait(readyPoll, deadline))
+		if err == nil {
+			return conn.Close()
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("deputy: nothing accepting connections on %s after %v: %v", addr, timeout, err)
+		}
+		time.Sleep(capWait(readyPoll, deadline))
+	}
+}
+
+// pollForFile checks every readyPoll for path to exist, until the deadline.
+func pollForFile(path string, deadline time.Time) error {
+	for {
+		_, err := os.Stat(path)
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(readyPoll)
+	}
+}
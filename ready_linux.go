@@ -0,0 +1,40 @@
+package deputy
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// waitForFile waits for path to exist, until the deadline, woken by inotify
+// events on its directory.  It falls back to polling if the directory can't be
+// watched, such as when it doesn't exist yet.
+func waitForFile(path string, deadline time.Time) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_NONBLOCK | syscall.IN_CLOEXEC)
+	if err != nil {
+		return pollForFile(path, deadline)
+	}
+	f := os.NewFile(uintptr(fd), "inotify")
+	defer f.Close()
+	const mask = syscall.IN_CREATE | syscall.IN_MOVED_TO | syscall.IN_ATTRIB
+	if _, err := syscall.InotifyAddWatch(fd, filepath.Dir(path), mask); err != nil {
+		return pollForFile(path, deadline)
+	}
+	buf := make([]byte, 4096)
+	for {
+		// the watch is in place before this check, so the file can't appear
+		// unnoticed between the check and the read.
+		_, err := os.Stat(path)
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		// the events themselves don't matter, only that something changed.
+		if err := f.SetReadDeadline(deadline); err != nil {
+			return pollForFile(path, deadline)
+		}
+		if _, err := f.Read(buf); err != nil && !os.IsTimeout(err) {
+			return pollForFile(path, deadline)
+		}
+	}
+}
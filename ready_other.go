@@ -0,0 +1,10 @@
+//go:build !linux
+
+package deputy
+
+import "time"
+
+// waitForFile checks every readyPoll for path to exist, until the deadline.
+func waitForFile(path string, deadline time.Time) error {
+	return pollForFile(path, deadline)
+}
@@ -0,0 +1,150 @@
+package deputy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWaitForPort(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	if err := WaitForPort(addr, time.Second); err != nil {
+		t.Fatalf("unexpected error waiting for open port: %v", err)
+	}
+	l.Close()
+	start := time.Now()
+	if err := WaitForPort(addr, 100*time.Millisecond); err == nil {
+		t.Fatal("expected error waiting for closed port")
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("WaitForPort didn't give up at its timeout")
+	}
+}
+
+func TestWaitForFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ready")
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		os.WriteFile(path, nil, 0600)
+	}()
+	if err := WaitForFile(path, 5*time.Second); err != nil {
+		t.Fatalf("unexpected error waiting for file: %v", err)
+	}
+	if err := WaitForFile(path+".nope", 100*time.Millisecond); err == nil {
+		t.Fatal("expected error waiting for a missing file")
+	}
+}
+
+func TestWaitForSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets may not be supported")
+	}
+	path := filepath.Join(t.TempDir(), "sock")
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		if l, err := net.Listen("unix", path); err == nil {
+			defer l.Close()
+			<-done
+		}
+	}()
+	if err := WaitForSocket(path, 5*time.Second); err != nil {
+		t.Fatalf("unexpected error waiting for socket: %v", err)
+	}
+}
+
+func TestWaitForHTTP(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	if err := WaitForHTTP(srv.URL, http.StatusOK, 5*time.Second); err != nil {
+		t.Fatalf("unexpected error waiting for healthy server: %v", err)
+	}
+	if atomic.LoadInt32(&calls) != 3 {
+		t.Fatalf("expected 3 checks, got %d", calls)
+	}
+	start := time.Now()
+	if err := WaitForHTTP(srv.URL, http.StatusTeapot, 100*time.Millisecond); err == nil {
+		t.Fatal("expected error waiting for a status that never comes")
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("WaitForHTTP took %v to give up after 100ms", time.Since(start))
+	}
+
+	hang := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hang.Close()
+	start = time.Now()
+	if err := WaitForHTTP(hang.URL, 0, 100*time.Millisecond); err == nil {
+		t.Fatal("expected error waiting for a server that doesn't answer")
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("WaitForHTTP took %v to give up on a hung server after 100ms", time.Since(start))
+	}
+}
+
+func TestWaitReady(t *testing.T) {
+	c, err := Deputy{}.Start(maker{timeout: 5 * time.Second}.make())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WaitReady(context.Background(), ReadinessFunc(func(time.Duration) error { return nil }), time.Second); err != nil {
+		t.Fatalf("unexpected error waiting for a ready command: %v", err)
+	}
+	start := time.Now()
+	never := ReadinessFunc(func(timeout time.Duration) error {
+		time.Sleep(timeout)
+		return errors.New("not listening")
+	})
+	if err := c.WaitReady(context.Background(), never, 100*time.Millisecond); err == nil {
+		t.Fatal("expected an error from a command that never became ready")
+	}
+	if err := c.Wait(); err == nil || time.Since(start) > 2*time.Second {
+		t.Fatalf("expected the command to be killed, got %v after %v", err, time.Since(start))
+	}
+
+	c, err = Deputy{}.Start(maker{exit: 1}.make())
+	if err != nil {
+		t.Fatal(err)
+	}
+	start = time.Now()
+	var exitErr *exec.ExitError
+	if err := c.WaitReady(context.Background(), never, 5*time.Second); !errors.As(err, &exitErr) {
+		t.Fatalf("expected the command's exit to be reported, got %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatal("WaitReady didn't return when the command exited")
+	}
+
+	c, err = Deputy{}.Start(maker{timeout: 5 * time.Second}.make())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.WaitReady(ctx, never, 5*time.Second); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the context's error, got %v", err)
+	}
+	if err := c.Wait(); err == nil {
+		t.Fatal("expected the command to be killed")
+	}
+}
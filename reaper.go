@@ -0,0 +1,76 @@
+package deputy
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+)
+
+// children tracks the processes deputy has started and not yet waited for, so
+// that signals can be forwarded to them and so that the orphan reaper leaves
+// them for their own Run to wait for.
+var children = struct {
+	sync.Mutex
+	procs map[int]*os.Process
+	// reaping is true while orphaned processes are being reaped.
+	reaping bool
+}{procs: map[int]*os.Process{}}
+
+// startTracked calls start to start cmd, and records the new process.  While
+// reaping, the lock is held across the start so that the reaper can't mistake
+// a new child that exits immediately for an orphan.
+func startTracked(cmd *exec.Cmd, start func() error) error {
+	children.Lock()
+	defer children.Unlock()
+	if !children.reaping {
+		children.Unlock()
+		err := start()
+		children.Lock()
+		if err != nil {
+			return err
+		}
+	} else if err := start(); err != nil {
+		return err
+	}
+	children.procs[cmd.Process.Pid] = cmd.Process
+	return nil
+}
+
+// untrack forgets a process once it has been waited for.
+func untrack(p *os.Process) {
+	children.Lock()
+	delete(children.procs, p.Pid)
+	children.Unlock()
+}
+
+// ForwardSignals relays the given signals, when received by this process, to
+// every command currently being run by deputy.  This is mostly useful when
+// this process is a container's entrypoint and its children should see the
+// signals sent to the container.  Call the returned function to stop
+// forwarding.
+func ForwardSignals(sigs ...os.Signal) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sigs...)
+	go func() {
+		for {
+			select {
+			case sig := <-ch:
+				children.Lock()
+				for _, p := range children.procs {
+					// the process may have just exited, nothing to do
+					// about that.
+					_ = p.Signal(sig)
+				}
+				children.Unlock()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
@@ -0,0 +1,194 @@
+package deputy
+
+import (
+	"bytes"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+const prSetChildSubreaper = 36
+
+// Subreaper makes this process responsible for the orphaned descendants of
+// the commands it runs, and reaps them in the background so they don't
+// accumulate as zombies.  Unless this process is PID 1 (such as a container
+// entrypoint), which inherits orphans anyway, it is marked as a child
+// subreaper so that orphans are reparented to it instead of to init.
+//
+// Orphans are found among this process's zombie children; processes started
+// by deputy are left for their Run to wait for.  Children started in other
+// ways, such as directly with os/exec, may be reaped out from under their
+// owner, so while reaping all commands should be run through deputy.  Call
+// the returned function to stop reaping.  Linux only.
+func Subreaper() (stop func(), err error) {
+	pid1 := os.Getpid() == 1
+	if !pid1 {
+		if err := setSubreaper(1); err != nil {
+			return nil, err
+		}
+	}
+	children.Lock()
+	children.reaping = true
+	children.Unlock()
+
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, syscall.SIGCHLD)
+	go func() {
+		reapOrphans()
+		for {
+			select {
+			case <-ch:
+				reapOrphans()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+		children.Lock()
+		children.reaping = false
+		children.Unlock()
+		if !pid1 {
+			_ = setSubreaper(0)
+		}
+	}, nil
+}
+
+func setSubreaper(on uintptr) error {
+	if _, _, e := syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, on, 0); e != 0 {
+		return os.NewSyscallError("prctl", e)
+	}
+	return nil
+}
+
+// reapOrphans waits for every zombie child of this process that deputy isn't
+// waiting for itself.
+func reapOrphans() {
+	children.Lock()
+	defer children.Unlock()
+	for _, pid := range zombieChildren(os.Getpid()) {
+		if _, ok := children.procs[pid]; ok {
+			continue
+		}
+		var ws syscall.WaitStatus
+		_, _ = syscall.Wait4(pid, &ws, syscall.WNOHANG, nil)
+	}
+}
+
+// zombieChildren returns the pids of the zombie children of ppid.
+func zombieChildren(ppid int) []int {
+	var pids []int
+	for _, p := range procEntries() {
+		if p.state == 'Z' && p.ppid == ppid {
+			pids = append(pids, p.pid)
+		}
+	}
+	return pids
+}
+
+// procEntry is the part of /proc/<pid>/stat deputy cares about.
+type procEntry struct {
+	pid   int
+	ppid  int
+	pgid  int
+	state byte
+	comm  string
+}
+
+// procEntries returns an entry for every process currently in /proc.
+func procEntries() []procEntry {
+	dirs, _ := filepath.Glob("/proc/[0-9]*")
+	entries := make([]procEntry, 0, len(dirs))
+	for _, dir := range dirs {
+		if e, ok := readProcStat(dir); ok {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+func readProcStat(dir string) (procEntry, bool) {
+	b, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return procEntry{}, false
+	}
+	// The command name is in parentheses and may itself contain spaces and
+	// parentheses, so the fields after it are found from the last ')'.
+	open, end := bytes.IndexByte(b, '('), bytes.LastIndexByte(b, ')')
+	if open < 0 || end < open {
+		return procEntry{}, false
+	}
+	fields := bytes.Fields(b[end+1:])
+	if len(fields) < 3 {
+		return procEntry{}, false
+	}
+	pid, err1 := strconv.Atoi(string(bytes.TrimSpace(b[:open])))
+	ppid, err2 := strconv.Atoi(string(fields[1]))
+	pgid, err3 := strconv.Atoi(string(fields[2]))
+	if err1 != nil || err2 != nil || err3 != nil || len(fields[0]) != 1 {
+		return procEntry{}, false
+	}
+	return procEntry{
+		pid:   pid,
+		ppid:  ppid,
+		pgid:  pgid,
+		state: fields[0][0],
+		comm:  string(b[open+1 : end]),
+	}, true
+}
+
+// processExited reports whether the process with the given pid has exited,
+// even if it hasn't been waited for.
+func processExited(pid int) bool {
+	e, ok := readProcStat(filepath.Join("/proc", strconv.Itoa(pid)))
+	return !ok || e.state == 'Z' || e.state == 'X'
+}
+
+// groupMembers returns the live processes in the process group pgid.
+func groupMembers(pgid int) []ProcInfo {
+	var procs []ProcInfo
+	for _, p := range procEntries() {
+		if p.pgid == pgid && p.state != 'Z' && p.state != 'X' {
+			procs = append(procs, ProcInfo{Pid: p.pid, Parent: p.ppid, Command: p.comm})
+		}
+	}
+	return procs
+}
+
+// descendants returns the live descendants of pid, found by following parent
+// pids, along with any other members of the process group pid leads, which
+// finds descendants that have been orphaned.
+func descendants(pid int) []ProcInfo {
+	entries := procEntries()
+	kids := map[int][]procEntry{}
+	for _, p := range entries {
+		kids[p.ppid] = append(kids[p.ppid], p)
+	}
+	var procs []ProcInfo
+	found := map[int]bool{pid: true}
+	add := func(p procEntry) {
+		if !found[p.pid] && p.state != 'Z' && p.state != 'X' {
+			found[p.pid] = true
+			procs = append(procs, ProcInfo{Pid: p.pid, Parent: p.ppid, Command: p.comm})
+		}
+	}
+	for queue := []int{pid}; len(queue) > 0; queue = queue[1:] {
+		for _, p := range kids[queue[0]] {
+			if !found[p.pid] {
+				add(p)
+				queue = append(queue, p.pid)
+			}
+		}
+	}
+	for _, p := range entries {
+		if p.pgid == pid {
+			add(p)
+		}
+	}
+	return procs
+}
@@ -0,0 +1,172 @@
+package deputy
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSubreaper(t *testing.T) {
+	stop, err := Subreaper()
+	if err != nil {
+		t.Fatalf("unexpected error from Subreaper: %v", err)
+	}
+	defer stop()
+
+	// the background sleep is orphaned when the shell exits, and is
+	// reparented to this process.
+	if err := Shell("sleep 0.1 &"); err != nil {
+		t.Fatalf("unexpected error returned from Shell: %v", err)
+	}
+	// commands run while reaping must still get their own exit status.
+	for i := 0; i < 20; i++ {
+		if err := Run(maker{}.make()); err != nil {
+			t.Fatalf("unexpected error returned from Run: %v", err)
+		}
+	}
+	err = Run(maker{exit: 3}.make())
+	if err == nil || err.Error() != "exit status 3" {
+		t.Fatalf("expected exit status 3 but got %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(zombieChildren(os.Getpid())) > 0 || orphanRunning() {
+		if time.Now().After(deadline) {
+			t.Fatal("orphan was never reaped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// orphanRunning reports whether this process has any children still running.
+func orphanRunning() bool {
+	for _, p := range procEntries() {
+		if p.ppid == os.Getpid() {
+			return true
+		}
+	}
+	return false
+}
+
+func TestKilledButNotWaited(t *testing.T) {
+	defer func(old time.Duration) { killDrain = old }(killDrain)
+	killDrain = 50 * time.Millisecond
+
+	// the background sleep holds stdout open after the shell is killed, so
+	// the command can't be waited for until it exits, but the shell itself
+	// is known to have exited.
+	cmd := shellCommand("sleep 0.5 & wait")
+	cmd.Stdout = &bytes.Buffer{}
+	reaped := make(chan int, 1)
+	d := Deputy{
+		Timeout: 50 * time.Millisecond,
+		Reaped:  func(pid, code int) { reaped <- pid },
+	}
+	err := d.Run(cmd)
+	if err == nil || !strings.Contains(err.Error(), "timed out") || errors.Is(err, ErrUnkillable) {
+		t.Fatalf("expected timeout error but got %v", err)
+	}
+	select {
+	case pid := <-reaped:
+		if pid != cmd.Process.Pid {
+			t.Fatalf("expected pid %d to be reaped, got %d", cmd.Process.Pid, pid)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("command was never reaped")
+	}
+}
+
+func TestWaitDelay(t *testing.T) {
+	// the background sleep keeps the output open after the shell exits.
+	var lines []string
+	d := Deputy{
+		WaitDelay: 50 * time.Millisecond,
+		StdoutLog: func(b []byte) { lines = append(lines, string(b)) },
+	}
+	start := time.Now()
+	err := d.Run(shellCommand("sleep 2 & echo hi"))
+	if !errors.Is(err, exec.ErrWaitDelay) {
+		t.Fatalf("expected ErrWaitDelay, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("Run waited %v for the output to end", time.Since(start))
+	}
+	if len(lines) != 1 || lines[0] != "hi" {
+		t.Fatalf("expected the output written before exiting, got %q", lines)
+	}
+
+	// output written to the command's own writer is closed by exec.
+	cmd := shellCommand("sleep 2 & echo hi")
+	cmd.Stdout = &bytes.Buffer{}
+	start = time.Now()
+	err = Deputy{WaitDelay: 50 * time.Millisecond}.Run(cmd)
+	if !errors.Is(err, exec.ErrWaitDelay) || time.Since(start) > time.Second {
+		t.Fatalf("expected ErrWaitDelay right away, got %v after %v", err, time.Since(start))
+	}
+}
+
+func TestUnkillableError(t *testing.T) {
+	var err error = &UnkillableError{Pid: 42}
+	if !errors.Is(err, ErrUnkillable) || !strings.Contains(err.Error(), "42") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if processExited(os.Getpid()) {
+		t.Fatal("this process is reported as exited")
+	}
+}
+
+func TestFindOrphans(t *testing.T) {
+	var res Result
+	err := Deputy{FindOrphans: true}.Shell(`sleep 1 & while [ "$(cat /proc/$!/comm)" != sleep ]; do :; done`, WithDefer(func(r Result) { res = r }))
+	if err != nil {
+		t.Fatalf("unexpected error returned from Shell: %v", err)
+	}
+	if len(res.Orphans) != 1 || res.Orphans[0].Command != "sleep" {
+		t.Fatalf("expected the background sleep to be found, got %+v", res.Orphans)
+	}
+	if p, err := os.FindProcess(res.Orphans[0].Pid); err == nil {
+		_ = p.Kill()
+	}
+
+	if err := (Deputy{}).Shell("true", WithDefer(func(r Result) { res = r })); err != nil {
+		t.Fatalf("unexpected error returned from Shell: %v", err)
+	}
+	if res.Orphans != nil {
+		t.Fatalf("expected no orphans when not looking for them, got %+v", res.Orphans)
+	}
+}
+
+func TestTrackDescendants(t *testing.T) {
+	var res Result
+	d := Deputy{TrackDescendants: 10 * time.Millisecond}
+	if err := d.Shell("sleep 0.3; true", WithDefer(func(r Result) { res = r })); err != nil {
+		t.Fatalf("unexpected error returned from Shell: %v", err)
+	}
+	if len(res.Descendants) != 1 {
+		t.Fatalf("expected one descendant, got %+v", res.Descendants)
+	}
+	if p := res.Descendants[0]; p.Command != "sleep" || p.Parent != res.Pid {
+		t.Fatalf("unexpected descendant %+v of %d", p, res.Pid)
+	}
+	if res.PeakDescendants != 1 {
+		t.Fatalf("expected a peak of one descendant, got %d", res.PeakDescendants)
+	}
+
+	d.FindOrphans = true
+	script := `sleep 1 & sleep 1 & sleep 1 & while [ "$(cat /proc/$!/comm)" != sleep ]; do :; done; sleep 0.1`
+	if err := d.Shell(script, WithDefer(func(r Result) { res = r })); err != nil {
+		t.Fatalf("unexpected error returned from Shell: %v", err)
+	}
+	for _, p := range res.Orphans {
+		if proc, err := os.FindProcess(p.Pid); err == nil {
+			_ = proc.Kill()
+		}
+	}
+	if res.PeakDescendants < 3 || len(res.Orphans) != 3 {
+		t.Fatalf("expected a peak of at least 3 descendants and 3 left running, got %d and %+v", res.PeakDescendants, res.Orphans)
+	}
+}
@@ -0,0 +1,29 @@
+//go:build !linux
+
+package deputy
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Subreaper is only supported on linux.
+func Subreaper() (stop func(), err error) {
+	return nil, fmt.Errorf("deputy: Subreaper is not supported on %s", runtime.GOOS)
+}
+
+// processExited can't tell whether a process that hasn't been waited for has
+// exited, so it assumes it hasn't.
+func processExited(pid int) bool {
+	return false
+}
+
+// groupMembers can't list processes on this platform.
+func groupMembers(pgid int) []ProcInfo {
+	return nil
+}
+
+// descendants can't list processes on this platform.
+func descendants(pid int) []ProcInfo {
+	return nil
+}
@@ -0,0 +1,170 @@
+package deputy
+
+import (
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Result describes a single run of a command.  A Result can be marshalled to
+// and from JSON, as described in MarshalJSON.
+type Result struct {
+	// Path is the path of the program that was run, after any lookup.
+	Path string `json:"path"`
+	// Args are the command's arguments, including the program name.
+	Args []string `json:"args,omitempty"`
+	// Dir is the command's working directory, if it was set.
+	Dir string `json:"dir,omitempty"`
+	// Pid is the process id of the command, or zero if it wasn't started.
+	Pid int `json:"pid,omitempty"`
+	// Start is when the command was started, or the zero time if it wasn't.
+	Start time.Time `json:"start"`
+	// Duration is how long the command ran, from when it was started until
+	// it was waited for, not counting the work the Deputy does afterwards,
+	// such as collecting artifacts.
+	Duration time.Duration `json:"duration"`
+	// ExitCode is the command's exit code, or -1 if it didn't exit normally
+	// or wasn't started.
+	ExitCode int `json:"exit_code"`
+	// Status describes how the command ended, or is nil if it wasn't waited
+	// for.
+	Status *ExitStatus `json:"status,omitempty"`
+	// ProcessState is the command's exit status as os/exec reports it, or
+	// nil if it wasn't waited for.
+	ProcessState *os.ProcessState `json:"-"`
+	// StdoutCount and StderrCount are how much the command wrote to each
+	// stream, if the Deputy's CountOutput is set.
+	StdoutCount OutputCount `json:"stdout_count"`
+	StderrCount OutputCount `json:"stderr_count"`
+	// StdinBytes is how many bytes of the command's Stdin were written to
+	// it, when the Stdin isn't a file.
+	StdinBytes int64 `json:"stdin_bytes,omitempty"`
+	// Err is the error returned from the run, if any.
+	Err error `json:"-"`
+	// Tail is the text collected from a failed command's output according
+	// to the Deputy's Errors setting, as in RunError.
+	Tail string `json:"tail,omitempty"`
+	// PipeErrors are the errors reading the command's output or writing it
+	// to sinks, whether or not the Deputy's PipeErrors policy let them make
+	// the run fail.
+	PipeErrors []error `json:"-"`
+	// Artifacts is the manifest of the files collected after the run, as
+	// set by the Deputy's CollectArtifacts.
+	Artifacts []Artifact `json:"artifacts,omitempty"`
+	// FileChanges are the changes to files under the Deputy's WatchFiles
+	// directory during the run, sorted by path.
+	FileChanges []FileChange `json:"file_changes,omitempty"`
+	// Checkpoint is how much output the Deputy's sinks had stored durably
+	// at the end of the run, if any of them is a CheckpointSink.  With more
+	// than one, it is the least any of them had stored.
+	Checkpoint *Checkpoint `json:"checkpoint,omitempty"`
+	// JobID is the id of the run in the Deputy's Jobs registry, if it has
+	// one.
+	JobID string `json:"job_id,omitempty"`
+	// Labels are the Deputy's Labels.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Alternative is the index of the command among the specs given to
+	// RunFirstOf, telling which of them ran.
+	Alternative int `json:"alternative,omitempty"`
+	// Attempts is how many times a Retry has run the command, counting this
+	// run, so that the last Result of a Retry tells how many it took.  It
+	// is zero for a run that isn't part of a Retry.
+	Attempts int `json:"attempts,omitempty"`
+	// CancelReason is the reason given to Jobs.Cancel, if the run's job was
+	// canceled.
+	CancelReason string `json:"cancel_reason,omitempty"`
+	// Graceful is true if the command was stopped because of Cancel or
+	// Timeout, and exited within the Deputy's Grace after being sent the
+	// StopSignal, rather than being killed.
+	Graceful bool `json:"graceful,omitempty"`
+	// Orphans are the processes the command left running in its process
+	// group after it exited, if the Deputy's FindOrphans is set.
+	Orphans []ProcInfo `json:"orphans,omitempty"`
+	// Descendants are the processes started by the command, and by those
+	// processes in turn, that were seen while it ran, if the Deputy's
+	// TrackDescendants is set.  They are in the order they were first seen.
+	Descendants []ProcInfo `json:"descendants,omitempty"`
+	// PeakDescendants is the most of the Descendants that were running at
+	// once, when they were looked for.  How many were still running when
+	// the command exited is the number of its Orphans, if FindOrphans is
+	// set too.
+	PeakDescendants int `json:"peak_descendants,omitempty"`
+}
+
+// ExitStatus is a portable description of how a command ended, so that
+// callers don't need to decode a *exec.ExitError or the system-specific
+// status in an os.ProcessState.
+type ExitStatus struct {
+	// Exited is true if the command exited on its own.
+	Exited bool `json:"exited"`
+	// Code is the command's exit code, or -1 if it didn't exit on its own.
+	Code int `json:"code"`
+	// Signaled is true if the command was ended by a signal.
+	Signaled bool `json:"signaled,omitempty"`
+	// Signal is the name of the signal that ended the command, such as
+	// "killed", if it was ended by one.
+	Signal string `json:"signal,omitempty"`
+}
+
+// exitStatus returns the ExitStatus of a command that has been waited for.
+func exitStatus(ps *os.ProcessState) *ExitStatus {
+	s := &ExitStatus{Exited: ps.Exited(), Code: ps.ExitCode()}
+	if sig := exitSignal(ps); sig != nil {
+		s.Signaled, s.Signal = true, sig.String()
+	}
+	return s
+}
+
+// ProcInfo describes a process.
+type ProcInfo struct {
+	// Pid is the process id.
+	Pid int `json:"pid"`
+	// Parent is the process id of the process's parent.
+	Parent int `json:"parent"`
+	// Command is the name of the process's program.
+	Command string `json:"command"`
+}
+
+// finish fills in the run's Result from cmd and passes it to the Deputy's
+// Defer functions.
+func (d Deputy) finish(cmd *exec.Cmd) {
+	res := d.result
+	if cmd != nil {
+		res.Path = cmd.Path
+		res.Args = cmd.Args
+		res.Dir = cmd.Dir
+	}
+	if !res.Start.IsZero() && res.Duration == 0 {
+		// a command that couldn't be waited for never exited.
+		res.Duration = time.Since(res.Start)
+	}
+	switch {
+	case res.Pid == 0 && res.Err != nil:
+		d.logf(Normal, "deputy: %s not started: %v", describe(res.Args), res.Err)
+	case res.Err != nil:
+		d.logf(Normal, "deputy: pid %d failed after %v: %v", res.Pid, res.Duration, res.Err)
+	case res.Pid != 0:
+		d.logf(Normal, "deputy: pid %d exited with code %d after %v", res.Pid, res.ExitCode, res.Duration)
+	}
+	if d.Jobs != nil {
+		d.Jobs.finished(d.jobID, res)
+	}
+	if d.History != nil {
+		d.History.add(*res)
+	}
+	for i := len(d.Defer) - 1; i >= 0; i-- {
+		d.Defer[i](*res)
+	}
+}
+
+// exited records how long cmd ran and its exit status, once it has been waited
+// for, and the orphans it left if the Deputy looks for them.
+func (d Deputy) exited(cmd *exec.Cmd) {
+	d.result.Duration = time.Since(d.result.Start)
+	d.result.ExitCode = cmd.ProcessState.ExitCode()
+	d.result.ProcessState = cmd.ProcessState
+	d.result.Status = exitStatus(cmd.ProcessState)
+	if d.FindOrphans {
+		d.result.Orphans = groupMembers(processGroup(cmd))
+	}
+}
@@ -0,0 +1,90 @@
+package deputy
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestDefer(t *testing.T) {
+	var order []int
+	var res Result
+	d := Deputy{Defer: []func(Result){
+		func(r Result) { order = append(order, 1) },
+		func(r Result) { order = append(order, 2); res = r },
+	}}
+	cmd := maker{exit: 3}.make()
+	err := d.Run(cmd, WithDefer(func(Result) { order = append(order, 3) }))
+	if err == nil {
+		t.Fatal("expected error from Run")
+	}
+	if len(order) != 3 || order[0] != 3 || order[1] != 2 || order[2] != 1 {
+		t.Fatalf("defer functions called in wrong order: %v", order)
+	}
+	if len(d.Defer) != 2 {
+		t.Fatal("WithDefer modified the original deputy")
+	}
+	if res.ExitCode != 3 || res.Err != err || res.Pid == 0 || res.Path != cmd.Path || res.Duration <= 0 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+}
+
+func TestDeferNotStarted(t *testing.T) {
+	called := false
+	d := Deputy{
+		Policy: PolicyFunc(func(string, []string, []string) error { return errors.New("no") }),
+		Defer:  []func(Result){func(r Result) { called = r.Pid == 0 && r.ExitCode == -1 && r.Err != nil }},
+	}
+	if err := d.Run(maker{}.make()); err == nil {
+		t.Fatal("expected error from Run")
+	}
+	if !called {
+		t.Fatal("defer function not called with unstarted result")
+	}
+}
+
+func TestDeferTimeout(t *testing.T) {
+	var res Result
+	d := Deputy{
+		Timeout: 50 * time.Millisecond,
+		Defer:   []func(Result){func(r Result) { res = r }},
+	}
+	err := d.Run(maker{timeout: 2 * time.Second}.make())
+	if err == nil || res.Err != err {
+		t.Fatalf("expected timeout error in result, got %v and %v", err, res.Err)
+	}
+}
+
+func TestRunResult(t *testing.T) {
+	res, err := Deputy{Errors: FromStderr}.RunResult(maker{stderr: "broken", exit: 3}.make())
+	if err == nil || res.Err != err {
+		t.Fatalf("expected the run's error in the Result, got %v and %v", err, res.Err)
+	}
+	if res.ExitCode != 3 || res.Tail != "broken" || res.Pid == 0 || res.Duration <= 0 {
+		t.Fatalf("expected a filled in Result for a failed run, got %+v", res)
+	}
+}
+
+func TestResultStatus(t *testing.T) {
+	res, _ := Deputy{}.RunResult(maker{exit: 3}.make())
+	if res.ProcessState == nil || res.ProcessState.ExitCode() != 3 {
+		t.Fatalf("expected the ProcessState in the Result, got %v", res.ProcessState)
+	}
+	if want := (ExitStatus{Exited: true, Code: 3}); res.Status == nil || *res.Status != want {
+		t.Fatalf("expected status %+v, got %+v", want, res.Status)
+	}
+
+	res, _ = Deputy{Policy: Denylist{res.Path}}.RunResult(maker{}.make())
+	if res.ProcessState != nil || res.Status != nil {
+		t.Fatalf("expected no status for a command that wasn't started, got %+v", res.Status)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	res, _ = Deputy{Timeout: 50 * time.Millisecond}.RunResult(maker{timeout: 2 * time.Second}.make())
+	if want := (ExitStatus{Code: -1, Signaled: true, Signal: "killed"}); res.Status == nil || *res.Status != want {
+		t.Fatalf("expected status %+v, got %+v", want, res.Status)
+	}
+}
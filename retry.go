@@ -0,0 +1,94 @@
+package deputy
+
+import (
+	"errors"
+	"time"
+)
+
+// Retry runs a command again when it fails in a way that is known to be
+// transient, such as curl's exit code 28 for a timeout.  Failures that match
+// neither RetryExitCodes nor RetryOn are returned right away, since running a
+// command that failed deterministically again would only fail again.
+type Retry struct {
+	// Deputy runs each attempt.
+	Deputy Deputy
+	// Attempts is the most times the command is run, including the first.
+	// Zero means once, unless Backoff has a MaxElapsed, in which case
+	// retries continue until it passes.
+	Attempts int
+	// Backoff is how long to wait before each retry.
+	Backoff Backoff
+	// RetryExitCodes are the exit codes that mean the command failed in a
+	// transient way and should be retried.
+	RetryExitCodes []int
+	// RetryOn, if set, reports whether a run that failed with err should be
+	// retried, for failures that an exit code alone doesn't identify, such
+	// as a particular message in a RunError's Tail.
+	RetryOn func(err error) bool
+	// Resume, if set, returns the command to run for a retry, given the
+	// spec of the first attempt and the last Checkpoint reported by the
+	// Deputy's sinks, so that a command that streams output can carry on
+	// from where its output was last stored, such as by adding an argument
+	// like --resume-from.  It isn't called if no sink has reported a
+	// Checkpoint yet.
+	Resume func(spec Spec, cp Checkpoint) Spec
+}
+
+// Run runs the command described by spec, with opts applied to the Deputy,
+// retrying it as the Retry allows.  It returns the Result and error of the
+// last attempt, whose Attempts is the number of attempts made.  A run that was canceled isn't retried, and the Deputy's
+// Cancel also cuts short the wait before a retry.
+func (r Retry) Run(spec Spec, opts ...Option) (Result, error) {
+	if r.Attempts < 0 {
+		return Result{}, errors.New("deputy: negative Attempts in Retry")
+	}
+	attempts := r.Attempts
+	if attempts == 0 && r.Backoff.MaxElapsed == 0 {
+		attempts = 1
+	}
+	d := r.Deputy.With(opts...)
+	start := time.Now()
+	next := spec
+	var last *Checkpoint
+	for attempt := 1; ; attempt++ {
+		d.attempt = attempt
+		res, err := d.RunResult(next.Command())
+		if err == nil || attempt == attempts || !r.retryable(res, err) {
+			return res, err
+		}
+		if res.Checkpoint != nil {
+			last = res.Checkpoint
+		}
+		if r.Resume != nil && last != nil {
+			next = r.Resume(spec, *last)
+		}
+		delay, ok := r.Backoff.Next(attempt+1, start)
+		if !ok {
+			return res, err
+		}
+		d.logf(Normal, "deputy: retrying %s in %v after attempt %d failed: %v", describe(res.Args), delay, attempt, err)
+		t := time.NewTimer(delay)
+		select {
+		case <-d.Cancel:
+			t.Stop()
+			return res, err
+		case <-t.C:
+		}
+	}
+}
+
+// retryable reports whether a run that failed with err should be retried.
+func (r Retry) retryable(res Result, err error) bool {
+	var canceled *CanceledError
+	if errors.As(err, &canceled) {
+		return false
+	}
+	if res.Status != nil && res.Status.Exited {
+		for _, code := range r.RetryExitCodes {
+			if code == res.ExitCode {
+				return true
+			}
+		}
+	}
+	return r.RetryOn != nil && r.RetryOn(err)
+}
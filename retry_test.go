@@ -0,0 +1,90 @@
+package deputy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	var runs int
+	d := Deputy{Defer: []func(Result){func(Result) { runs++ }}}
+	spec := Spec{Name: os.Args[0], Args: []string{"-test.run=TestHelperProcess"}, Env: maker{exit: 28}.make().Env}
+	res, err := Retry{Deputy: d, Attempts: 3, RetryExitCodes: []int{28}}.Run(spec)
+	if err == nil || res.ExitCode != 28 || runs != 3 {
+		t.Fatalf("expected 3 failed attempts, got %d and %v", runs, err)
+	}
+	if res.Attempts != 3 {
+		t.Fatalf("expected the last result to count 3 attempts, got %d", res.Attempts)
+	}
+
+	runs = 0
+	backoff := Backoff{Initial: 10 * time.Millisecond, MaxElapsed: 50 * time.Millisecond}
+	_, err = Retry{Deputy: d, Backoff: backoff, RetryExitCodes: []int{28}}.Run(spec)
+	if err == nil || runs < 2 {
+		t.Fatalf("expected retries until MaxElapsed, got %d attempts and %v", runs, err)
+	}
+
+	runs = 0
+	_, err = Retry{Deputy: d, Attempts: 3, RetryExitCodes: []int{7}}.Run(spec)
+	if err == nil || runs != 1 {
+		t.Fatalf("expected an exit code not listed not to be retried, got %d attempts", runs)
+	}
+
+	runs = 0
+	spec.Env = maker{stderr: "connection reset", exit: 1}.make().Env
+	retryOn := func(err error) bool {
+		var re *RunError
+		return errors.As(err, &re) && re.Tail == "connection reset"
+	}
+	_, err = Retry{Deputy: d, Attempts: 2, RetryOn: retryOn}.Run(spec, WithErrors(FromStderr))
+	if err == nil || runs != 2 {
+		t.Fatalf("expected RetryOn to retry the failure, got %d attempts", runs)
+	}
+
+	runs = 0
+	spec.Env = maker{}.make().Env
+	if _, err := (Retry{Deputy: d, Attempts: 3, RetryExitCodes: []int{0}}).Run(spec); err != nil || runs != 1 {
+		t.Fatalf("expected a successful run not to be retried, got %d attempts and %v", runs, err)
+	}
+}
+
+// checkpointSink counts the lines it is given across runs.
+type checkpointSink struct {
+	writerSink
+	lines []string
+	bytes int64
+}
+
+func (s *checkpointSink) WriteLine(l Line) error {
+	s.lines = append(s.lines, string(l.Text))
+	s.bytes += int64(len(l.Text)) + 1
+	return nil
+}
+
+func (s *checkpointSink) Checkpoint() Checkpoint {
+	return Checkpoint{Lines: int64(len(s.lines)), Bytes: s.bytes}
+}
+
+func TestRetryResume(t *testing.T) {
+	sink := &checkpointSink{writerSink: writerSink{w: io.Discard}}
+	d := Deputy{Sinks: []Sink{sink}}
+	spec := Spec{Name: os.Args[0], Args: []string{"-test.run=TestHelperProcess"}, Env: maker{stdout: "one\ntwo", exit: 28}.make().Env}
+	resume := func(spec Spec, cp Checkpoint) Spec {
+		spec.Env = maker{stdout: fmt.Sprintf("resumed at line %d, byte %d", cp.Lines, cp.Bytes)}.make().Env
+		return spec
+	}
+	res, err := Retry{Deputy: d, Attempts: 2, RetryExitCodes: []int{28}, Resume: resume}.Run(spec)
+	if err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	if len(sink.lines) != 3 || sink.lines[2] != "resumed at line 2, byte 8" {
+		t.Fatalf("expected the retry to resume from the checkpoint, got %q", sink.lines)
+	}
+	if res.Checkpoint == nil || *res.Checkpoint != (Checkpoint{Lines: 3, Bytes: 34}) {
+		t.Fatalf("expected the Result to hold the last checkpoint, got %+v", res.Checkpoint)
+	}
+}
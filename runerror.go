@@ -0,0 +1,136 @@
+package deputy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// RunError is the error Run returns when a command fails once deputy has
+// tried to start it, whether it couldn't be started, exited unsuccessfully,
+// or was stopped.  Errors from before then, such as from Validate, a Policy
+// or PreStart, are returned as they are.
+//
+// Its Error method is kept short; the details are in its fields.
+type RunError struct {
+	// Path is the resolved path of the command.
+	Path string
+	// Args are the command's arguments, including the command name, with the
+	// values of secret flags redacted as in Spec.MarshalJSON.
+	Args []string
+	// Dir is the command's working directory.
+	Dir string
+	// Duration is how long the command ran, if it started.
+	Duration time.Duration
+	// ExitCode is the command's exit code, or -1 if it didn't exit or was
+	// ended by a signal.
+	ExitCode int
+	// ExitMeaning is what the exit code conventionally means, as from
+	// DescribeExitCode, if it has a conventional meaning.
+	ExitMeaning string
+	// Signal is the signal that ended the command, if any.
+	Signal os.Signal
+	// Tail is the text collected from the command's output according to the
+	// Deputy's Errors setting, with surrounding whitespace trimmed.
+	Tail string
+	// Err is the underlying error, such as an *exec.ExitError, a *PipeError,
+	// or the error from the command timing out.  When the command and its
+	// pipes both failed, it is their errors joined as by errors.Join.
+	Err error
+}
+
+// Error returns the underlying error's text, followed by the Tail if there
+// is one.
+func (e *RunError) Error() string {
+	if e.Tail != "" {
+		return fmt.Sprintf("%s: %s", e.Err, e.Tail)
+	}
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *RunError) Unwrap() error {
+	return e.Err
+}
+
+// runError returns a *RunError for err, which the run of cmd failed with.
+func (d Deputy) runError(cmd *exec.Cmd, err error, tail string) *RunError {
+	e := &RunError{
+		Path:     cmd.Path,
+		Args:     redactArgs(cmd.Args),
+		Dir:      cmd.Dir,
+		ExitCode: d.result.ExitCode,
+		Signal:   exitSignal(d.result.ProcessState),
+		Tail:     tail,
+		Err:      err,
+		Duration: d.result.Duration,
+	}
+	if e.ExitCode > 0 {
+		e.ExitMeaning = DescribeExitCode(e.ExitCode)
+	}
+	return e
+}
+
+// exitSignal returns the signal that ended the process, if any.
+func exitSignal(ps *os.ProcessState) os.Signal {
+	if ps == nil {
+		return nil
+	}
+	if ws, ok := ps.Sys().(interface {
+		Signaled() bool
+		Signal() syscall.Signal
+	}); ok && ws.Signaled() {
+		return ws.Signal()
+	}
+	return nil
+}
+
+// TimeoutError is the error a command fails with when it is stopped because it
+// ran for longer than the Deputy's Timeout, or when it is stopped, or never
+// started, because the deadline of the context given to RunContext passed.
+// It matches context.DeadlineExceeded with errors.Is.
+type TimeoutError struct {
+	// Timeout is the Deputy's Timeout.
+	Timeout time.Duration
+	// Deadline is the deadline of the run's context, if that is what
+	// stopped the command.
+	Deadline time.Time
+}
+
+// Error implements error.
+func (e *TimeoutError) Error() string {
+	if !e.Deadline.IsZero() {
+		return "deputy: command stopped at its context's deadline"
+	}
+	return fmt.Sprintf("deputy: command timed out after %v", e.Timeout)
+}
+
+// Unwrap returns context.DeadlineExceeded.
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// CanceledError is the error a command fails with when it is stopped, or
+// never started, because the Deputy's Cancel was closed or its job was
+// canceled.  It matches context.Canceled with errors.Is.
+type CanceledError struct {
+	// Started is true if the command had been started before it was
+	// canceled.
+	Started bool
+}
+
+// Error implements error.
+func (e *CanceledError) Error() string {
+	if !e.Started {
+		return "deputy: canceled before the command started"
+	}
+	return "deputy: command canceled"
+}
+
+// Unwrap returns context.Canceled.
+func (e *CanceledError) Unwrap() error {
+	return context.Canceled
+}
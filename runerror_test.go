@@ -0,0 +1,83 @@
+package deputy
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunError(t *testing.T) {
+	cmd := maker{stderr: "broken", exit: 3}.make()
+	cmd.Args = append(cmd.Args, "--", "--token", "hunter2")
+	err := Deputy{Errors: FromStderr}.Run(cmd)
+	var rerr *RunError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expected a *RunError, got %#v", err)
+	}
+	if rerr.ExitCode != 3 || rerr.Tail != "broken" || rerr.Path != cmd.Path || rerr.Duration <= 0 {
+		t.Errorf("unexpected error details %+v", rerr)
+	}
+	if args := rerr.Args[len(rerr.Args)-2:]; args[0] != "--token" || args[1] != Redacted {
+		t.Errorf("expected the token to be redacted, got %q", rerr.Args)
+	}
+	if err.Error() != "exit status 3: broken" {
+		t.Errorf("unexpected error text %q", err)
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Errorf("expected the *exec.ExitError to be wrapped, got %#v", rerr.Err)
+	}
+}
+
+func TestDescribeExitCode(t *testing.T) {
+	tests := []struct {
+		code int
+		goos string
+		want string
+	}{
+		{64, "linux", "EX_USAGE: command line usage error"},
+		{75, "windows", "EX_TEMPFAIL: temporary failure, try again"},
+		{127, "linux", "the command was not found"},
+		{127, "windows", ""},
+		{128 + 9, "linux", "ended by signal 9 (" + syscall.Signal(9).String() + ")"},
+		{0xC0000005, "windows", "STATUS_ACCESS_VIOLATION: the program crashed accessing invalid memory (0xC0000005)"},
+		{1, "linux", ""},
+	}
+	for _, test := range tests {
+		if got := describeExitCode(test.code, test.goos); got != test.want {
+			t.Errorf("describeExitCode(%d, %q): expected %q, got %q", test.code, test.goos, test.want, got)
+		}
+	}
+
+	var rerr *RunError
+	if err := (Deputy{}).Run(maker{exit: 77}.make()); !errors.As(err, &rerr) || rerr.ExitMeaning != sysexits[77] {
+		t.Fatalf("expected the exit code's meaning in the RunError, got %#v", err)
+	}
+}
+
+func TestRunErrorDuration(t *testing.T) {
+	cmd := maker{exit: 1}.make()
+	cmd.Dir = t.TempDir()
+	if err := os.WriteFile(filepath.Join(cmd.Dir, "report.xml"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	d := Deputy{
+		CollectArtifacts: []string{"*.xml"},
+		ArtifactStore: ArtifactStoreFunc(func(name, path string) error {
+			time.Sleep(200 * time.Millisecond)
+			return nil
+		}),
+	}
+	res, err := d.RunResult(cmd)
+	var rerr *RunError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expected a *RunError, got %#v", err)
+	}
+	if rerr.Duration != res.Duration {
+		t.Fatalf("expected the error's duration to be the run's %v, got %v", res.Duration, rerr.Duration)
+	}
+}
@@ -0,0 +1,59 @@
+package deputy
+
+// RunRoot is a restricted view of the file system for a command to run in,
+// so that a build sees only what it needs: a few directories mounted
+// read-only, and a writable working directory.  Like FanOut with ssh, it uses
+// a system program, bwrap (bubblewrap), which runs the command in new
+// namespaces with the directories bind-mounted into an otherwise empty root,
+// so it only works on linux systems with bwrap installed that allow
+// unprivileged user namespaces.  All of its paths must be absolute.
+type RunRoot struct {
+	// ReadOnly are the directories mounted read-only, each at the same path
+	// as outside the root, such as /usr and /etc/ssl.
+	ReadOnly []string
+	// Writable are the directories mounted writable, at the same paths.
+	Writable []string
+	// Workdir, if set, is a directory mounted writable at the same path,
+	// that the command is run in unless its Spec has a Dir.
+	Workdir string
+	// Network, if true, leaves the command on this host's network, rather
+	// than in a network namespace of its own with no connections out.
+	Network bool
+	// Bwrap is the bwrap program and any more options to run it with.  It
+	// defaults to bwrap.
+	Bwrap []string
+}
+
+// Spec returns a Spec that runs the command described by spec in the root,
+// with spec's Env.  Besides its directories, the root has its own /proc and
+// /dev, and an empty /tmp.  spec's Dir, if set, must be inside one of the
+// root's directories.
+func (r RunRoot) Spec(spec Spec) Spec {
+	bwrap := r.Bwrap
+	if len(bwrap) == 0 {
+		bwrap = []string{"bwrap"}
+	}
+	args := append(bwrap[1:len(bwrap):len(bwrap)], "--unshare-all")
+	if r.Network {
+		args = append(args, "--share-net")
+	}
+	args = append(args, "--die-with-parent", "--proc", "/proc", "--dev", "/dev", "--tmpfs", "/tmp")
+	for _, dir := range r.ReadOnly {
+		args = append(args, "--ro-bind", dir, dir)
+	}
+	for _, dir := range r.Writable {
+		args = append(args, "--bind", dir, dir)
+	}
+	dir := spec.Dir
+	if r.Workdir != "" {
+		args = append(args, "--bind", r.Workdir, r.Workdir)
+		if dir == "" {
+			dir = r.Workdir
+		}
+	}
+	if dir != "" {
+		args = append(args, "--chdir", dir)
+	}
+	args = append(append(args, "--", spec.Name), spec.Args...)
+	return Spec{Name: bwrap[0], Args: args, Env: spec.Env}
+}
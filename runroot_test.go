@@ -0,0 +1,70 @@
+package deputy
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRunRootSpec(t *testing.T) {
+	r := RunRoot{
+		ReadOnly: []string{"/usr", "/etc/ssl"},
+		Writable: []string{"/var/cache/go"},
+		Workdir:  "/src/app",
+		Bwrap:    []string{"/opt/bwrap", "--new-session"},
+	}
+	spec := r.Spec(Spec{Name: "make", Args: []string{"all"}, Env: []string{"CC=gcc"}})
+	want := Spec{
+		Name: "/opt/bwrap",
+		Args: []string{
+			"--new-session", "--unshare-all", "--die-with-parent",
+			"--proc", "/proc", "--dev", "/dev", "--tmpfs", "/tmp",
+			"--ro-bind", "/usr", "/usr", "--ro-bind", "/etc/ssl", "/etc/ssl",
+			"--bind", "/var/cache/go", "/var/cache/go",
+			"--bind", "/src/app", "/src/app", "--chdir", "/src/app",
+			"--", "make", "all",
+		},
+		Env: []string{"CC=gcc"},
+	}
+	if !reflect.DeepEqual(spec, want) {
+		t.Fatalf("expected %q, got %q", want, spec)
+	}
+	if len(r.Bwrap) != 2 {
+		t.Fatalf("Spec changed the RunRoot's Bwrap: %q", r.Bwrap)
+	}
+	spec = RunRoot{Network: true}.Spec(Spec{Name: "ls", Dir: "/usr"})
+	if spec.Name != "bwrap" || spec.Args[1] != "--share-net" || !strings.Contains(strings.Join(spec.Args, " "), "--chdir /usr --") {
+		t.Fatalf("unexpected spec %q", spec)
+	}
+}
+
+func TestRunRoot(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("bwrap only runs on linux")
+	}
+	if _, err := exec.LookPath("bwrap"); err != nil {
+		t.Skip("bwrap isn't installed")
+	}
+	work := t.TempDir()
+	r := RunRoot{Workdir: work}
+	for _, dir := range []string{"/usr", "/bin", "/lib", "/lib64"} {
+		if _, err := os.Stat(dir); err == nil {
+			r.ReadOnly = append(r.ReadOnly, dir)
+		}
+	}
+	spec := r.Spec(Spec{Name: "sh", Args: []string{"-c", "pwd > out; if [ -e /home ]; then touch leaked; fi"}})
+	if out, err := spec.Command().CombinedOutput(); err != nil {
+		t.Skipf("bwrap can't run here: %v: %s", err, out)
+	}
+	b, err := os.ReadFile(filepath.Join(work, "out"))
+	if err != nil || strings.TrimSpace(string(b)) != work {
+		t.Fatalf("expected the command to run in %s, got %q, %v", work, b, err)
+	}
+	if _, err := os.Stat(filepath.Join(work, "leaked")); err == nil {
+		t.Fatal("the command could see a directory outside the root")
+	}
+}
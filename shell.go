@@ -0,0 +1,169 @@
+package deputy
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// ShellProgram is a shell that commands can be run with.
+type ShellProgram struct {
+	// Path is the shell's program, either a path or a name to look up in
+	// PATH.
+	Path string
+	// Args are the arguments that come before the command, such as "-c".
+	Args []string
+}
+
+// Command returns a command that runs command with the shell.
+func (s ShellProgram) Command(command string) *exec.Cmd {
+	args := append(s.Args[:len(s.Args):len(s.Args)], command)
+	return exec.Command(s.Path, args...)
+}
+
+// Shells maps a GOOS to the shells that Shell may use there, in order of
+// preference; the first one that is installed is used.  Shells for any other
+// GOOS are found under "".  Applications can change it at startup, for
+// instance to prefer bash over sh, or powershell over cmd.  It must not be
+// modified while commands are running.
+var Shells = map[string][]ShellProgram{
+	"": {
+		{Path: "/bin/sh", Args: []string{"-c"}},
+		{Path: "sh", Args: []string{"-c"}},
+	},
+	"android": {
+		{Path: "/system/bin/sh", Args: []string{"-c"}},
+		{Path: "sh", Args: []string{"-c"}},
+	},
+	"windows": {
+		{Path: "cmd", Args: []string{"/C"}},
+		{Path: "powershell", Args: []string{"-NoProfile", "-NonInteractive", "-Command"}},
+		{Path: "pwsh", Args: []string{"-NoProfile", "-NonInteractive", "-Command"}},
+	},
+}
+
+// SystemShell returns the shell that Shell uses by default: the first of the
+// Shells for this GOOS that is installed.  If none of them is, it returns the
+// first of them anyway, so that running a command with it reports that the
+// shell wasn't found.
+func SystemShell() ShellProgram {
+	shells, ok := Shells[runtime.GOOS]
+	if !ok {
+		shells = Shells[""]
+	}
+	for _, s := range shells {
+		if _, err := exec.LookPath(s.Path); err == nil {
+			return s
+		}
+	}
+	if len(shells) > 0 {
+		return shells[0]
+	}
+	return ShellProgram{Path: "sh", Args: []string{"-c"}}
+}
+
+// shellCommand returns a command that runs command with the system shell.
+func shellCommand(command string) *exec.Cmd {
+	return SystemShell().Command(command)
+}
+
+// Quote returns args joined by spaces, with each argument quoted as necessary
+// so that a POSIX shell would split the result back into the same arguments.
+func Quote(args ...string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = quoteArg(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func quoteArg(arg string) string {
+	if arg == "" {
+		return "''"
+	}
+	if strings.IndexFunc(arg, needsQuote) == -1 {
+		return arg
+	}
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
+
+// needsQuote reports whether r has to be quoted to be passed to a shell
+// literally.
+func needsQuote(r rune) bool {
+	switch {
+	case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		return false
+	}
+	return !strings.ContainsRune("_@%+=:,./-", r)
+}
+
+// SplitShell splits s into words the way a POSIX shell would, honoring single
+// quotes, double quotes, and backslash escapes.  No expansion of variables,
+// globs, or command substitutions is performed.
+func SplitShell(s string) ([]string, error) {
+	var (
+		words  []string
+		word   []rune
+		inWord bool
+	)
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, string(word))
+				word, inWord = word[:0], false
+			}
+		case r == '\\':
+			i++
+			if i == len(runes) {
+				return nil, errors.New("deputy: unterminated backslash escape")
+			}
+			if runes[i] != '\n' {
+				word, inWord = append(word, runes[i]), true
+			}
+		case r == '\'':
+			end := indexRune(runes, i+1, '\'')
+			if end == -1 {
+				return nil, errors.New("deputy: unterminated single quote")
+			}
+			word, inWord = append(word, runes[i+1:end]...), true
+			i = end
+		case r == '"':
+			inWord = true
+			for i++; ; i++ {
+				if i == len(runes) {
+					return nil, errors.New("deputy: unterminated double quote")
+				}
+				if runes[i] == '"' {
+					break
+				}
+				if runes[i] == '\\' && i+1 < len(runes) && strings.ContainsRune("$`\"\\\n", runes[i+1]) {
+					i++
+					if runes[i] == '\n' {
+						continue
+					}
+				}
+				word = append(word, runes[i])
+			}
+		default:
+			word, inWord = append(word, r), true
+		}
+	}
+	if inWord {
+		words = append(words, string(word))
+	}
+	return words, nil
+}
+
+// indexRune returns the index of the first r in runes at or after start, or -1.
+func indexRune(runes []rune, start int, r rune) int {
+	for i := start; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
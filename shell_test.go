@@ -0,0 +1,103 @@
+package deputy
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"ls", "-l"}, "ls -l"},
+		{[]string{"echo", ""}, "echo ''"},
+		{[]string{"echo", "hello world"}, "echo 'hello world'"},
+		{[]string{"echo", "it's"}, `echo 'it'\''s'`},
+		{[]string{"echo", "$HOME"}, "echo '$HOME'"},
+	}
+	for _, test := range tests {
+		if got := Quote(test.args...); got != test.want {
+			t.Errorf("Quote(%q) = %q, want %q", test.args, got, test.want)
+		}
+	}
+}
+
+func TestSplitShell(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"", nil},
+		{"  ls   -l ", []string{"ls", "-l"}},
+		{`echo 'hello world'`, []string{"echo", "hello world"}},
+		{`echo "a \"b\" \$c \d"`, []string{"echo", `a "b" $c \d`}},
+		{`echo a\ b`, []string{"echo", "a b"}},
+		{`echo ''`, []string{"echo", ""}},
+		{`echo foo'bar'"baz"`, []string{"echo", "foobarbaz"}},
+		{"echo a\\\nb", []string{"echo", "ab"}},
+	}
+	for _, test := range tests {
+		got, err := SplitShell(test.s)
+		if err != nil {
+			t.Errorf("SplitShell(%q) returned error: %v", test.s, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("SplitShell(%q) = %q, want %q", test.s, got, test.want)
+		}
+	}
+
+	for _, s := range []string{`echo 'foo`, `echo "foo`, `echo foo\`} {
+		if _, err := SplitShell(s); err == nil {
+			t.Errorf("SplitShell(%q) expected error", s)
+		}
+	}
+}
+
+func TestQuoteRoundTrip(t *testing.T) {
+	args := []string{"a b", "it's", `"quoted"`, "", `back\slash`, "$x", "tab\there"}
+	got, err := SplitShell(Quote(args...))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, args) {
+		t.Fatalf("round trip of %q gave %q", args, got)
+	}
+}
+
+func TestSystemShell(t *testing.T) {
+	defer func(old []ShellProgram) { Shells[runtime.GOOS] = old }(Shells[runtime.GOOS])
+	want := ShellProgram{Path: os.Args[0], Args: []string{"-test.run=none"}}
+	Shells[runtime.GOOS] = []ShellProgram{{Path: "no-such-shell"}, want}
+	if got := SystemShell(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected the first installed shell %v, got %v", want, got)
+	}
+	Shells[runtime.GOOS] = []ShellProgram{{Path: "no-such-shell"}}
+	if got := SystemShell(); got.Path != "no-such-shell" {
+		t.Fatalf("expected the first shell when none is installed, got %v", got)
+	}
+}
+
+func TestShellProgram(t *testing.T) {
+	stop := errors.New("stop")
+	var args []string
+	preStart := WithPreStart(func(cmd *exec.Cmd) error {
+		args = cmd.Args
+		return stop
+	})
+	shell := ShellProgram{Path: "bash", Args: []string{"-e", "-c"}}
+	if err := (Deputy{ShellProgram: shell}).Shell("echo hi", preStart); err != stop {
+		t.Fatalf("expected the PreStart error, got %v", err)
+	}
+	if want := []string{"bash", "-e", "-c", "echo hi"}; !reflect.DeepEqual(args, want) {
+		t.Fatalf("expected args %q, got %q", want, args)
+	}
+	if err := (Deputy{}).Shell("echo hi", preStart, WithShellProgram(shell)); err != stop || args[0] != "bash" {
+		t.Fatalf("expected WithShellProgram to set the shell, got %v and %q", err, args)
+	}
+}
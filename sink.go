@@ -0,0 +1,127 @@
+package deputy
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// Sink is a destination for the lines of output from a command.  A Deputy
+// opens each of its Sinks before starting a command, writes every line the
+// command outputs to them, and flushes and closes them once the command has
+// finished.  The methods of a Sink are never called concurrently by a single
+// run, but a Sink shared by Deputies running commands at the same time must
+// cope with being opened again before it is closed.
+type Sink interface {
+	// Open prepares the sink to receive lines.  If it returns an error, the
+	// command is not run.
+	Open() error
+	// WriteLine writes a line of output.  The line's Text is only valid until
+	// WriteLine returns.
+	WriteLine(Line) error
+	// Flush writes any buffered data to the sink's underlying destination.
+	Flush() error
+	// Close releases the sink's resources at the end of a run.
+	Close() error
+}
+
+// WriterSink returns a Sink that writes each line and a newline to w.  Its
+// Open and Close methods do nothing, and its Flush method calls w's Flush
+// method if it has one, so that w can be a *bufio.Writer of whatever size
+// suits the command's output.
+func WriterSink(w io.Writer) Sink {
+	return writerSink{w}
+}
+
+type writerSink struct {
+	w io.Writer
+}
+
+func (s writerSink) Open() error  { return nil }
+func (s writerSink) Close() error { return nil }
+
+func (s writerSink) Flush() error {
+	if f, ok := s.w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (s writerSink) WriteLine(l Line) error {
+	if _, err := s.w.Write(l.Text); err != nil {
+		return err
+	}
+	_, err := s.w.Write([]byte{'\n'})
+	return err
+}
+
+// sinkSet manages the Sinks of a single run.
+type sinkSet struct {
+	mu     sync.Mutex
+	sinks  []Sink
+	ctx    context.Context
+	opened int
+	// failed records the sinks that have failed a write, by index.
+	failed []bool
+	// fail is called with the first error writing to each sink, and with
+	// every error flushing or closing one.
+	fail func(*PipeError)
+	// checkpoint is the earliest Checkpoint reported by the CheckpointSinks
+	// when they were closed, if any.
+	checkpoint *Checkpoint
+}
+
+// open opens every sink, closing the ones already opened if one fails.
+func (s *sinkSet) open() error {
+	s.failed = make([]bool, len(s.sinks))
+	for _, sink := range s.sinks {
+		var err error
+		if cs, ok := sink.(ContextSink); ok {
+			err = cs.OpenContext(s.ctx)
+		} else {
+			err = sink.Open()
+		}
+		if err != nil {
+			s.close()
+			return err
+		}
+		s.opened++
+	}
+	return nil
+}
+
+// log returns a log function that writes lines of the given stream to every
+// sink.
+func (s *sinkSet) log(stream Stream) func([]byte) {
+	return func(b []byte) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, sink := range s.sinks[:s.opened] {
+			err := sink.WriteLine(Line{Stream: stream, Text: b})
+			if err == nil || s.failed[i] {
+				continue
+			}
+			s.failed[i] = true
+			s.fail(&PipeError{Stream: stream, Sink: sink, Err: err})
+		}
+	}
+}
+
+// close flushes and closes the opened sinks.
+func (s *sinkSet) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sink := range s.sinks[:s.opened] {
+		err := sink.Flush()
+		if cs, ok := sink.(CheckpointSink); ok && err == nil {
+			s.recordCheckpoint(cs.Checkpoint())
+		}
+		if cerr := sink.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			s.fail(&PipeError{Sink: sink, Err: err})
+		}
+	}
+	s.opened = 0
+}
@@ -0,0 +1,120 @@
+package deputy
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type testSink struct {
+	openErr, writeErr error
+	calls             []string
+	lines             []string
+}
+
+func (s *testSink) Open() error {
+	s.calls = append(s.calls, "open")
+	return s.openErr
+}
+
+func (s *testSink) WriteLine(l Line) error {
+	s.lines = append(s.lines, l.Stream.String()+": "+string(l.Text))
+	return s.writeErr
+}
+
+func (s *testSink) Flush() error {
+	s.calls = append(s.calls, "flush")
+	return nil
+}
+
+func (s *testSink) Close() error {
+	s.calls = append(s.calls, "close")
+	return nil
+}
+
+func TestSinkLifecycle(t *testing.T) {
+	s := &testSink{}
+	cmd := maker{
+		stdout: "foo!",
+		stderr: "bar!",
+	}.make()
+	if err := (Deputy{Sinks: []Sink{s}, Timestamp: "2006"}).Run(cmd); err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	if got := strings.Join(s.calls, ","); got != "open,flush,close" {
+		t.Fatalf("unexpected sink calls %s", got)
+	}
+	if len(s.lines) != 2 {
+		t.Fatalf("expected 2 lines but got %q", s.lines)
+	}
+	for _, l := range s.lines {
+		if !strings.HasSuffix(l, "foo!") && !strings.HasSuffix(l, "bar!") {
+			t.Errorf("unexpected line %q", l)
+		}
+	}
+}
+
+func TestSinkErrors(t *testing.T) {
+	openErr := errors.New("open failed")
+	cmd := maker{}.make()
+	err := Deputy{Sinks: []Sink{&testSink{}, &testSink{openErr: openErr}}}.Run(cmd)
+	if err != openErr {
+		t.Fatalf("expected open error but got %v", err)
+	}
+	if cmd.Process != nil {
+		t.Fatal("command was started despite a sink failing to open")
+	}
+
+	writeErr := errors.New("write failed")
+	err = Deputy{Sinks: []Sink{&testSink{writeErr: writeErr}}}.Run(maker{stdout: "foo"}.make())
+	var perr *PipeError
+	if !errors.As(err, &perr) || perr.Err != writeErr || perr.Stream != Stdout {
+		t.Fatalf("expected write error but got %v", err)
+	}
+}
+
+func TestWriterSink(t *testing.T) {
+	b := &strings.Builder{}
+	if err := (Deputy{Sinks: []Sink{WriterSink(b)}}).Run(maker{stdout: "foo!"}.make()); err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	if b.String() != "foo!\n" {
+		t.Fatalf("unexpected output %q", b.String())
+	}
+}
+
+func TestWriterSinkFlush(t *testing.T) {
+	b := &strings.Builder{}
+	w := bufio.NewWriterSize(b, 4096)
+	if err := (Deputy{Sinks: []Sink{WriterSink(w)}}).Run(maker{stdout: "foo!"}.make()); err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	if b.String() != "foo!\n" {
+		t.Fatalf("expected buffered output to be flushed, got %q", b.String())
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	inner := &testSink{}
+	s := Summarize(inner, 0)
+	for _, text := range []string{"a", "b", "b", "b", "a", "a"} {
+		_ = s.WriteLine(Line{Stream: Stdout, Text: []byte(text)})
+	}
+	_ = s.WriteLine(Line{Stream: Stderr, Text: []byte("a")})
+	_ = s.Flush()
+	want := []string{"stdout: a", "stdout: b", "stdout: last message repeated 2 times", "stdout: a", "stdout: last message repeated 1 times", "stderr: a"}
+	if strings.Join(inner.lines, "|") != strings.Join(want, "|") {
+		t.Fatalf("expected lines %q, got %q", want, inner.lines)
+	}
+
+	inner = &testSink{}
+	d := Deputy{Sinks: []Sink{Summarize(inner, 2)}}
+	if err := d.Shell("for i in 1 2 3 4 5; do echo $i; done"); err != nil {
+		t.Fatalf("unexpected error returned from Shell: %v", err)
+	}
+	want = []string{"stdout: 1", "stdout: 2", "stdout: 3 lines dropped over the limit of 2 a second"}
+	if strings.Join(inner.lines, "|") != strings.Join(want, "|") {
+		t.Fatalf("expected lines %q, got %q", want, inner.lines)
+	}
+}
@@ -0,0 +1,27 @@
+package deputy
+
+import "os/exec"
+
+// Spec describes a command to run, independent of any particular exec.Cmd.
+// A Spec can be marshalled to and from JSON, with the values of secrets
+// redacted as described in MarshalJSON.
+type Spec struct {
+	// Name is the program to run, resolved the same way exec.Command does.
+	Name string `json:"name"`
+	// Args are the arguments to the program, not including its name.
+	Args []string `json:"args,omitempty"`
+	// Env, if non-nil, is the environment of the command, as in exec.Cmd.
+	// It is always written to JSON, as null when it is nil, so that an empty
+	// environment isn't read back as the parent's.
+	Env []string `json:"env"`
+	// Dir, if non-empty, is the working directory of the command.
+	Dir string `json:"dir,omitempty"`
+}
+
+// Command returns an exec.Cmd that will run the command described by s.
+func (s Spec) Command() *exec.Cmd {
+	cmd := exec.Command(s.Name, s.Args...)
+	cmd.Env = s.Env
+	cmd.Dir = s.Dir
+	return cmd
+}
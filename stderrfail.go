@@ -0,0 +1,65 @@
+package deputy
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sync"
+)
+
+// ErrStderrOutput is wrapped by the error returned from Run when a command is
+// stopped because of what it wrote to stderr, as set by FailOnStderr.  The
+// error's text ends with the offending line.
+var ErrStderrOutput = errors.New("deputy: command wrote to stderr")
+
+// stderrWatch watches the lines of a command's stderr for one that should
+// stop the command.
+type stderrWatch struct {
+	re *regexp.Regexp
+	// failed is closed once a line matches, after line is set.
+	failed chan struct{}
+	once   sync.Once
+	line   string
+}
+
+// watchStderr arranges for the command's stderr to be watched for lines
+// matching FailOnStderr.  It returns a function to call once the command is
+// done.
+func (d *Deputy) watchStderr(cmd *exec.Cmd) (flush func()) {
+	w := &stderrWatch{re: d.FailOnStderr, failed: make(chan struct{})}
+	d.stderrWatch = w
+	if d.StderrLog != nil || cmd.Stderr == nil {
+		d.StderrLog = joinLogs(d.StderrLog, w.log)
+		return func() {}
+	}
+	lw := &lineWriter{log: w.log}
+	cmd.Stderr = dualWriter(cmd.Stderr, lw)
+	return lw.flush
+}
+
+// log checks a line of stderr.
+func (w *stderrWatch) log(b []byte) {
+	if isClosed(w.failed) || !w.re.Match(b) {
+		return
+	}
+	w.once.Do(func() {
+		w.line = string(b)
+		close(w.failed)
+	})
+}
+
+// err returns the error for the line that matched.  It must only be called
+// once failed is closed.
+func (w *stderrWatch) err() error {
+	return fmt.Errorf("%w: %s", ErrStderrOutput, w.line)
+}
+
+// stderrFailed returns a channel that is closed when the command writes a
+// line to stderr that should stop it, or nil if its stderr isn't watched.
+func (d Deputy) stderrFailed() <-chan struct{} {
+	if d.stderrWatch == nil {
+		return nil
+	}
+	return d.stderrWatch.failed
+}
@@ -0,0 +1,40 @@
+package deputy
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFailOnStderr(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	d := Deputy{FailOnStderr: regexp.MustCompile("^fatal")}
+	start := time.Now()
+	err := d.Shell("echo warning >&2; echo 'fatal: broken' >&2; exec sleep 5")
+	if !errors.Is(err, ErrStderrOutput) || !strings.HasSuffix(err.Error(), "fatal: broken") {
+		t.Fatalf("expected the stderr line as the error, got %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatal("command wasn't stopped when it wrote to stderr")
+	}
+
+	var buf bytes.Buffer
+	cmd := shellCommand("echo 'fatal: again' >&2; exec sleep 5")
+	cmd.Stderr = &buf
+	if err := d.Run(cmd); !errors.Is(err, ErrStderrOutput) {
+		t.Fatalf("expected the stderr line as the error, got %v", err)
+	}
+	if buf.String() != "fatal: again\n" {
+		t.Fatalf("expected stderr to still reach cmd.Stderr, got %q", buf.String())
+	}
+
+	if err := d.Shell("echo warning >&2"); err != nil {
+		t.Fatalf("unexpected error returned from Shell: %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package deputy
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"sync/atomic"
+)
+
+// stdinPump copies a command's Stdin into it.  Unlike the copy exec.Cmd does
+// itself, which Wait waits for, the pump is given up on once the command has
+// exited or been stopped, so a Stdin that blocks, or a full pipe that a child
+// of the command holds open, can't keep Run from returning.
+type stdinPump struct {
+	r io.Reader
+	w io.WriteCloser
+	// n is how many bytes have been written to the command, accessed
+	// atomically.
+	n int64
+}
+
+// pumpStdin replaces a command's Stdin with a pipe fed by a stdinPump, unless
+// the Stdin is a file, which the command reads directly.
+func (d *Deputy) pumpStdin(cmd *exec.Cmd) error {
+	r := cmd.Stdin
+	if _, ok := r.(*os.File); ok || r == nil {
+		return nil
+	}
+	cmd.Stdin = nil
+	w, err := cmd.StdinPipe()
+	if err != nil {
+		cmd.Stdin = r
+		return err
+	}
+	d.stdin = &stdinPump{r: r, w: w}
+	return nil
+}
+
+// run copies the Stdin into the command until it ends or the pipe is closed,
+// and then closes the pipe, so the command sees the end of its input.
+func (p *stdinPump) run() {
+	_, _ = io.Copy(p, p.r)
+	_ = p.w.Close()
+}
+
+// Write implements io.Writer, counting the bytes written.
+func (p *stdinPump) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	atomic.AddInt64(&p.n, int64(n))
+	return n, err
+}
+
+// written returns how many bytes have been written to the command.
+func (p *stdinPump) written() int64 {
+	return atomic.LoadInt64(&p.n)
+}
@@ -0,0 +1,46 @@
+package deputy
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStdinBytes(t *testing.T) {
+	cmd := maker{}.make()
+	cmd.Stdin = strings.NewReader("some input")
+	res, err := Deputy{}.RunResult(cmd)
+	if err != nil {
+		t.Fatalf("unexpected error returned from Run: %v", err)
+	}
+	// the helper doesn't read its input, so it may get none of it.
+	if res.StdinBytes < 0 || res.StdinBytes > 10 {
+		t.Fatalf("unexpected StdinBytes %d", res.StdinBytes)
+	}
+}
+
+func TestStdinBlocked(t *testing.T) {
+	// a Stdin that never ends, and that the command never reads, must not
+	// keep Run from returning when the command times out.
+	r, w := io.Pipe()
+	defer w.Close()
+	go func() {
+		chunk := make([]byte, 64*1024)
+		for {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+		}
+	}()
+	cmd := maker{timeout: 5 * time.Second}.make()
+	cmd.Stdin = r
+	start := time.Now()
+	res, err := Deputy{Timeout: 100 * time.Millisecond}.RunResult(cmd)
+	if err == nil || time.Since(start) > 3*time.Second {
+		t.Fatalf("expected a prompt timeout, got %v after %v", err, time.Since(start))
+	}
+	if res.StdinBytes == 0 {
+		t.Fatal("expected some input to be written before the pipe filled")
+	}
+}
@@ -0,0 +1,108 @@
+package deputy
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// Summarize returns a Sink that passes lines on to sink, protecting it from
+// log storms.  A run of identical lines is passed on once, followed by a line
+// saying "last message repeated N times", as syslog does.  If maxPerSecond is
+// positive, lines beyond that many in a second are dropped, and a line saying
+// how many were dropped is passed on once the second is over, or when the
+// Sink is flushed.  The returned Sink keeps the state of a single run, so it
+// must not be shared by Deputies running commands at the same time.
+func Summarize(sink Sink, maxPerSecond int) Sink {
+	return &summarySink{sink: sink, max: maxPerSecond}
+}
+
+// summarySink is the Sink returned by Summarize.
+type summarySink struct {
+	sink Sink
+	max  int
+
+	// last is the last line passed on, and repeats how many times it has
+	// been repeated since.
+	last    Line
+	repeats int
+	// window is when the current second began, and passed and dropped
+	// count the lines passed on and dropped in it.
+	window          time.Time
+	passed, dropped int
+}
+
+// Open implements Sink.
+func (s *summarySink) Open() error {
+	s.last, s.repeats = Line{}, 0
+	s.window, s.passed, s.dropped = time.Time{}, 0, 0
+	return s.sink.Open()
+}
+
+// WriteLine implements Sink.
+func (s *summarySink) WriteLine(l Line) error {
+	if s.last.Stream == l.Stream && s.last.Text != nil && bytes.Equal(s.last.Text, l.Text) {
+		s.repeats++
+		return nil
+	}
+	if err := s.flushRepeats(); err != nil {
+		return err
+	}
+	s.last = Line{Stream: l.Stream, Text: append(s.last.Text[:0], l.Text...)}
+	return s.pass(l)
+}
+
+// flushRepeats passes on the count of repeats of the last line, if any.
+func (s *summarySink) flushRepeats() error {
+	if s.repeats == 0 {
+		return nil
+	}
+	n := s.repeats
+	s.repeats = 0
+	return s.pass(Line{Stream: s.last.Stream, Text: []byte(fmt.Sprintf("last message repeated %d times", n))})
+}
+
+// pass passes l on, unless it is over the rate limit.
+func (s *summarySink) pass(l Line) error {
+	if s.max <= 0 {
+		return s.sink.WriteLine(l)
+	}
+	if now := time.Now(); now.Sub(s.window) >= time.Second {
+		if err := s.flushDropped(); err != nil {
+			return err
+		}
+		s.window, s.passed = now, 0
+	}
+	if s.passed >= s.max {
+		s.dropped++
+		return nil
+	}
+	s.passed++
+	return s.sink.WriteLine(l)
+}
+
+// flushDropped passes on the count of dropped lines, if any.
+func (s *summarySink) flushDropped() error {
+	if s.dropped == 0 {
+		return nil
+	}
+	n := s.dropped
+	s.dropped = 0
+	return s.sink.WriteLine(Line{Stream: s.last.Stream, Text: []byte(fmt.Sprintf("%d lines dropped over the limit of %d a second", n, s.max))})
+}
+
+// Flush implements Sink.
+func (s *summarySink) Flush() error {
+	if err := s.flushRepeats(); err != nil {
+		return err
+	}
+	if err := s.flushDropped(); err != nil {
+		return err
+	}
+	return s.sink.Flush()
+}
+
+// Close implements Sink.
+func (s *summarySink) Close() error {
+	return s.sink.Close()
+}
@@ -0,0 +1,170 @@
+package deputy
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Target is somewhere commands can be run, such as this machine or a remote
+// host, described by labels so that commands can be sent to the targets with
+// a given role rather than to hosts named in the code.
+type Target interface {
+	// Name identifies the target, such as by its host name.
+	Name() string
+	// Labels describe the target, such as "role": "db".
+	Labels() map[string]string
+	// Run runs the command described by spec on the target, with opts
+	// applied to the Deputy that runs it.
+	Run(spec Spec, opts ...Option) (Result, error)
+}
+
+// Local is a Target that runs commands on this machine.
+type Local struct {
+	// ID is the target's name.  It defaults to "localhost".
+	ID string
+	// Tags are the target's labels.
+	Tags map[string]string
+	// Deputy runs the commands.
+	Deputy Deputy
+}
+
+// Name implements Target.
+func (l Local) Name() string {
+	if l.ID == "" {
+		return "localhost"
+	}
+	return l.ID
+}
+
+// Labels implements Target.
+func (l Local) Labels() map[string]string {
+	return l.Tags
+}
+
+// Run implements Target.
+func (l Local) Run(spec Spec, opts ...Option) (Result, error) {
+	return l.Deputy.RunResult(spec.Command(), opts...)
+}
+
+// Inventory is a list of Targets.
+type Inventory []Target
+
+// Select returns the targets whose labels match selector, in order.  A
+// selector is a comma separated list of requirements, all of which must be
+// met, such as "role=db,env!=test".  Each requirement is one of:
+//
+//	key=value   the label is set to value
+//	key!=value  the label is not set to value, or not set at all
+//	key         the label is set
+//	!key        the label is not set
+//
+// An empty selector matches every target.
+func (inv Inventory) Select(selector string) (Inventory, error) {
+	reqs, err := parseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	var selected Inventory
+	for _, t := range inv {
+		if reqs.match(t.Labels()) {
+			selected = append(selected, t)
+		}
+	}
+	return selected, nil
+}
+
+// Run runs the command described by spec on every target, at most parallel
+// at a time, or all at once if parallel is zero or less, and waits for them
+// to finish.  Each line of output the targets log is prefixed with the
+// target's name and ": ".  It returns a Result for each target, in the same
+// order as inv.  If the command failed on any of them, it also returns a
+// *MultiError, in which each Failure's Index is the target's position in inv.
+func (inv Inventory) Run(spec Spec, parallel int, opts ...Option) ([]Result, error) {
+	results := make([]Result, len(inv))
+	if parallel <= 0 || parallel > len(inv) {
+		parallel = len(inv)
+	}
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, t := range inv {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, t Target) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			o := append(opts[:len(opts):len(opts)], WithPrefix(t.Name()+": "))
+			results[i], _ = t.Run(spec, o...)
+		}(i, t)
+	}
+	wg.Wait()
+
+	var m MultiError
+	for i, res := range results {
+		if res.Err != nil {
+			m.Failures = append(m.Failures, Failure{Index: i, Result: res})
+		}
+	}
+	if len(m.Failures) > 0 {
+		m.Total = len(results)
+		return results, &m
+	}
+	return results, nil
+}
+
+// requirement is one term of a label selector.
+type requirement struct {
+	key, value string
+	// hasValue is whether the term compares the label's value, rather than
+	// whether it is set.
+	hasValue bool
+	not      bool
+}
+
+// selector is a parsed label selector.
+type selector []requirement
+
+// parseSelector parses a label selector, as described by Inventory.Select.
+func parseSelector(s string) (selector, error) {
+	var sel selector
+	if strings.TrimSpace(s) == "" {
+		return sel, nil
+	}
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		var r requirement
+		switch {
+		case strings.Contains(term, "!="):
+			r.key, r.value, _ = strings.Cut(term, "!=")
+			r.hasValue, r.not = true, true
+		case strings.Contains(term, "="):
+			r.key, r.value, _ = strings.Cut(term, "=")
+			r.hasValue = true
+		case strings.HasPrefix(term, "!"):
+			r.key, r.not = term[1:], true
+		default:
+			r.key = term
+		}
+		r.key, r.value = strings.TrimSpace(r.key), strings.TrimSpace(r.value)
+		if r.key == "" {
+			return nil, fmt.Errorf("deputy: invalid label selector %q", s)
+		}
+		sel = append(sel, r)
+	}
+	return sel, nil
+}
+
+// match reports whether labels meet every requirement of the selector.
+func (sel selector) match(labels map[string]string) bool {
+	for _, r := range sel {
+		v, ok := labels[r.key]
+		met := ok
+		if r.hasValue {
+			met = ok && v == r.value
+		}
+		if met == r.not {
+			return false
+		}
+	}
+	return true
+}
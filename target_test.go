@@ -0,0 +1,42 @@
+package deputy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInventorySelect(t *testing.T) {
+	inv := Inventory{
+		Host{Addr: "db1", Tags: map[string]string{"role": "db", "env": "prod"}},
+		Host{Addr: "db2", Tags: map[string]string{"role": "db", "env": "test"}},
+		Host{Addr: "web1", Tags: map[string]string{"role": "web", "canary": ""}},
+		Local{},
+	}
+	tests := []struct {
+		selector string
+		want     []string
+	}{
+		{"", []string{"db1", "db2", "web1", "localhost"}},
+		{"role=db", []string{"db1", "db2"}},
+		{"role=db, env!=test", []string{"db1"}},
+		{"env!=prod", []string{"db2", "web1", "localhost"}},
+		{"canary", []string{"web1"}},
+		{"!role", []string{"localhost"}},
+	}
+	for _, test := range tests {
+		sel, err := inv.Select(test.selector)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", test.selector, err)
+		}
+		var names []string
+		for _, tg := range sel {
+			names = append(names, tg.Name())
+		}
+		if !reflect.DeepEqual(names, test.want) {
+			t.Errorf("%q: expected %q, got %q", test.selector, test.want, names)
+		}
+	}
+	if _, err := inv.Select("role=db,=x"); err == nil {
+		t.Error("expected an error for an empty label name")
+	}
+}
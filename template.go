@@ -0,0 +1,155 @@
+package deputy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Template builds Specs from a command line containing placeholders.  The
+// command line is split into words once, when the template is parsed, and
+// values are then substituted into those words.  A value is never split or
+// interpreted by a shell, so it can't inject extra arguments or commands no
+// matter what it contains.
+//
+// A placeholder is written as {name}, and may appear anywhere in a word, such
+// as --output={file}.  A word consisting only of {name...} is replaced by zero
+// or more arguments, one for each element of a []string value.  Use {{ and }}
+// for literal braces.  The first word, which names the program, can't contain
+// placeholders, so that values never choose what is run, and placeholders
+// can't be nested.
+type Template struct {
+	words [][]segment
+}
+
+// segment is either literal text or a placeholder in a template word.
+type segment struct {
+	text   string
+	isVar  bool
+	isList bool
+}
+
+// ParseTemplate parses tmpl, which is split into words with SplitShell.
+func ParseTemplate(tmpl string) (*Template, error) {
+	words, err := SplitShell(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, errors.New("deputy: empty command template")
+	}
+	t := &Template{}
+	for i, w := range words {
+		segs, err := parseWord(w)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 && (len(segs) > 1 || segs[0].isVar) {
+			return nil, fmt.Errorf("deputy: placeholder in the program name %q", w)
+		}
+		t.words = append(t.words, segs)
+	}
+	return t, nil
+}
+
+// MustParseTemplate is like ParseTemplate but panics if tmpl can't be parsed.
+// It is intended for templates defined in package-level variables.
+func MustParseTemplate(tmpl string) *Template {
+	t, err := ParseTemplate(tmpl)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func parseWord(w string) ([]segment, error) {
+	var segs []segment
+	var lit strings.Builder
+	for i := 0; i < len(w); i++ {
+		switch {
+		case strings.HasPrefix(w[i:], "{{"), strings.HasPrefix(w[i:], "}}"):
+			lit.WriteByte(w[i])
+			i++
+		case w[i] == '{':
+			end := strings.IndexByte(w[i:], '}')
+			if end == -1 {
+				return nil, fmt.Errorf("deputy: unterminated placeholder in %q", w)
+			}
+			name := w[i+1 : i+end]
+			if strings.IndexByte(name, '{') >= 0 {
+				return nil, fmt.Errorf("deputy: nested placeholder in %q", w)
+			}
+			seg := segment{isVar: true}
+			if strings.HasSuffix(name, "...") {
+				name = strings.TrimSuffix(name, "...")
+				seg.isList = true
+			}
+			if name == "" {
+				return nil, fmt.Errorf("deputy: empty placeholder in %q", w)
+			}
+			seg.text = name
+			if lit.Len() > 0 {
+				segs = append(segs, segment{text: lit.String()})
+				lit.Reset()
+			}
+			segs = append(segs, seg)
+			i += end
+		case w[i] == '}':
+			return nil, fmt.Errorf("deputy: unexpected } in %q", w)
+		default:
+			lit.WriteByte(w[i])
+		}
+	}
+	if lit.Len() > 0 || len(segs) == 0 {
+		segs = append(segs, segment{text: lit.String()})
+	}
+	for _, seg := range segs {
+		if seg.isList && len(segs) > 1 {
+			return nil, fmt.Errorf("deputy: list placeholder {%s...} must be a word by itself", seg.text)
+		}
+	}
+	return segs, nil
+}
+
+// Spec returns a Spec with the template's placeholders replaced by the
+// corresponding values in vars.  Values for {name} placeholders must be
+// strings, and values for {name...} placeholders must be []string.  It is an
+// error for a placeholder to have no value.
+func (t *Template) Spec(vars map[string]interface{}) (Spec, error) {
+	var args []string
+	for _, segs := range t.words {
+		if len(segs) == 1 && segs[0].isList {
+			v, ok := vars[segs[0].text]
+			if !ok {
+				return Spec{}, fmt.Errorf("deputy: no value for placeholder {%s...}", segs[0].text)
+			}
+			list, ok := v.([]string)
+			if !ok {
+				return Spec{}, fmt.Errorf("deputy: value for placeholder {%s...} must be a []string, not %T", segs[0].text, v)
+			}
+			args = append(args, list...)
+			continue
+		}
+		var word strings.Builder
+		for _, seg := range segs {
+			if !seg.isVar {
+				word.WriteString(seg.text)
+				continue
+			}
+			v, ok := vars[seg.text]
+			if !ok {
+				return Spec{}, fmt.Errorf("deputy: no value for placeholder {%s}", seg.text)
+			}
+			s, ok := v.(string)
+			if !ok {
+				return Spec{}, fmt.Errorf("deputy: value for placeholder {%s} must be a string, not %T", seg.text, v)
+			}
+			word.WriteString(s)
+		}
+		args = append(args, word.String())
+	}
+	if len(args) == 0 || args[0] == "" {
+		return Spec{}, errors.New("deputy: command template produced an empty command name")
+	}
+	return Spec{Name: args[0], Args: args[1:]}, nil
+}
@@ -0,0 +1,55 @@
+package deputy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTemplateSpec(t *testing.T) {
+	tmpl := MustParseTemplate("git log --format={fmt} {rev} -- {paths...}")
+	spec, err := tmpl.Spec(map[string]interface{}{
+		"fmt":   "%H {{x}}",
+		"rev":   "HEAD; rm -rf /",
+		"paths": []string{"a b", "c"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := Spec{
+		Name: "git",
+		Args: []string{"log", "--format=%H {{x}}", "HEAD; rm -rf /", "--", "a b", "c"},
+	}
+	if !reflect.DeepEqual(spec, want) {
+		t.Fatalf("expected %#v but got %#v", want, spec)
+	}
+}
+
+func TestTemplateLiteralBraces(t *testing.T) {
+	spec, err := MustParseTemplate("echo {{}} {x}").Spec(map[string]interface{}{"x": ""})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"{}", ""}; !reflect.DeepEqual(spec.Args, want) {
+		t.Fatalf("expected %q but got %q", want, spec.Args)
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	for _, s := range []string{"", "echo {x", "echo {}", "echo x}", "echo -f={x...}", "{prog} -v", "/usr/bin/{tool}", "{args...}", "echo {a{b}", "echo {{{a{b}}"} {
+		if _, err := ParseTemplate(s); err == nil {
+			t.Errorf("ParseTemplate(%q) expected error", s)
+		}
+	}
+	tmpl := MustParseTemplate("echo {x} {y...}")
+	bad := []map[string]interface{}{
+		{"y": []string{}},
+		{"x": "a"},
+		{"x": 1, "y": []string{}},
+		{"x": "a", "y": "b"},
+	}
+	for _, vars := range bad {
+		if _, err := tmpl.Spec(vars); err == nil {
+			t.Errorf("Spec(%v) expected error", vars)
+		}
+	}
+}
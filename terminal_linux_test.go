@@ -0,0 +1,65 @@
+package deputy
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+func termios(t *testing.T, f *os.File) syscall.Termios {
+	t.Helper()
+	var tio syscall.Termios
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), syscall.TCGETS, uintptr(unsafe.Pointer(&tio))); e != 0 {
+		t.Fatal(e)
+	}
+	return tio
+}
+
+func TestMakeRaw(t *testing.T) {
+	ptmx, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skipf("no pseudo-terminals: %v", err)
+	}
+	defer ptmx.Close()
+	var n, unlock uint32
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, ptmx.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); e != 0 {
+		t.Skipf("can't unlock the pseudo-terminal: %v", e)
+	}
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, ptmx.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); e != 0 {
+		t.Skipf("can't find the pseudo-terminal: %v", e)
+	}
+	tty, err := os.OpenFile("/dev/pts/"+strconv.Itoa(int(n)), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("can't open the pseudo-terminal: %v", err)
+	}
+	defer tty.Close()
+
+	before := termios(t, tty)
+	if before.Lflag&syscall.ICANON == 0 {
+		t.Fatal("expected a new terminal to start out in canonical mode")
+	}
+	restore, err := makeRaw(tty.Fd())
+	if err != nil {
+		t.Fatalf("unexpected error from makeRaw: %v", err)
+	}
+	if raw := termios(t, tty); raw.Lflag&(syscall.ICANON|syscall.ECHO|syscall.ISIG) != 0 || raw.Cc[syscall.VMIN] != 1 {
+		t.Fatalf("expected the terminal to be in raw mode, got %+v", raw)
+	}
+	if err := restore(); err != nil {
+		t.Fatalf("unexpected error restoring the terminal: %v", err)
+	}
+	if after := termios(t, tty); after != before {
+		t.Fatalf("expected the terminal to be restored to %+v, got %+v", before, after)
+	}
+
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := makeRaw(f.Fd()); err == nil {
+		t.Fatal("expected makeRaw to fail on something that isn't a terminal")
+	}
+}
@@ -0,0 +1,36 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package deputy
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// makeRaw puts the terminal fd in raw mode, so that what is typed is passed on
+// a byte at a time, without being echoed or turned into signals.  The returned
+// function sets the terminal back to how it was.
+func makeRaw(fd uintptr) (restore func() error, err error) {
+	var saved syscall.Termios
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlGetTermios, uintptr(unsafe.Pointer(&saved))); e != 0 {
+		return nil, os.NewSyscallError("ioctl", e)
+	}
+	raw := saved
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Oflag &^= syscall.OPOST
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlSetTermios, uintptr(unsafe.Pointer(&raw))); e != 0 {
+		return nil, os.NewSyscallError("ioctl", e)
+	}
+	return func() error {
+		if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlSetTermios, uintptr(unsafe.Pointer(&saved))); e != 0 {
+			return os.NewSyscallError("ioctl", e)
+		}
+		return nil
+	}, nil
+}
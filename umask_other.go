@@ -0,0 +1,10 @@
+//go:build !unix
+
+package deputy
+
+import "errors"
+
+// withUmask is not supported on this platform.
+func withUmask(mask int, f func() error) error {
+	return errors.New("deputy: Umask is not supported on this platform")
+}
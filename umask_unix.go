@@ -0,0 +1,22 @@
+//go:build unix
+
+package deputy
+
+import (
+	"sync"
+	"syscall"
+)
+
+// umaskMu serializes changes to the process-wide umask.
+var umaskMu sync.Mutex
+
+// withUmask calls f with the process's umask set to mask, restoring it
+// afterward.  The umask is process-wide, so anything else in this process
+// creating files while f runs gets mask as well.
+func withUmask(mask int, f func() error) error {
+	umaskMu.Lock()
+	defer umaskMu.Unlock()
+	old := syscall.Umask(mask)
+	defer syscall.Umask(old)
+	return f()
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+package deputy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUmask(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "out")
+	if err := (Deputy{Umask: 0077}).Shell("touch " + Quote(file)); err != nil {
+		t.Fatalf("unexpected error returned from Shell: %v", err)
+	}
+	fi, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("expected mode 0600 but got %v", fi.Mode().Perm())
+	}
+}
@@ -0,0 +1,59 @@
+package deputy
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Verbosity is how much a Deputy says about what it is doing, as opposed to
+// what the commands it runs say.
+type Verbosity int
+
+const (
+	// Silent says nothing at all.
+	Silent Verbosity = iota - 1
+	// ErrorsOnly reports only problems that Run can't return, such as pipe
+	// errors under LogPipeError.  It is the default.
+	ErrorsOnly
+	// Normal also reports each command starting and exiting, and commands
+	// being stopped because of a timeout or cancellation.
+	Normal
+	// Debug also reports the details of how commands are stopped.
+	Debug
+)
+
+// String returns the name of the level, such as "normal".
+func (v Verbosity) String() string {
+	switch v {
+	case Silent:
+		return "silent"
+	case ErrorsOnly:
+		return "errors only"
+	case Normal:
+		return "normal"
+	case Debug:
+		return "debug"
+	}
+	return fmt.Sprintf("Verbosity(%d)", int(v))
+}
+
+// logf sends a message to the Deputy's Logger, if the Deputy's Verbosity is
+// at least v.
+func (d Deputy) logf(v Verbosity, format string, args ...interface{}) {
+	if d.Verbosity < v {
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	if d.Logger != nil {
+		d.Logger(msg)
+		return
+	}
+	log.Print(msg)
+}
+
+// describe returns the command line of cmd for messages, with the values of
+// secret flags redacted.
+func describe(args []string) string {
+	return strings.Join(redactArgs(args), " ")
+}
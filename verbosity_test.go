@@ -0,0 +1,49 @@
+package deputy
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestVerbosity(t *testing.T) {
+	var mu sync.Mutex
+	var msgs []string
+	logger := func(msg string) {
+		mu.Lock()
+		defer mu.Unlock()
+		msgs = append(msgs, msg)
+	}
+	run := func(v Verbosity, m maker, timeout time.Duration) []string {
+		mu.Lock()
+		msgs = nil
+		mu.Unlock()
+		d := Deputy{Verbosity: v, Logger: logger, Timeout: timeout}
+		_ = d.Run(m.make())
+		mu.Lock()
+		defer mu.Unlock()
+		return msgs
+	}
+
+	if got := run(ErrorsOnly, maker{stdout: "hi"}, 0); len(got) != 0 {
+		t.Errorf("expected no messages by default, got %q", got)
+	}
+	got := run(Normal, maker{stdout: "hi"}, 0)
+	if len(got) != 2 || !strings.Contains(got[0], "started") || !strings.Contains(got[1], "exited with code 0") {
+		t.Errorf("expected start and exit messages, got %q", got)
+	}
+	got = run(Debug, maker{timeout: 10 * time.Second}, 100*time.Millisecond)
+	want := []string{"started", "timed out", "killing", "failed"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d messages, got %q", len(want), got)
+	}
+	for i, w := range want {
+		if !strings.Contains(got[i], w) {
+			t.Errorf("expected message %d to mention %q, got %q", i, w, got[i])
+		}
+	}
+	if got := run(Silent, maker{exit: 1}, 0); len(got) != 0 {
+		t.Errorf("expected no messages when silent, got %q", got)
+	}
+}